@@ -0,0 +1,35 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterPodDefaultList is a list of ClusterPodDefault resources
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterPodDefaultList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterPodDefault `json:"items,omitempty"`
+}
+
+// A ClusterPodDefault is a cluster scoped PodDefault. Its dependencies
+// are read from the controller's namespace.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster
+type ClusterPodDefault struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec PodDefaultSpec `json:"spec"`
+}
+
+// PodDefault returns the ClusterPodDefault as a PodDefault without a
+// namespace.
+func (in *ClusterPodDefault) PodDefault() *PodDefault {
+	return &PodDefault{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: KindClusterPodDefault},
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec:       *in.Spec.DeepCopy(),
+	}
+}
@@ -0,0 +1,64 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterTemplateList is a list of cluster templates
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterTemplate `json:"items,omitempty"`
+}
+
+// ClusterTemplate is a cluster scoped Template. It can be referenced by
+// workloads in any namespace selected by AllowedNamespaces. PodDefaults
+// and dependencies referenced by a ClusterTemplate are read from the
+// controller's namespace.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+type ClusterTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec   ClusterTemplateSpec `json:"spec"`
+	Status TemplateStatus      `json:"status,omitempty"`
+}
+
+type ClusterTemplateSpec struct {
+	TemplateSpec `json:",inline"`
+
+	// AllowedNamespaces selects the namespaces, by label, whose workloads
+	// may reference the ClusterTemplate. If AllowedNamespaces is omitted,
+	// workloads in every namespace may reference it.
+	// +kubebuilder:validation:Optional
+	AllowedNamespaces *metav1.LabelSelector `json:"allowedNamespaces,omitempty"`
+}
+
+// Template returns the ClusterTemplate as a Template without a
+// namespace, so it can be published like any other Template.
+func (in *ClusterTemplate) Template() *Template {
+	return &Template{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: KindClusterTemplate},
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec:       *in.Spec.TemplateSpec.DeepCopy(),
+	}
+}
+
+// AllowsNamespace returns true if workloads in the namespace may
+// reference the ClusterTemplate.
+func (in *ClusterTemplate) AllowsNamespace(ns *corev1.Namespace) (bool, error) {
+	if in.Spec.AllowedNamespaces == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(in.Spec.AllowedNamespaces)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
@@ -51,10 +51,41 @@ type DagTask struct {
 	// dependencies
 	Name string `json:"name"`
 	// Template is the name of the template to use for the DagTask's job.
-	Template TemplateReference `json:"templateRef"`
+	// Exactly one of Template or DagRef must be set.
+	// +kubebuilder:validation:Optional
+	Template TemplateReference `json:"templateRef,omitempty"`
+	// DagRef is the name of another Dag in the same namespace to run
+	// in place of a job. The Dag is run as a child Execution owned by
+	// the parent Execution, and the task completes when the child
+	// Execution completes.
+	// +kubebuilder:validation:Optional
+	DagRef *corev1.LocalObjectReference `json:"dagRef,omitempty"`
 	// Command is the command to run in the DagTask's job. If Command is
 	// omitted, the command from the Template will be used.
 	Command []string `json:"command,omitempty"`
+	// Args are the arguments to the command run in the DagTask's job. If
+	// Args is omitted, the args from the Template will be used.
+	Args []string `json:"args,omitempty"`
+	// Env are environment variables merged into the Template's env by name.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// EnvFrom are sources of environment variables appended to the
+	// Template's envFrom.
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+	// WorkingDir overrides the working directory of the Template's container.
+	WorkingDir string `json:"workingDir,omitempty"`
+	// Image overrides the image of the Template's container. The image must
+	// match one of the Template's AllowedImages.
+	Image string `json:"image,omitempty"`
+	// Volumes are additional volumes added to the task's pod.
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+	// VolumeMounts are additional volume mounts added to the Template's
+	// container.
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// NodeSelector is merged into the node selector of the task's pod.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Parameters are values for the parameters declared by the Template.
+	// +kubebuilder:validation:Optional
+	Parameters map[string]string `json:"parameters,omitempty"`
 	// Options are the names of PodDefaults that should be merged into
 	// the task's pod template. The PodDefaults must be options in the template
 	// to be used.
@@ -67,23 +98,53 @@ type DagTask struct {
 	// from the Template will be used
 	// +kubebuilder:validation:Optional
 	Resources corev1.ResourceList `json:"resources,omitempty"`
+	// Preset is the name of one of the Template's resource presets. Any
+	// Resources take precedence over the preset.
+	// +kubebuilder:validation:Enum=small;medium;large
+	// +kubebuilder:validation:Optional
+	Preset string `json:"preset,omitempty"`
 }
 
 func (in *DagTask) HasDependencies() bool {
 	return len(in.Dependencies) > 0
 }
 
+// IsDag returns true if the task runs another Dag rather than
+// a Template.
+func (in *DagTask) IsDag() bool {
+	return in.DagRef != nil
+}
+
 func (in *DagTask) GetName() string {
 	return in.Name
 }
 
 func (in *DagTask) TemplateRef() types.NamespacedName {
+	if in.TemplateKind() == KindClusterTemplate {
+		return types.NamespacedName{Name: in.Template.Name}
+	}
 	return types.NamespacedName{
 		Name:      in.Template.Name,
 		Namespace: in.Template.Namespace,
 	}
 }
 
+// TemplateRevision returns the name of the TemplateRevision the
+// workload is pinned to, if any.
+func (in *DagTask) TemplateRevision() string {
+	return in.Template.Revision
+}
+
+// TemplateResourceVersion returns the resourceVersion of the template
+// the workload is pinned to, if any.
+func (in *DagTask) TemplateResourceVersion() string {
+	return in.Template.ResourceVersion
+}
+
+func (in *DagTask) TemplateKind() string {
+	return in.Template.TemplateKind()
+}
+
 func (in *DagTask) HistoryLimit() int {
 	return 1
 }
@@ -92,6 +153,14 @@ func (in *DagTask) ResourceRequests() corev1.ResourceList {
 	return in.Resources
 }
 
+func (in *DagTask) ResourcePreset() string {
+	return in.Preset
+}
+
+func (in *DagTask) ParameterValues() map[string]string {
+	return in.Parameters
+}
+
 func (in *DagTask) ElectedOptions() []corev1.LocalObjectReference {
 	return in.Options
 }
@@ -1,6 +1,8 @@
 package v1beta1
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -8,6 +10,8 @@ import (
 
 const (
 	ErrDuplicateTaskName = "duplicate task name"
+	ErrInvalidTaskRef    = "task must reference exactly one of templateRef or dagRef"
+	ErrRecursiveDag      = "recursive dag reference"
 )
 
 var (
@@ -36,6 +40,41 @@ func ValidateDag(dag *Dag) error {
 			return errors.Errorf("%s: task name %q is duplicated", ErrDuplicateTaskName, task.Name)
 		}
 		m[task.Name] = true
+
+		if task.IsDag() == (task.Template.Name != "") {
+			return errors.Errorf("%s: task %q", ErrInvalidTaskRef, task.Name)
+		}
+		if task.IsDag() && task.DagRef.Name == dag.Name {
+			return errors.Errorf("%s: task %q references its own dag %q", ErrRecursiveDag, task.Name, dag.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateDagRecursion walks the Dags referenced by the sub-Dag tasks of
+// dag and returns an error if any Dag is reachable from itself. The lookup
+// function returns the Dag with the given name in the namespace of dag.
+func ValidateDagRecursion(dag *Dag, lookup func(name string) (*Dag, error)) error {
+	return validateDagRecursion(dag, lookup, []string{dag.Name})
+}
+
+func validateDagRecursion(dag *Dag, lookup func(name string) (*Dag, error), path []string) error {
+	for _, task := range dag.Spec.Tasks {
+		if !task.IsDag() {
+			continue
+		}
+		for _, name := range path {
+			if name == task.DagRef.Name {
+				return errors.Errorf("%s: %s -> %s", ErrRecursiveDag, strings.Join(path, " -> "), name)
+			}
+		}
+		child, err := lookup(task.DagRef.Name)
+		if err != nil {
+			return err
+		}
+		if err := validateDagRecursion(child, lookup, append(path[:len(path):len(path)], child.Name)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
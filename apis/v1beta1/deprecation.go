@@ -0,0 +1,87 @@
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// NotebookConditionTemplateDeprecated is set on a Notebook when the
+	// template it references is deprecated.
+	NotebookConditionTemplateDeprecated = "TemplateDeprecated"
+
+	// ReasonTemplateDeprecated means the template is deprecated, but
+	// hasn't reached its sunset date.
+	ReasonTemplateDeprecated = "TemplateDeprecated"
+	// ReasonTemplateSunset means the template is past its sunset date.
+	// Stopped workloads are migrated to the replacement.
+	ReasonTemplateSunset = "TemplateSunset"
+	// ReasonTemplateMigrated means a workload was migrated from a template
+	// past its sunset date to the replacement.
+	ReasonTemplateMigrated = "TemplateMigrated"
+	// ReasonTemplateMigrationFailed means a workload couldn't be migrated
+	// to the replacement of a template past its sunset date.
+	ReasonTemplateMigrationFailed = "TemplateMigrationFailed"
+)
+
+// TemplateDeprecation marks a template as deprecated, so workloads that
+// reference it are warned and can be moved to a replacement.
+type TemplateDeprecation struct {
+	// Message explains why the template is deprecated.
+	// +kubebuilder:validation:Optional
+	Message string `json:"message,omitempty"`
+	// Replacement is the template workloads should use instead. Stopped
+	// workloads are migrated to it after the sunset date. If the
+	// Replacement is a Template without a namespace, it's in the same
+	// namespace as the deprecated template.
+	// +kubebuilder:validation:Optional
+	Replacement *TemplateReference `json:"replacement,omitempty"`
+}
+
+// Deprecated returns true if the template is deprecated.
+func (in *Template) Deprecated() bool {
+	return in.Spec.Deprecated != nil
+}
+
+// Sunset returns true if the template is deprecated and the sunset date
+// has passed.
+func (in *Template) Sunset(now time.Time) bool {
+	return in.Deprecated() && in.Spec.SunsetDate != nil && !now.Before(in.Spec.SunsetDate.Time)
+}
+
+// Replacement returns a reference to the template that replaces a
+// deprecated template, or nil if there isn't one.
+func (in *Template) Replacement() *TemplateReference {
+	if !in.Deprecated() || in.Spec.Deprecated.Replacement == nil {
+		return nil
+	}
+	ref := in.Spec.Deprecated.Replacement.DeepCopy()
+	if ref.TemplateKind() == KindTemplate && ref.Namespace == "" {
+		ref.Namespace = in.Namespace
+	}
+	return ref
+}
+
+// DeprecationMessage describes the deprecation of the template for
+// users of the template.
+func (in *Template) DeprecationMessage() string {
+	if !in.Deprecated() {
+		return ""
+	}
+	kind := in.Kind
+	if kind == "" {
+		kind = KindTemplate
+	}
+	parts := []string{fmt.Sprintf("%s %q is deprecated", kind, in.Name)}
+	if in.Spec.Deprecated.Message != "" {
+		parts[0] += ": " + in.Spec.Deprecated.Message
+	}
+	if ref := in.Spec.Deprecated.Replacement; ref != nil {
+		parts = append(parts, fmt.Sprintf("use %s %q instead", ref.TemplateKind(), ref.Name))
+	}
+	if in.Spec.SunsetDate != nil {
+		parts = append(parts, fmt.Sprintf("sunset on %s", in.Spec.SunsetDate.UTC().Format(time.RFC3339)))
+	}
+	return strings.Join(parts, "; ")
+}
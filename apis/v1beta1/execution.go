@@ -6,6 +6,30 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	ExecutionPhaseQueued    = "Queued"
+	ExecutionPhaseRunning   = "Running"
+	ExecutionPhaseSucceeded = "Succeeded"
+	ExecutionPhaseFailed    = "Failed"
+
+	// ReasonTaskStarted means the Job or child Execution of a task was
+	// created.
+	ReasonTaskStarted = "TaskStarted"
+	// ReasonTaskSucceeded means a task completed successfully.
+	ReasonTaskSucceeded = "TaskSucceeded"
+	// ReasonTaskFailed means a task failed, or couldn't be started.
+	ReasonTaskFailed = "TaskFailed"
+	// ReasonExecutionSucceeded means every task of an Execution
+	// completed successfully.
+	ReasonExecutionSucceeded = "ExecutionSucceeded"
+	// ReasonExecutionFailed means an Execution stopped because one of its
+	// tasks failed, or its Dag can't be executed.
+	ReasonExecutionFailed = "ExecutionFailed"
+	// ReasonContainerNotFound means a task overrides a container that
+	// isn't in its template or PodDefaults.
+	ReasonContainerNotFound = "ContainerNotFound"
+)
+
 // ExecutionList is a list of Execution resources
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type ExecutionList struct {
@@ -18,6 +42,8 @@ type ExecutionList struct {
 // An Execution is a job that runs a Dag.
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type Execution struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
@@ -46,6 +72,20 @@ func (e *Execution) SetTaskStatus(task string, status ExecutionTaskStatus) {
 	e.Status.Tasks[task] = status
 }
 
+// Queued returns true if the Execution is waiting for a slot in its
+// ExecutionQueue and hasn't started any tasks.
+func (e *Execution) Queued() bool {
+	return e.Status.Phase == "" || e.Status.Phase == ExecutionPhaseQueued
+}
+
+// Priority returns the priority of the Execution in its queue.
+func (e *Execution) Priority() int {
+	if e.Spec.Priority == nil {
+		return 0
+	}
+	return *e.Spec.Priority
+}
+
 func (e *Execution) AsOwner() metav1.OwnerReference {
 	b := true
 	return metav1.OwnerReference{
@@ -68,9 +108,29 @@ type ExecutionSpec struct {
 	// +kubebuilder:default=10
 	// +kubebuilder:validation:Optional
 	Parallelism int `json:"parallelism"`
+	// QueueRef is the name of the ExecutionQueue the Execution is admitted
+	// through. If QueueRef is omitted, the Execution starts immediately.
+	// +kubebuilder:validation:Optional
+	QueueRef *corev1.LocalObjectReference `json:"queueRef,omitempty"`
+	// Priority orders Executions waiting in the same ExecutionQueue. Executions
+	// with a higher priority are admitted first, and Executions with the same
+	// priority are admitted in the order they were created.
+	// +kubebuilder:validation:Optional
+	Priority *int `json:"priority,omitempty"`
+	// Parameters are values for the parameters declared by the Templates
+	// of the Dag's tasks. Each task is given the values of the parameters
+	// its Template declares, and values set on the task take precedence.
+	// Executions started by sub-Dag tasks inherit the parameters of the
+	// parent Execution and the task.
+	// +kubebuilder:validation:Optional
+	Parameters map[string]string `json:"parameters,omitempty"`
 }
 
 type ExecutionStatus struct {
+	// Phase is one of Queued, Running, Succeeded or Failed.
+	// +kubebuilder:validation:Enum=Queued;Running;Succeeded;Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
 	// Tasks is a map of task names to their current status.
 	Tasks map[string]ExecutionTaskStatus `json:"tasks"`
 	// Completed is true when all tasks have completed.
@@ -86,4 +146,13 @@ type ExecutionTaskStatus struct {
 	Completed bool `json:"completed"`
 	// Succeeded is true when all tasks have completed successfully.
 	Succeeded bool `json:"succeeded"`
+	// Message is a human-readable explanation of why the task failed
+	// before a job could be created.
+	Message string `json:"message,omitempty"`
+	// Logs is a reference to where the logs of the task's container were
+	// stored after the task completed, such as configmap/<name>.
+	Logs string `json:"logs,omitempty"`
+	// LogsError explains why the logs of the task's container couldn't be
+	// collected. Logs aren't collected again once collecting them failed.
+	LogsError string `json:"logsError,omitempty"`
 }
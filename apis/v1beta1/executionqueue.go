@@ -0,0 +1,46 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExecutionQueueList is a list of ExecutionQueue resources
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ExecutionQueueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ExecutionQueue `json:"items,omitempty"`
+}
+
+// An ExecutionQueue bounds the number of Executions that can run at
+// once in a namespace. Executions that reference a full queue are held
+// in the Queued phase until a slot is available. Queued Executions are
+// admitted in order of priority, then in order of creation.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:printcolumn:name="Max",type=integer,JSONPath=`.spec.maxConcurrentExecutions`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ExecutionQueue struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec ExecutionQueueSpec `json:"spec"`
+}
+
+// MaxConcurrentExecutions returns the maximum number of Executions that
+// can run at once in the queue. If unspecified, the default is 1.
+func (q *ExecutionQueue) MaxConcurrentExecutions() int {
+	if q.Spec.MaxConcurrentExecutions == 0 {
+		return 1
+	}
+	return q.Spec.MaxConcurrentExecutions
+}
+
+type ExecutionQueueSpec struct {
+	// MaxConcurrentExecutions is the number of Executions referencing
+	// the queue that can run at the same time.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Optional
+	MaxConcurrentExecutions int `json:"maxConcurrentExecutions"`
+}
@@ -11,6 +11,102 @@ import (
 const (
 	NotebookPhaseRunning = "Running"
 	NotebookPhaseStopped = "Stopped"
+	NotebookPhasePending = "Pending"
+
+	// NotebookConditionTemplateResolved is true when the template the
+	// Notebook references exists and can be used by the Notebook.
+	NotebookConditionTemplateResolved = "TemplateResolved"
+	// NotebookConditionRevisionElected is true when one of the Notebook's
+	// Revisions is elected, so its Pod can be created.
+	NotebookConditionRevisionElected = "RevisionElected"
+	// NotebookConditionPodScheduled is true when the Notebook's Pod has
+	// been scheduled to a node.
+	NotebookConditionPodScheduled = "PodScheduled"
+	// NotebookConditionReady is true when the Notebook's Pod is ready.
+	NotebookConditionReady = "Ready"
+	// NotebookConditionCulled is true when the Notebook is stopped, so
+	// its Pod has been removed to free its resources.
+	NotebookConditionCulled = "Culled"
+	// NotebookConditionDegraded is true when the Notebook can't run as
+	// expected, and needs someone to fix it.
+	NotebookConditionDegraded = "Degraded"
+	// NotebookConditionRevisionReady is false when the Notebook's Pod
+	// can't be created because its elected Revision isn't ready.
+	NotebookConditionRevisionReady = "RevisionReady"
+	// NotebookConditionRevisionOutOfDate is true when the Notebook's Pod
+	// no longer matches its elected Revision, and is restarted the next
+	// time the Notebook is stopped and started.
+	NotebookConditionRevisionOutOfDate = "RevisionOutOfDate"
+	// NotebookConditionRevisionPinned is true when the Revision named by
+	// the Notebook's revisionRef is elected, and false when it can't be.
+	// It's removed when revisionRef is cleared.
+	NotebookConditionRevisionPinned = "RevisionPinned"
+
+	// ReasonTemplateResolved means the Notebook's template was found.
+	ReasonTemplateResolved = "TemplateResolved"
+	// ReasonTemplateNotFound means the Notebook's template doesn't exist.
+	ReasonTemplateNotFound = "TemplateNotFound"
+	// ReasonTemplateNotAllowed means the Notebook references a Template
+	// in a namespace it can't use templates from.
+	ReasonTemplateNotAllowed = "TemplateNotAllowed"
+	// ReasonRevisionElected means one of the Notebook's Revisions is
+	// elected.
+	ReasonRevisionElected = "RevisionElected"
+	// ReasonNoRevisionElected means none of the Notebook's Revisions are
+	// elected, which happens when the update policy is Ignore and the
+	// Notebook hasn't run before.
+	ReasonNoRevisionElected = "NoRevisionElected"
+	// ReasonElectionFailed means a Revision couldn't be published or
+	// elected for the Notebook, such as when it elects an option its
+	// template doesn't have.
+	ReasonElectionFailed = "ElectionFailed"
+	// ReasonInvalidOptions means a workload elects options its template
+	// doesn't have.
+	ReasonInvalidOptions = "InvalidOptions"
+	// ReasonRevisionCreated means a Revision was published for the
+	// Notebook.
+	ReasonRevisionCreated = "RevisionCreated"
+	// ReasonPodCreated means the Notebook's Pod was created.
+	ReasonPodCreated = "PodCreated"
+	// ReasonPodDeleted means the Notebook's Pod was deleted because the
+	// Notebook was stopped.
+	ReasonPodDeleted = "PodDeleted"
+	// ReasonStopped means the Notebook is stopped.
+	ReasonStopped = "Stopped"
+	// ReasonRunning means the Notebook isn't stopped.
+	ReasonRunning = "Running"
+	// ReasonPodNotCreated means the Notebook's Pod hasn't been created.
+	ReasonPodNotCreated = "PodNotCreated"
+	// ReasonPodScheduled means the Notebook's Pod has been scheduled.
+	ReasonPodScheduled = "PodScheduled"
+	// ReasonPodReady means the Notebook's Pod is ready.
+	ReasonPodReady = "PodReady"
+	// ReasonPodNotReady means the Notebook's Pod isn't ready.
+	ReasonPodNotReady = "PodNotReady"
+	// ReasonPodFailed means the Notebook's Pod has failed.
+	ReasonPodFailed = "PodFailed"
+	// ReasonContainerFailing means one of the containers of the
+	// Notebook's Pod can't start, such as when it's crash looping or its
+	// image can't be pulled.
+	ReasonContainerFailing = "ContainerFailing"
+	// ReasonAsExpected means nothing is wrong with the Notebook.
+	ReasonAsExpected = "AsExpected"
+
+	// ReasonRolledBack means the Revision named by a Notebook's
+	// revisionRef was elected.
+	ReasonRolledBack = "RolledBack"
+	// ReasonRollbackFailed means the Revision named by a Notebook's
+	// revisionRef couldn't be elected.
+	ReasonRollbackFailed = "RollbackFailed"
+	// ReasonRevisionChanged means a different Revision was elected after
+	// the Notebook's Pod was started.
+	ReasonRevisionChanged = "RevisionChanged"
+	// ReasonPodModified means the Notebook's Pod was edited after it was
+	// started, so it no longer matches its Revision.
+	ReasonPodModified = "PodModified"
+	// ReasonMaintenanceRestart means a Pod that was out of date with its
+	// Revision was restarted during the maintenance window.
+	ReasonMaintenanceRestart = "MaintenanceRestart"
 )
 
 // NotebookList is a list of notebooks
@@ -27,6 +123,12 @@ type NotebookList struct {
 // Revisions are the actual runtime workload.
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Template",type=string,JSONPath=`.spec.templateRef.name`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`,priority=1
+// +kubebuilder:printcolumn:name="Restart",type=boolean,JSONPath=`.status.pendingRestart`,priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type Notebook struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
@@ -52,7 +154,7 @@ func (nb *Notebook) Stopped() bool {
 }
 
 func (nb *Notebook) ElectedOptions() []corev1.LocalObjectReference {
-	opts := make([]corev1.LocalObjectReference, len(nb.Spec.Options))
+	opts := make([]corev1.LocalObjectReference, 0, len(nb.Spec.Options))
 	for _, item := range nb.Spec.Options {
 		opts = append(opts, corev1.LocalObjectReference{Name: item})
 	}
@@ -85,10 +187,43 @@ func (nb *Notebook) ResourceRequests() corev1.ResourceList {
 	return nb.Spec.ResourceRequests
 }
 
+func (nb *Notebook) ResourcePreset() string {
+	return nb.Spec.Preset
+}
+
+func (nb *Notebook) ParameterValues() map[string]string {
+	return nb.Spec.Parameters
+}
+
+// TemplateRef returns the name and namespace of the referenced template.
+// ClusterTemplates don't have a namespace, and Templates default to the
+// namespace of the Notebook.
 func (nb *Notebook) TemplateRef() types.NamespacedName {
+	switch {
+	case nb.TemplateKind() == KindClusterTemplate:
+		return types.NamespacedName{Name: nb.Spec.TemplateRef.Name}
+	case nb.Spec.TemplateRef.Namespace != "":
+		return types.NamespacedName{Name: nb.Spec.TemplateRef.Name, Namespace: nb.Spec.TemplateRef.Namespace}
+	}
 	return types.NamespacedName{Name: nb.Spec.TemplateRef.Name, Namespace: nb.Namespace}
 }
 
+// TemplateRevision returns the name of the TemplateRevision the
+// workload is pinned to, if any.
+func (nb *Notebook) TemplateRevision() string {
+	return nb.Spec.TemplateRef.Revision
+}
+
+// TemplateResourceVersion returns the resourceVersion of the template
+// the workload is pinned to, if any.
+func (nb *Notebook) TemplateResourceVersion() string {
+	return nb.Spec.TemplateRef.ResourceVersion
+}
+
+func (nb *Notebook) TemplateKind() string {
+	return nb.Spec.TemplateRef.TemplateKind()
+}
+
 func (nb *Notebook) HasUpdatePolicy() bool {
 	return nb.Spec.UpdatePolicy != nil
 }
@@ -123,11 +258,23 @@ type NotebookSpec struct {
 	// be updated during downtime.
 	// +kubebuilder:validation:Enum=Auto;Ignore
 	UpdatePolicy *string `json:"updatePolicy,omitempty"`
+	// RevisionRef is the name of one of the Notebook's Revisions to roll
+	// back to. The Revision is elected in place of the current one, and
+	// new Revisions aren't elected while RevisionRef is set, even if the
+	// UpdatePolicy is Auto. A running Notebook keeps its Pod until it's
+	// stopped, and uses the Revision when it's started again.
+	// +kubebuilder:validation:Optional
+	RevisionRef string `json:"revisionRef,omitempty"`
 	// ResourceRequests are resources requested for the notebook, such as
 	// memory, cpu, and storage. If ResourceRequests is omitted, the defaults
 	// from the Template will be used
 	// +kubebuilder:validation:Optional
 	ResourceRequests corev1.ResourceList `json:"resources,omitempty"`
+	// Preset is the name of one of the Template's resource presets. Any
+	// ResourceRequests take precedence over the preset.
+	// +kubebuilder:validation:Enum=small;medium;large
+	// +kubebuilder:validation:Optional
+	Preset string `json:"preset,omitempty"`
 	// TemplateRef is a reference to a specific template revision. If the
 	// template revision isn't specified, the latest template revision will
 	// be used.
@@ -141,6 +288,10 @@ type NotebookSpec struct {
 	// Options will be applied directly to the NotebookRevision.
 	// +kubebuilder:optional
 	Options []string `json:"options,omitempty"`
+	// Parameters are values for the parameters declared by the Template.
+	// Parameters that are omitted use the Template's default.
+	// +kubebuilder:validation:Optional
+	Parameters map[string]string `json:"parameters,omitempty"`
 }
 
 type NotebookRevision struct {
@@ -150,14 +301,21 @@ type NotebookRevision struct {
 }
 
 type NotebookStatus struct {
-	Conditions []corev1.PodCondition `json:"conditions,omitempty"`
-	Phase      corev1.PodPhase       `json:"phase"`
-	Revisions  []NotebookRevision    `json:"revisions"`
-}
-
-type NotebookCondition struct {
-	Type               string      `json:"type"`
-	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
-	Reason             string      `json:"reason"`
-	Message            string      `json:"message,omitempty"`
+	// Conditions describe the state of the Notebook, its template,
+	// Revisions and Pod.
+	// +listType=map
+	// +listMapKey=type
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	Phase      corev1.PodPhase    `json:"phase"`
+	Revisions  []NotebookRevision `json:"revisions"`
+	// ObservedGeneration is the generation of the Notebook the status
+	// was last computed for.
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// PendingRestart is true when the Notebook's Pod is out of date with
+	// its elected Revision. The Pod is brought up to date when it's
+	// restarted.
+	// +kubebuilder:validation:Optional
+	PendingRestart bool `json:"pendingRestart,omitempty"`
 }
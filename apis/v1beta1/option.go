@@ -0,0 +1,88 @@
+package v1beta1
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// OptionGroupPolicyExclusive allows at most one option in the
+	// group to be elected.
+	OptionGroupPolicyExclusive = "Exclusive"
+	// OptionGroupPolicyRequiredOneOf requires exactly one option in
+	// the group to be elected.
+	OptionGroupPolicyRequiredOneOf = "RequiredOneOf"
+)
+
+const (
+	ErrUnknownOption       = "unknown option"
+	ErrOptionConflict      = "conflicting options"
+	ErrOptionRequired      = "missing required option"
+	ErrOptionGroupExcluded = "only one option can be elected from group"
+	ErrOptionGroupRequired = "one option must be elected from group"
+)
+
+// An OptionGroup is a set of related options, such as alternative
+// package indexes, that constrains which of them can be elected together.
+type OptionGroup struct {
+	// Name is the name of the group, unique within the Template.
+	Name string `json:"name"`
+	// Description describes the group to users.
+	// +kubebuilder:validation:Optional
+	Description string `json:"description,omitempty"`
+	// Policy is either Exclusive, which allows at most one of the group's
+	// options to be elected, or RequiredOneOf, which requires exactly one.
+	// +kubebuilder:validation:Enum=Exclusive;RequiredOneOf
+	// +kubebuilder:default=Exclusive
+	// +kubebuilder:validation:Optional
+	Policy string `json:"policy,omitempty"`
+}
+
+// ValidateOptions returns an error if the elected options don't exist in
+// the Template, or break the constraints of the options and their groups.
+func (in *Template) ValidateOptions(elected []string) error {
+	opts := make(map[string]TemplateOption, len(in.Spec.Options))
+	for _, opt := range in.Spec.Options {
+		opts[opt.Name] = opt
+	}
+	names := make(map[string]bool, len(elected))
+	for _, name := range elected {
+		if _, ok := opts[name]; !ok {
+			return errors.Errorf("%s: %s", ErrUnknownOption, name)
+		}
+		names[name] = true
+	}
+
+	sorted := append([]string{}, elected...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		opt := opts[name]
+		for _, req := range opt.Requires {
+			if !names[req] {
+				return errors.Errorf("%s: %s requires %s", ErrOptionRequired, name, req)
+			}
+		}
+		for _, other := range opt.Conflicts {
+			if names[other] {
+				return errors.Errorf("%s: %s conflicts with %s", ErrOptionConflict, name, other)
+			}
+		}
+	}
+
+	for _, group := range in.Spec.OptionGroups {
+		members := make([]string, 0)
+		for _, opt := range in.Spec.Options {
+			if opt.Group == group.Name && names[opt.Name] {
+				members = append(members, opt.Name)
+			}
+		}
+		if len(members) > 1 {
+			return errors.Errorf("%s %s: %q", ErrOptionGroupExcluded, group.Name, members)
+		}
+		if len(members) == 0 && group.Policy == OptionGroupPolicyRequiredOneOf {
+			return errors.Errorf("%s %s", ErrOptionGroupRequired, group.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package v1beta1
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ParameterTypeString  = "string"
+	ParameterTypeInteger = "integer"
+	ParameterTypeBoolean = "boolean"
+)
+
+const (
+	ErrUnknownParameter = "unknown parameter"
+	ErrMissingParameter = "missing parameter"
+	ErrInvalidParameter = "invalid parameter"
+)
+
+// A TemplateParameter is a typed input to a Template. Parameters are
+// referenced in the string fields of the Template's pod spec as
+// $(params.<name>), and are substituted when a revision is published.
+type TemplateParameter struct {
+	// Name is the name of the parameter, unique within the Template.
+	Name string `json:"name"`
+	// Description describes the parameter to users.
+	// +kubebuilder:validation:Optional
+	Description string `json:"description,omitempty"`
+	// Type is the type of the parameter's value.
+	// +kubebuilder:validation:Enum=string;integer;boolean
+	// +kubebuilder:default=string
+	// +kubebuilder:validation:Optional
+	Type string `json:"type,omitempty"`
+	// Default is the value used when a workload doesn't provide one. If
+	// Default is omitted, workloads must provide a value.
+	// +kubebuilder:validation:Optional
+	Default *string `json:"default,omitempty"`
+	// Enum restricts the value to one of the listed values.
+	// +kubebuilder:validation:Optional
+	Enum []string `json:"enum,omitempty"`
+	// Minimum is the smallest value allowed for an integer parameter.
+	// +kubebuilder:validation:Optional
+	Minimum *int64 `json:"minimum,omitempty"`
+	// Maximum is the largest value allowed for an integer parameter.
+	// +kubebuilder:validation:Optional
+	Maximum *int64 `json:"maximum,omitempty"`
+}
+
+// Validate returns an error if the value isn't valid for the parameter.
+func (in *TemplateParameter) Validate(value string) error {
+	switch in.Type {
+	case ParameterTypeInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.Errorf("%s: %s: %q is not an integer", ErrInvalidParameter, in.Name, value)
+		}
+		if in.Minimum != nil && n < *in.Minimum {
+			return errors.Errorf("%s: %s: %d is less than the minimum %d", ErrInvalidParameter, in.Name, n, *in.Minimum)
+		}
+		if in.Maximum != nil && n > *in.Maximum {
+			return errors.Errorf("%s: %s: %d is greater than the maximum %d", ErrInvalidParameter, in.Name, n, *in.Maximum)
+		}
+	case ParameterTypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.Errorf("%s: %s: %q is not a boolean", ErrInvalidParameter, in.Name, value)
+		}
+	}
+	if len(in.Enum) > 0 {
+		for _, item := range in.Enum {
+			if item == value {
+				return nil
+			}
+		}
+		return errors.Errorf("%s: %s: %q is not one of %q", ErrInvalidParameter, in.Name, value, in.Enum)
+	}
+	return nil
+}
+
+// ValidateParameters returns an error if any of the values isn't for one
+// of the Template's parameters, or isn't valid for it. Unlike
+// ResolveParameters, parameters without a value aren't an error.
+func (in *Template) ValidateParameters(values map[string]string) error {
+	params := make(map[string]TemplateParameter, len(in.Spec.Parameters))
+	for _, param := range in.Spec.Parameters {
+		params[param.Name] = param
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param, ok := params[name]
+		if !ok {
+			return errors.Errorf("%s: %s", ErrUnknownParameter, name)
+		}
+		if err := param.Validate(values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveParameters validates the values against the Template's parameters
+// and returns the values with defaults filled in for any that were omitted.
+func (in *Template) ResolveParameters(values map[string]string) (map[string]string, error) {
+	if err := in.ValidateParameters(values); err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]string, len(in.Spec.Parameters))
+	for _, param := range in.Spec.Parameters {
+		value, ok := values[param.Name]
+		if !ok {
+			if param.Default == nil {
+				return nil, errors.Errorf("%s: %s", ErrMissingParameter, param.Name)
+			}
+			value = *param.Default
+		}
+		if err := param.Validate(value); err != nil {
+			return nil, err
+		}
+		resolved[param.Name] = value
+	}
+	return resolved, nil
+}
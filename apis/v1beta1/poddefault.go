@@ -2,6 +2,7 @@ package v1beta1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
 )
 
 // PodDefaultList is a list of PodDefault resources
@@ -35,4 +36,34 @@ func (in *PodDefault) PodTemplateSpec() PodTemplateSpec {
 type PodDefaultSpec struct {
 	Template     PodTemplateSpec        `json:"template"`
 	Dependencies []LocalObjectReference `json:"dependencies,omitempty"`
+	// Selector applies the PodDefault to any Template, Notebook or DagTask
+	// with matching labels, without it being listed as required or elected
+	// as an option. A PodDefault applies to workloads in its own namespace,
+	// and a ClusterPodDefault to workloads in every namespace. If Selector
+	// is omitted, the PodDefault is only applied when it's referenced.
+	// +kubebuilder:validation:Optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Priority orders the PodDefaults applied by selector. PodDefaults
+	// with a higher priority are merged later, so they take precedence.
+	// PodDefaults with the same priority are merged in order of name.
+	// +kubebuilder:validation:Optional
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// Matches returns true if the PodDefault's selector matches any
+// of the label sets.
+func (in *PodDefault) Matches(labels ...map[string]string) (bool, error) {
+	if in.Spec.Selector == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(in.Spec.Selector)
+	if err != nil {
+		return false, err
+	}
+	for _, set := range labels {
+		if selector.Matches(k8slabels.Set(set)) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
@@ -0,0 +1,119 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// PodDefaultSourceSelected is a PodDefault merged because its
+	// selector matches the template or workload.
+	PodDefaultSourceSelected = "Selected"
+	// PodDefaultSourceRequired is a PodDefault the template requires.
+	PodDefaultSourceRequired = "Required"
+	// PodDefaultSourceElected is a PodDefault of an option the workload
+	// elected.
+	PodDefaultSourceElected = "Elected"
+)
+
+var (
+	// AnnotationKeyProvenance records how a Revision was built, as a
+	// Provenance encoded as JSON.
+	AnnotationKeyProvenance = fmt.Sprintf("%s/provenance", GroupName)
+)
+
+// Provenance records the inputs a Revision's pod template was built from,
+// so the build can be reproduced.
+type Provenance struct {
+	// Template is the template the Revision was rendered from.
+	Template TemplateProvenance `json:"template"`
+	// Ancestors are the templates Template extends, nearest first. They
+	// aren't recorded when the template is pinned to a TemplateRevision,
+	// which already has everything it inherited.
+	Ancestors []TemplateProvenance `json:"ancestors,omitempty"`
+	// PodDefaults are the PodDefaults merged into the template, in the
+	// order they were merged.
+	PodDefaults []PodDefaultProvenance `json:"podDefaults,omitempty"`
+	// PatchHashes are the sha256 hashes of the patches applied after the
+	// PodDefaults, in the order they were applied. Only the hashes are
+	// recorded, since the patches could exceed the size limit of the
+	// annotations. The patches are configured on the controller.
+	PatchHashes []string `json:"patchHashes,omitempty"`
+	// ControllerVersion is the version of the controller that
+	// published the Revision.
+	ControllerVersion string `json:"controllerVersion,omitempty"`
+	// Referrer is the workload the Revision was published for.
+	Referrer ReferrerProvenance `json:"referrer"`
+}
+
+// TemplateProvenance identifies the version of a template.
+type TemplateProvenance struct {
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace,omitempty"`
+	UID       types.UID `json:"uid,omitempty"`
+	// ResourceVersion is the resourceVersion of the template when it
+	// was read, or the resourceVersion a TemplateRevision was taken at.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// TemplateRevision is the TemplateRevision the workload is pinned
+	// to, if any.
+	TemplateRevision string `json:"templateRevision,omitempty"`
+}
+
+// PodDefaultProvenance identifies the version of a merged PodDefault.
+type PodDefaultProvenance struct {
+	Kind            string    `json:"kind"`
+	Name            string    `json:"name"`
+	Namespace       string    `json:"namespace,omitempty"`
+	UID             types.UID `json:"uid,omitempty"`
+	ResourceVersion string    `json:"resourceVersion,omitempty"`
+	// Source is why the PodDefault was merged, either Selected,
+	// Required or Elected.
+	Source string `json:"source"`
+	// Option is the name of the elected option for Elected PodDefaults.
+	Option string `json:"option,omitempty"`
+}
+
+// ReferrerProvenance identifies the version of the workload spec a
+// Revision was published for.
+type ReferrerProvenance struct {
+	// Kind is the kind of the workload. It's empty for Dag tasks, which
+	// aren't objects of their own.
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Dag is the name of the Dag a task is in.
+	Dag        string `json:"dag,omitempty"`
+	Generation int64  `json:"generation,omitempty"`
+}
+
+// Provenance returns the Provenance recorded on the Revision, or nil if
+// the Revision was published before provenance was recorded.
+func (r *Revision) Provenance() (*Provenance, error) {
+	raw, ok := r.GetAnnotations()[AnnotationKeyProvenance]
+	if !ok {
+		return nil, nil
+	}
+	p := &Provenance{}
+	if err := json.Unmarshal([]byte(raw), p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetProvenance records the Provenance on the Revision.
+func (r *Revision) SetProvenance(p *Provenance) error {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	annotations := r.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AnnotationKeyProvenance] = string(raw)
+	r.SetAnnotations(annotations)
+	return nil
+}
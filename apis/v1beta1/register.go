@@ -22,10 +22,18 @@ var (
 
 func init() {
 	SchemeBuilder.Register(
+		&ClusterPodDefault{},
+		&ClusterPodDefaultList{},
+		&ClusterTemplate{},
+		&ClusterTemplateList{},
+		&ClusterTemplateRevision{},
+		&ClusterTemplateRevisionList{},
 		&Dag{},
 		&DagList{},
 		&Execution{},
 		&ExecutionList{},
+		&ExecutionQueue{},
+		&ExecutionQueueList{},
 		&Notebook{},
 		&NotebookList{},
 		&PodDefault{},
@@ -34,5 +42,7 @@ func init() {
 		&RevisionList{},
 		&Template{},
 		&TemplateList{},
+		&TemplateRevision{},
+		&TemplateRevisionList{},
 	)
 }
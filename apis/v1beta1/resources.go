@@ -0,0 +1,147 @@
+package v1beta1
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	PresetSmall  = "small"
+	PresetMedium = "medium"
+	PresetLarge  = "large"
+)
+
+const (
+	ErrUnknownPreset        = "unknown resource preset"
+	ErrResourceBelowMinimum = "resource request is below the minimum"
+	ErrResourceAboveMaximum = "resource request is above the maximum"
+)
+
+// TemplateResources bounds the resources workloads can request from a
+// Template, and provides defaults for workloads that don't request any.
+type TemplateResources struct {
+	// Min is the smallest request allowed for each resource.
+	// +kubebuilder:validation:Optional
+	Min corev1.ResourceList `json:"min,omitempty"`
+	// Max is the largest request allowed for each resource.
+	// +kubebuilder:validation:Optional
+	Max corev1.ResourceList `json:"max,omitempty"`
+	// Defaults are the requests used for resources the workload
+	// doesn't request.
+	// +kubebuilder:validation:Optional
+	Defaults corev1.ResourceList `json:"defaults,omitempty"`
+	// Presets are named sets of requests that workloads can choose
+	// from instead of requesting each resource.
+	// +kubebuilder:validation:Optional
+	Presets []ResourcePreset `json:"presets,omitempty"`
+}
+
+// A ResourcePreset is a named size a workload can request.
+type ResourcePreset struct {
+	// +kubebuilder:validation:Enum=small;medium;large
+	Name     string              `json:"name"`
+	Requests corev1.ResourceList `json:"requests"`
+}
+
+// Preset returns the named preset, or nil if the preset doesn't exist.
+func (in *TemplateResources) Preset(name string) *ResourcePreset {
+	for k := range in.Presets {
+		if in.Presets[k].Name == name {
+			return &in.Presets[k]
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if any of the requests are outside of the
+// bounds.
+func (in *TemplateResources) Validate(requests corev1.ResourceList) error {
+	names := make([]string, 0, len(requests))
+	for name := range requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		q := requests[corev1.ResourceName(name)]
+		if min, ok := in.Min[corev1.ResourceName(name)]; ok && q.Cmp(min) < 0 {
+			return errors.Errorf("%s: %s: %s is less than %s", ErrResourceBelowMinimum, name, q.String(), min.String())
+		}
+		if max, ok := in.Max[corev1.ResourceName(name)]; ok && q.Cmp(max) > 0 {
+			return errors.Errorf("%s: %s: %s is greater than %s", ErrResourceAboveMaximum, name, q.String(), max.String())
+		}
+	}
+	return nil
+}
+
+// ResolveResources returns the requests for a workload using the preset
+// and requests it asked for. Requests take precedence over the preset,
+// and the preset over the Template's defaults. An error is returned if
+// the preset doesn't exist or the requests are out of bounds.
+func (in *Template) ResolveResources(preset string, requests corev1.ResourceList) (corev1.ResourceList, error) {
+	resources := in.Spec.Resources
+	if resources == nil {
+		resources = &TemplateResources{}
+	}
+	resolved := make(corev1.ResourceList)
+	for name, q := range resources.Defaults {
+		resolved[name] = q.DeepCopy()
+	}
+	if preset != "" {
+		p := resources.Preset(preset)
+		if p == nil {
+			return nil, errors.Errorf("%s: %s", ErrUnknownPreset, preset)
+		}
+		for name, q := range p.Requests {
+			resolved[name] = q.DeepCopy()
+		}
+	}
+	for name, q := range requests {
+		resolved[name] = q.DeepCopy()
+	}
+	if err := resources.Validate(resolved); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// SetResourceRequests sets the requests on the named container. Limits
+// for cpu and memory are the requests multiplied by ratio, and limits for
+// other resources, such as GPUs, are equal to the requests. If ratio is
+// zero, limits aren't set.
+func (in *PodTemplateSpec) SetResourceRequests(container string, requests corev1.ResourceList, ratio float64) {
+	for k := range in.Spec.Containers {
+		c := &in.Spec.Containers[k]
+		if c.Name != container {
+			continue
+		}
+		for name, q := range requests {
+			if c.Resources.Requests == nil {
+				c.Resources.Requests = make(corev1.ResourceList)
+			}
+			c.Resources.Requests[name] = q.DeepCopy()
+			if ratio <= 0 {
+				continue
+			}
+			if c.Resources.Limits == nil {
+				c.Resources.Limits = make(corev1.ResourceList)
+			}
+			c.Resources.Limits[name] = Limit(name, q, ratio)
+		}
+	}
+}
+
+// Limit returns the limit for a request of the named resource. Only cpu
+// and memory can be overcommitted, so the limits of other resources
+// are equal to their requests.
+func Limit(name corev1.ResourceName, request resource.Quantity, ratio float64) resource.Quantity {
+	switch name {
+	case corev1.ResourceCPU:
+		return *resource.NewMilliQuantity(int64(float64(request.MilliValue())*ratio), request.Format)
+	case corev1.ResourceMemory:
+		return *resource.NewQuantity(int64(float64(request.Value())*ratio), request.Format)
+	}
+	return request.DeepCopy()
+}
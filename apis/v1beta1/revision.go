@@ -1,8 +1,11 @@
 package v1beta1
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
-	"hash/fnv"
+	"encoding/json"
+	"fmt"
 	"sort"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -10,6 +13,62 @@ import (
 	"k8s.io/utils/pointer"
 )
 
+const (
+	// RevisionConditionReady is true when the revision's dependencies
+	// are copied, its references exist, and its images can be pulled.
+	RevisionConditionReady = "Ready"
+	// RevisionConditionDependenciesCopied is true when every dependency
+	// copy the revision needs exists in its namespace.
+	RevisionConditionDependenciesCopied = "DependenciesCopied"
+	// RevisionConditionReferencesResolved is true when the Secrets,
+	// ConfigMaps, PersistentVolumeClaims and ServiceAccounts the pod
+	// template references exist.
+	RevisionConditionReferencesResolved = "ReferencesResolved"
+	// RevisionConditionImagesPullable is false when pods started from
+	// the revision fail to pull their images, and unknown when there
+	// aren't any pods.
+	RevisionConditionImagesPullable = "ImagesPullable"
+
+	// ReasonDependencyMissing means a dependency copy the revision
+	// needs doesn't exist.
+	ReasonDependencyMissing = "DependencyMissing"
+	// ReasonReferenceMissing means an object the pod template
+	// references doesn't exist.
+	ReasonReferenceMissing = "ReferenceMissing"
+	// ReasonImagePullFailed means a pod started from the revision
+	// couldn't pull its image.
+	ReasonImagePullFailed = "ImagePullFailed"
+	// ReasonImagePullBackOff means a pod started from the revision
+	// hasn't been able to pull an image for less than the grace period,
+	// so the revision is still ready.
+	ReasonImagePullBackOff = "ImagePullBackOff"
+	// ReasonNoPods means no pods have been started from the revision,
+	// so it isn't known if its images can be pulled.
+	ReasonNoPods = "NoPods"
+	// ReasonRevisionReady means every readiness check passed.
+	ReasonRevisionReady = "RevisionReady"
+	// ReasonRevisionNotReady means a readiness check failed. It's also
+	// used on workloads that can't start because their revision isn't
+	// ready.
+	ReasonRevisionNotReady = "RevisionNotReady"
+
+	// RevisionHashLength is the number of characters of a revision's
+	// Sum used in its name.
+	RevisionHashLength = 16
+)
+
+var (
+	// AnnotationKeyRevisionHash is the Sum of a revision, recorded when
+	// it's published. Revisions published before revisions were named
+	// by their Sum don't have it. It's also recorded on the pods started
+	// from a revision, so they can be compared to the elected revision.
+	AnnotationKeyRevisionHash = fmt.Sprintf("%s/revision-hash", GroupName)
+	// AnnotationKeyMigratedFrom is the name of the revision a revision
+	// replaced when it was migrated to be named by its Sum. Pods started
+	// before the migration are labelled with that name.
+	AnnotationKeyMigratedFrom = fmt.Sprintf("%s/migrated-from", GroupName)
+)
+
 // RevisionList is a list of revision resources
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type RevisionList struct {
@@ -56,6 +115,7 @@ func (in *RevisionList) Sort() {
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Elected",type=boolean,JSONPath=`.spec.elected`
 // +kubebuilder:printcolumn:name="Stopped",type=boolean,JSONPath=`.spec.stopped`
+// +kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type Revision struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -88,6 +148,11 @@ func (r *Revision) Less(other *Revision) bool {
 	return r.CreationTimestamp.Before(&other.CreationTimestamp)
 }
 
+// Ready returns true when workloads can be started from the revision.
+func (r *Revision) Ready() bool {
+	return r.Status.Ready
+}
+
 func (r *Revision) Elected() bool {
 	return r.Spec.Elected
 }
@@ -112,13 +177,53 @@ func (r *Revision) Stop() {
 	r.SetStopped(true)
 }
 
+// Sum returns a sha256 hash of the revision's canonicalised snapshot and
+// the identity of the template and options it was published from. The
+// snapshot is canonicalised so that formatting and key order don't change
+// the hash. Elected and Stopped aren't included, since they change over
+// the life of the revision.
 func (r *Revision) Sum() string {
-	hasher := fnv.New32()
-	hasher.Write(r.Spec.Data.Raw)
-	return hex.EncodeToString(hasher.Sum(nil))
+	options := append([]string{}, r.Spec.Options...)
+	sort.Strings(options)
+	var template *TemplateReference
+	if r.Spec.TemplateRef != nil {
+		template = &TemplateReference{
+			Name:      r.Spec.TemplateRef.Name,
+			Namespace: r.Spec.TemplateRef.Namespace,
+			Kind:      r.Spec.TemplateRef.TemplateKind(),
+		}
+	}
+	raw, _ := json.Marshal(struct {
+		Template *TemplateReference `json:"template,omitempty"`
+		Options  []string           `json:"options,omitempty"`
+		Snapshot json.RawMessage    `json:"snapshot"`
+	}{
+		Template: template,
+		Options:  options,
+		Snapshot: canonicalJSON(r.Spec.Data.Raw),
+	})
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
 }
 
-func (r *Revision) Hash() string { return r.Sum() }
+// Hash returns the prefix of Sum used to name the revision.
+func (r *Revision) Hash() string { return r.Sum()[:RevisionHashLength] }
+
+// canonicalJSON returns the JSON with its keys sorted and without
+// insignificant whitespace. Invalid JSON is returned as it is.
+func canonicalJSON(raw []byte) json.RawMessage {
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return raw
+	}
+	return out
+}
 
 type RevisionSpec struct {
 	// Elected is true is this is the current revision
@@ -133,8 +238,23 @@ type RevisionSpec struct {
 	// actual runtime workload.
 	// +kubebuilder:validation:Required
 	Data runtime.RawExtension `json:"snapshot"`
+	// TemplateRef is the template the revision was published from.
+	// +kubebuilder:validation:Optional
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+	// Options are the template options that were elected when the
+	// revision was published.
+	// +kubebuilder:validation:Optional
+	Options []string `json:"options,omitempty"`
 }
 
 type RevisionStatus struct {
+	// Ready is true when workloads can be started from the revision.
+	// Ready mirrors the Ready condition.
 	Ready bool `json:"ready"`
+	// Conditions describe whether the revision's dependencies, references
+	// and images are available.
+	// +listType=map
+	// +listMapKey=type
+	// +kubebuilder:validation:Optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
@@ -1,6 +1,8 @@
 package v1beta1
 
 import (
+	"path"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -9,15 +11,70 @@ import (
 const (
 	UpdatePolicyAuto   = "Auto"
 	UpdatePolicyIgnore = "Ignore"
+
+	ImagePolicyTag    = "Tag"
+	ImagePolicyDigest = "Digest"
+
+	KindTemplate          = "Template"
+	KindClusterTemplate   = "ClusterTemplate"
+	KindPodDefault        = "PodDefault"
+	KindClusterPodDefault = "ClusterPodDefault"
+
+	// DefaultContainerName is the name of the container that's targeted
+	// by workload overrides when the Template doesn't specify one.
+	DefaultContainerName = "main"
 )
 
 // TemplateReference is a reference to a specific template revision, or
 // the current revision if unspecified. ResourceVersion should be tracked
 // for repeatability.
 type TemplateReference struct {
-	Name            string `json:"name"`
-	Namespace       string `json:"namespace"`
+	Name string `json:"name"`
+	// Namespace is the namespace of the Template. Namespace is ignored
+	// when Kind is ClusterTemplate.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+	// ResourceVersion pins the workload to the TemplateRevision that was
+	// taken when the template had this resourceVersion.
+	// +kubebuilder:validation:Optional
 	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Revision pins the workload to the named TemplateRevision, or
+	// ClusterTemplateRevision. Revision takes precedence over
+	// ResourceVersion. If neither is set, the latest template is used.
+	// +kubebuilder:validation:Optional
+	Revision string `json:"revision,omitempty"`
+	// Kind is either Template or ClusterTemplate. If Kind is omitted,
+	// the reference is to a Template.
+	// +kubebuilder:validation:Enum=Template;ClusterTemplate
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// TemplateKind returns the kind of the referenced template.
+func (in *TemplateReference) TemplateKind() string {
+	if in.Kind == "" {
+		return KindTemplate
+	}
+	return in.Kind
+}
+
+// PodDefaultReference is a reference to a PodDefault in the same
+// namespace as the template, or to a ClusterPodDefault.
+type PodDefaultReference struct {
+	Name string `json:"name"`
+	// Kind is either PodDefault or ClusterPodDefault. If Kind is omitted,
+	// the reference is to a PodDefault.
+	// +kubebuilder:validation:Enum=PodDefault;ClusterPodDefault
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// PodDefaultKind returns the kind of the referenced PodDefault.
+func (in *PodDefaultReference) PodDefaultKind() string {
+	if in.Kind == "" {
+		return KindPodDefault
+	}
+	return in.Kind
 }
 
 // LocalObjectReference is a reference to an arbitrary object in the
@@ -26,6 +83,11 @@ type LocalObjectReference struct {
 	Name       string `json:"name"`
 	APIVersion string `json:"apiVersion"`
 	Kind       string `json:"kind"`
+	// As is the name of the object when it's copied to another
+	// namespace. If As is omitted, the copy has the same name. References
+	// to the object in the pod template are renamed to match.
+	// +kubebuilder:validation:Optional
+	As string `json:"as,omitempty"`
 }
 
 func (in *LocalObjectReference) GroupVersionKind() schema.GroupVersionKind {
@@ -40,9 +102,39 @@ type TemplateOption struct {
 	// A Description describes what the optional configuration is and what
 	// it does
 	Description string `json:"description"`
+	// Kind is either PodDefault or ClusterPodDefault. If Kind is omitted,
+	// the option is a PodDefault.
+	// +kubebuilder:validation:Enum=PodDefault;ClusterPodDefault
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+	// Group is the name of the OptionGroup the option belongs to.
+	// +kubebuilder:validation:Optional
+	Group string `json:"group,omitempty"`
+	// Requires are the names of other options that must be elected
+	// with this option.
+	// +kubebuilder:validation:Optional
+	Requires []string `json:"requires,omitempty"`
+	// Conflicts are the names of other options that can't be elected
+	// with this option.
+	// +kubebuilder:validation:Optional
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// PodDefaultRef returns a reference to the PodDefault the option applies.
+func (in *TemplateOption) PodDefaultRef() PodDefaultReference {
+	return PodDefaultReference{Name: in.Name, Kind: in.Kind}
 }
 
+// +kubebuilder:validation:XValidation:rule="!has(self.sunsetDate) || has(self.deprecated)",message="sunsetDate can only be set on a deprecated template"
 type TemplateSpec struct {
+	// Extends is a reference to another Template in the same namespace
+	// that this Template inherits from. A ClusterTemplate can only extend
+	// another ClusterTemplate. The parent's pod template, options,
+	// required PodDefaults and dependencies are used as the base, and
+	// this Template is merged on top of them.
+	// +kubebuilder:validation:Optional
+	Extends *corev1.LocalObjectReference `json:"extends,omitempty"`
+
 	// Dependencies are other resources, such as ConfigMaps, or Secrets
 	// that are required by the Template. If the Template is referenced
 	// in another namespace, the Dependencies will need to either be copied
@@ -52,10 +144,55 @@ type TemplateSpec struct {
 	// Options are configurations that can be added to the child workload,
 	// such as an alternate python package index.
 	Options []TemplateOption `json:"options,omitempty"`
+	// OptionGroups constrain which Options can be elected together.
+	OptionGroups []OptionGroup `json:"optionGroups,omitempty"`
+
+	// Parameters are typed inputs that workloads provide values for. The
+	// values are substituted into the pod template when a revision is
+	// published.
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
 
 	// Required are configurations that MUST be added to the child workload,
 	// such as an alternate python package index.
-	Required []corev1.LocalObjectReference `json:"required,omitempty"`
+	Required []PodDefaultReference `json:"required,omitempty"`
+
+	// ContainerName is the name of the container in the pod spec that
+	// workload overrides, such as a DagTask's command, are applied to.
+	// If it's empty, the extended template's is used, or main if none of
+	// the templates set it.
+	// +kubebuilder:validation:Optional
+	ContainerName string `json:"containerName,omitempty"`
+
+	// AllowedImages are the images that a workload may use in place of
+	// the container's image. Each item is a pattern as accepted by
+	// path.Match. If AllowedImages is empty, the image cannot be overridden.
+	AllowedImages []string `json:"allowedImages,omitempty"`
+
+	// ImagePolicy is either Tag, which runs images as they're referenced,
+	// or Digest, which pins every image to the digest its tag resolves to
+	// when a revision is published, so revisions don't change when a tag
+	// is pushed again.
+	// +kubebuilder:validation:Enum=Tag;Digest
+	// +kubebuilder:validation:Optional
+	ImagePolicy string `json:"imagePolicy,omitempty"`
+
+	// Resources bounds the resources workloads can request, and
+	// provides defaults and presets to choose from.
+	// +kubebuilder:validation:Optional
+	Resources *TemplateResources `json:"resources,omitempty"`
+
+	// Deprecated marks the template as deprecated. Workloads that reference
+	// a deprecated template are warned, and are migrated to the replacement
+	// after the SunsetDate. Deprecated isn't inherited by templates that
+	// extend this one.
+	// +kubebuilder:validation:Optional
+	Deprecated *TemplateDeprecation `json:"deprecated,omitempty"`
+	// SunsetDate is when a deprecated template is retired. After the
+	// SunsetDate, stopped workloads are migrated to the replacement
+	// template. Running workloads aren't changed until they're stopped.
+	// SunsetDate can only be set with Deprecated.
+	// +kubebuilder:validation:Optional
+	SunsetDate *metav1.Time `json:"sunsetDate,omitempty"`
 
 	// Template is a full pod spec which serves as the base for a
 	// realized notebook. The notebook can optionally override a subset
@@ -69,11 +206,26 @@ type TemplateSpec struct {
 // team to configure user's Pods before they are created rather
 // than after.
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
 type Template struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
 
-	Spec TemplateSpec `json:"spec"`
+	Spec   TemplateSpec   `json:"spec"`
+	Status TemplateStatus `json:"status,omitempty"`
+}
+
+type TemplateStatus struct {
+	// Revisions are the available TemplateRevisions of the template,
+	// newest first.
+	Revisions []TemplateVersion `json:"revisions,omitempty"`
+}
+
+// TemplateVersion is a TemplateRevision that workloads can pin to.
+type TemplateVersion struct {
+	Name            string      `json:"name"`
+	ResourceVersion string      `json:"resourceVersion,omitempty"`
+	CreatedAt       metav1.Time `json:"createdAt"`
 }
 
 func (in *Template) Dependencies() []LocalObjectReference {
@@ -84,10 +236,30 @@ func (in *Template) Options() []TemplateOption {
 	return in.Spec.Options
 }
 
-func (in *Template) Required() []corev1.LocalObjectReference {
+func (in *Template) Required() []PodDefaultReference {
 	return in.Spec.Required
 }
 
+// ContainerName returns the name of the container targeted by workload
+// overrides.
+func (in *Template) ContainerName() string {
+	if in.Spec.ContainerName == "" {
+		return DefaultContainerName
+	}
+	return in.Spec.ContainerName
+}
+
+// AllowsImage returns true if the image matches one of the
+// Template's AllowedImages.
+func (in *Template) AllowsImage(image string) bool {
+	for _, pattern := range in.Spec.AllowedImages {
+		if ok, _ := path.Match(pattern, image); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (in *Template) PodTemplateSpec() *PodTemplateSpec {
 	return &PodTemplateSpec{
 		ObjectMeta: ObjectMeta{
@@ -98,20 +270,107 @@ func (in *Template) PodTemplateSpec() *PodTemplateSpec {
 	}
 }
 
-func (in *Template) SetResourceRequests(req corev1.ResourceList) {
-	if len(in.Spec.Template.Spec.Containers) == 0 {
-		// nothing to do, there are no containers
-		return
+// Inherit merges the Template on top of its parent, so fields set on the
+// Template take precedence over those on the parent. The pod templates
+// are merged with a strategic merge patch, options, option groups and
+// parameters are merged by name, and required PodDefaults and dependencies
+// are combined. Resources are inherited as a whole when the Template
+// doesn't set them.
+func (in *Template) Inherit(parent *Template) error {
+	spec := parent.Spec.Template.DeepCopy()
+	if err := spec.StrategicMergeFrom(in.Spec.Template); err != nil {
+		return err
+	}
+	in.Spec.Template = *spec
+
+	options := append([]TemplateOption{}, parent.Spec.Options...)
+	for _, opt := range in.Spec.Options {
+		found := false
+		for k := range options {
+			if options[k].Name == opt.Name {
+				options[k] = opt
+				found = true
+			}
+		}
+		if !found {
+			options = append(options, opt)
+		}
+	}
+	in.Spec.Options = options
+
+	required := append([]PodDefaultReference{}, parent.Spec.Required...)
+	for _, req := range in.Spec.Required {
+		found := false
+		for _, item := range required {
+			found = found || item == req
+		}
+		if !found {
+			required = append(required, req)
+		}
+	}
+	in.Spec.Required = required
+
+	deps := append([]LocalObjectReference{}, parent.Spec.Dependencies...)
+	for _, dep := range in.Spec.Dependencies {
+		found := false
+		for _, item := range deps {
+			found = found || item == dep
+		}
+		if !found {
+			deps = append(deps, dep)
+		}
+	}
+	in.Spec.Dependencies = deps
+
+	groups := append([]OptionGroup{}, parent.Spec.OptionGroups...)
+	for _, group := range in.Spec.OptionGroups {
+		found := false
+		for k := range groups {
+			if groups[k].Name == group.Name {
+				groups[k] = group
+				found = true
+			}
+		}
+		if !found {
+			groups = append(groups, group)
+		}
+	}
+	in.Spec.OptionGroups = groups
+
+	params := append([]TemplateParameter{}, parent.Spec.Parameters...)
+	for _, param := range in.Spec.Parameters {
+		found := false
+		for k := range params {
+			if params[k].Name == param.Name {
+				params[k] = param
+				found = true
+			}
+		}
+		if !found {
+			params = append(params, param)
+		}
+	}
+	in.Spec.Parameters = params
+
+	if in.Spec.ContainerName == "" {
+		in.Spec.ContainerName = parent.Spec.ContainerName
 	}
-	container := &in.Spec.Template.Spec.Containers[0]
-	if container.Resources.Requests == nil {
-		container.Resources.Requests = req
-		return
+	if len(in.Spec.AllowedImages) == 0 {
+		in.Spec.AllowedImages = parent.Spec.AllowedImages
 	}
-	for k, v := range req {
-		container.Resources.Requests[k] = v
+	if in.Spec.Resources == nil {
+		in.Spec.Resources = parent.Spec.Resources
 	}
-	return
+	if in.Spec.ImagePolicy == "" {
+		in.Spec.ImagePolicy = parent.Spec.ImagePolicy
+	}
+	return nil
+}
+
+// SetResourceRequests sets the requests on the Template's target
+// container, with limits derived from ratio.
+func (in *Template) SetResourceRequests(req corev1.ResourceList, ratio float64) {
+	in.Spec.Template.SetResourceRequests(in.ContainerName(), req, ratio)
 }
 
 // TemplateList is a list of templates
@@ -0,0 +1,129 @@
+package v1beta1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	// LabelKeyTemplateName is the name of the template a TemplateRevision
+	// or ClusterTemplateRevision is a snapshot of.
+	LabelKeyTemplateName = fmt.Sprintf("%s/template-name", GroupName)
+)
+
+// TemplateRevisionList is a list of TemplateRevisions
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type TemplateRevisionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []TemplateRevision `json:"items"`
+}
+
+// TemplateRevision is an immutable snapshot of a Template's spec, with
+// everything it inherits from the Templates it extends. A TemplateRevision
+// is created whenever the spec changes, and workloads can pin to it.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:printcolumn:name="Template",type=string,JSONPath=`.metadata.labels.jackhoman\.dev/template-name`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type TemplateRevision struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec TemplateRevisionSpec `json:"spec"`
+}
+
+// ClusterTemplateRevisionList is a list of ClusterTemplateRevisions
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterTemplateRevisionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterTemplateRevision `json:"items"`
+}
+
+// ClusterTemplateRevision is a snapshot of a ClusterTemplate's spec.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Template",type=string,JSONPath=`.metadata.labels.jackhoman\.dev/template-name`
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ClusterTemplateRevision struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+
+	Spec TemplateRevisionSpec `json:"spec"`
+}
+
+// TemplateRevision returns the ClusterTemplateRevision as a
+// TemplateRevision without a namespace.
+func (in *ClusterTemplateRevision) TemplateRevision() *TemplateRevision {
+	return &TemplateRevision{
+		TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "ClusterTemplateRevision"},
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec:       *in.Spec.DeepCopy(),
+	}
+}
+
+type TemplateRevisionSpec struct {
+	// ResourceVersion is the resourceVersion of the template when the
+	// snapshot was taken.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// ResourceVersions are the other resourceVersions the template had
+	// while it rendered to the snapshot, such as after a change to its
+	// status or labels, so workloads pinned to any of them resolve to
+	// the snapshot.
+	// +kubebuilder:validation:Optional
+	ResourceVersions []string `json:"resourceVersions,omitempty"`
+	// Data is a snapshot of the template's spec
+	// +kubebuilder:validation:Required
+	Data runtime.RawExtension `json:"snapshot"`
+}
+
+// SetTemplateSpec sets the snapshot of the template's spec.
+func (in *TemplateRevisionSpec) SetTemplateSpec(spec TemplateSpec) error {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	in.Data.Raw = raw
+	return nil
+}
+
+// TemplateSpec returns the snapshot of the template's spec.
+func (in *TemplateRevisionSpec) TemplateSpec() (TemplateSpec, error) {
+	spec := TemplateSpec{}
+	return spec, json.Unmarshal(in.Data.Raw, &spec)
+}
+
+// HasResourceVersion returns true if the snapshot was taken when the
+// template had the resourceVersion.
+func (in *TemplateRevisionSpec) HasResourceVersion(resourceVersion string) bool {
+	if in.ResourceVersion == resourceVersion {
+		return true
+	}
+	for _, rv := range in.ResourceVersions {
+		if rv == resourceVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// Sum returns a sha256 hash of the canonicalised snapshot, so that
+// formatting and key order don't change the hash.
+func (in *TemplateRevisionSpec) Sum() string {
+	sum := sha256.Sum256(canonicalJSON(in.Data.Raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hash returns the prefix of Sum used to name the revision.
+func (in *TemplateRevisionSpec) Hash() string { return in.Sum()[:RevisionHashLength] }
+
+func (in *TemplateRevision) Less(other *TemplateRevision) bool {
+	return in.CreationTimestamp.Before(&other.CreationTimestamp)
+}
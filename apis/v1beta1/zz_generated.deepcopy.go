@@ -7,10 +7,207 @@ package v1beta1
 
 import (
 	batchv1 "k8s.io/api/batch/v1"
-	"k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPodDefault) DeepCopyInto(out *ClusterPodDefault) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodDefault.
+func (in *ClusterPodDefault) DeepCopy() *ClusterPodDefault {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPodDefault)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPodDefault) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPodDefaultList) DeepCopyInto(out *ClusterPodDefaultList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterPodDefault, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPodDefaultList.
+func (in *ClusterPodDefaultList) DeepCopy() *ClusterPodDefaultList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPodDefaultList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPodDefaultList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTemplate) DeepCopyInto(out *ClusterTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTemplate.
+func (in *ClusterTemplate) DeepCopy() *ClusterTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTemplateList) DeepCopyInto(out *ClusterTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTemplateList.
+func (in *ClusterTemplateList) DeepCopy() *ClusterTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTemplateRevision) DeepCopyInto(out *ClusterTemplateRevision) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTemplateRevision.
+func (in *ClusterTemplateRevision) DeepCopy() *ClusterTemplateRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTemplateRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterTemplateRevision) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTemplateRevisionList) DeepCopyInto(out *ClusterTemplateRevisionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterTemplateRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTemplateRevisionList.
+func (in *ClusterTemplateRevisionList) DeepCopy() *ClusterTemplateRevisionList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTemplateRevisionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterTemplateRevisionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterTemplateSpec) DeepCopyInto(out *ClusterTemplateSpec) {
+	*out = *in
+	in.TemplateSpec.DeepCopyInto(&out.TemplateSpec)
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterTemplateSpec.
+func (in *ClusterTemplateSpec) DeepCopy() *ClusterTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Dag) DeepCopyInto(out *Dag) {
 	*out = *in
@@ -95,14 +292,66 @@ func (in *DagSpec) DeepCopy() *DagSpec {
 func (in *DagTask) DeepCopyInto(out *DagTask) {
 	*out = *in
 	out.Template = in.Template
+	if in.DagRef != nil {
+		in, out := &in.DagRef, &out.DagRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	if in.Command != nil {
 		in, out := &in.Command, &out.Command
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]corev1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]corev1.Volume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]corev1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Options != nil {
 		in, out := &in.Options, &out.Options
-		*out = make([]v1.LocalObjectReference, len(*in))
+		*out = make([]corev1.LocalObjectReference, len(*in))
 		copy(*out, *in)
 	}
 	if in.Dependencies != nil {
@@ -112,7 +361,7 @@ func (in *DagTask) DeepCopyInto(out *DagTask) {
 	}
 	if in.Resources != nil {
 		in, out := &in.Resources, &out.Resources
-		*out = make(v1.ResourceList, len(*in))
+		*out = make(corev1.ResourceList, len(*in))
 		for key, val := range *in {
 			(*out)[key] = val.DeepCopy()
 		}
@@ -134,7 +383,7 @@ func (in *Execution) DeepCopyInto(out *Execution) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -188,10 +437,100 @@ func (in *ExecutionList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecutionQueue) DeepCopyInto(out *ExecutionQueue) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecutionQueue.
+func (in *ExecutionQueue) DeepCopy() *ExecutionQueue {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecutionQueue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExecutionQueue) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecutionQueueList) DeepCopyInto(out *ExecutionQueueList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ExecutionQueue, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecutionQueueList.
+func (in *ExecutionQueueList) DeepCopy() *ExecutionQueueList {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecutionQueueList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ExecutionQueueList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecutionQueueSpec) DeepCopyInto(out *ExecutionQueueSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecutionQueueSpec.
+func (in *ExecutionQueueSpec) DeepCopy() *ExecutionQueueSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecutionQueueSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExecutionSpec) DeepCopyInto(out *ExecutionSpec) {
 	*out = *in
 	out.DagRef = in.DagRef
+	if in.QueueRef != nil {
+		in, out := &in.QueueRef, &out.QueueRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int)
+		**out = **in
+	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecutionSpec.
@@ -291,23 +630,7 @@ func (in *Notebook) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NotebookCondition) DeepCopyInto(out *NotebookCondition) {
-	*out = *in
-	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
-}
-
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookCondition.
-func (in *NotebookCondition) DeepCopy() *NotebookCondition {
-	if in == nil {
-		return nil
-	}
-	out := new(NotebookCondition)
-	in.DeepCopyInto(out)
-	return out
-}
-
-// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *NotebookList) DeepCopyInto(out *NotebookList) {
+func (in *NotebookList) DeepCopyInto(out *NotebookList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
@@ -364,7 +687,7 @@ func (in *NotebookSpec) DeepCopyInto(out *NotebookSpec) {
 	}
 	if in.ResourceRequests != nil {
 		in, out := &in.ResourceRequests, &out.ResourceRequests
-		*out = make(v1.ResourceList, len(*in))
+		*out = make(corev1.ResourceList, len(*in))
 		for key, val := range *in {
 			(*out)[key] = val.DeepCopy()
 		}
@@ -376,6 +699,13 @@ func (in *NotebookSpec) DeepCopyInto(out *NotebookSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotebookSpec.
@@ -393,7 +723,7 @@ func (in *NotebookStatus) DeepCopyInto(out *NotebookStatus) {
 	*out = *in
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]v1.PodCondition, len(*in))
+		*out = make([]v1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -446,6 +776,21 @@ func (in *ObjectMeta) DeepCopy() *ObjectMeta {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OptionGroup) DeepCopyInto(out *OptionGroup) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OptionGroup.
+func (in *OptionGroup) DeepCopy() *OptionGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(OptionGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodDefault) DeepCopyInto(out *PodDefault) {
 	*out = *in
@@ -504,6 +849,36 @@ func (in *PodDefaultList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodDefaultProvenance) DeepCopyInto(out *PodDefaultProvenance) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodDefaultProvenance.
+func (in *PodDefaultProvenance) DeepCopy() *PodDefaultProvenance {
+	if in == nil {
+		return nil
+	}
+	out := new(PodDefaultProvenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodDefaultReference) DeepCopyInto(out *PodDefaultReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodDefaultReference.
+func (in *PodDefaultReference) DeepCopy() *PodDefaultReference {
+	if in == nil {
+		return nil
+	}
+	out := new(PodDefaultReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodDefaultSpec) DeepCopyInto(out *PodDefaultSpec) {
 	*out = *in
@@ -513,6 +888,11 @@ func (in *PodDefaultSpec) DeepCopyInto(out *PodDefaultSpec) {
 		*out = make([]LocalObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodDefaultSpec.
@@ -542,13 +922,82 @@ func (in *PodTemplateSpec) DeepCopy() *PodTemplateSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Provenance) DeepCopyInto(out *Provenance) {
+	*out = *in
+	out.Template = in.Template
+	if in.Ancestors != nil {
+		in, out := &in.Ancestors, &out.Ancestors
+		*out = make([]TemplateProvenance, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodDefaults != nil {
+		in, out := &in.PodDefaults, &out.PodDefaults
+		*out = make([]PodDefaultProvenance, len(*in))
+		copy(*out, *in)
+	}
+	if in.PatchHashes != nil {
+		in, out := &in.PatchHashes, &out.PatchHashes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.Referrer = in.Referrer
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Provenance.
+func (in *Provenance) DeepCopy() *Provenance {
+	if in == nil {
+		return nil
+	}
+	out := new(Provenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReferrerProvenance) DeepCopyInto(out *ReferrerProvenance) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReferrerProvenance.
+func (in *ReferrerProvenance) DeepCopy() *ReferrerProvenance {
+	if in == nil {
+		return nil
+	}
+	out := new(ReferrerProvenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourcePreset) DeepCopyInto(out *ResourcePreset) {
+	*out = *in
+	if in.Requests != nil {
+		in, out := &in.Requests, &out.Requests
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourcePreset.
+func (in *ResourcePreset) DeepCopy() *ResourcePreset {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourcePreset)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Revision) DeepCopyInto(out *Revision) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Revision.
@@ -605,6 +1054,16 @@ func (in *RevisionList) DeepCopyObject() runtime.Object {
 func (in *RevisionSpec) DeepCopyInto(out *RevisionSpec) {
 	*out = *in
 	in.Data.DeepCopyInto(&out.Data)
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateReference)
+		**out = **in
+	}
+	if in.Options != nil {
+		in, out := &in.Options, &out.Options
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevisionSpec.
@@ -620,6 +1079,13 @@ func (in *RevisionSpec) DeepCopy() *RevisionSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RevisionStatus) DeepCopyInto(out *RevisionStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevisionStatus.
@@ -638,6 +1104,7 @@ func (in *Template) DeepCopyInto(out *Template) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Template.
@@ -658,6 +1125,26 @@ func (in *Template) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateDeprecation) DeepCopyInto(out *TemplateDeprecation) {
+	*out = *in
+	if in.Replacement != nil {
+		in, out := &in.Replacement, &out.Replacement
+		*out = new(TemplateReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateDeprecation.
+func (in *TemplateDeprecation) DeepCopy() *TemplateDeprecation {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateDeprecation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TemplateList) DeepCopyInto(out *TemplateList) {
 	*out = *in
@@ -693,6 +1180,16 @@ func (in *TemplateList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TemplateOption) DeepCopyInto(out *TemplateOption) {
 	*out = *in
+	if in.Requires != nil {
+		in, out := &in.Requires, &out.Requires
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conflicts != nil {
+		in, out := &in.Conflicts, &out.Conflicts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateOption.
@@ -705,6 +1202,56 @@ func (in *TemplateOption) DeepCopy() *TemplateOption {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateParameter) DeepCopyInto(out *TemplateParameter) {
+	*out = *in
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(string)
+		**out = **in
+	}
+	if in.Enum != nil {
+		in, out := &in.Enum, &out.Enum
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Minimum != nil {
+		in, out := &in.Minimum, &out.Minimum
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Maximum != nil {
+		in, out := &in.Maximum, &out.Maximum
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateParameter.
+func (in *TemplateParameter) DeepCopy() *TemplateParameter {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateParameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateProvenance) DeepCopyInto(out *TemplateProvenance) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateProvenance.
+func (in *TemplateProvenance) DeepCopy() *TemplateProvenance {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateProvenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
 	*out = *in
@@ -720,9 +1267,136 @@ func (in *TemplateReference) DeepCopy() *TemplateReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateResources) DeepCopyInto(out *TemplateResources) {
+	*out = *in
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Defaults != nil {
+		in, out := &in.Defaults, &out.Defaults
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Presets != nil {
+		in, out := &in.Presets, &out.Presets
+		*out = make([]ResourcePreset, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateResources.
+func (in *TemplateResources) DeepCopy() *TemplateResources {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateRevision) DeepCopyInto(out *TemplateRevision) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateRevision.
+func (in *TemplateRevision) DeepCopy() *TemplateRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TemplateRevision) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateRevisionList) DeepCopyInto(out *TemplateRevisionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TemplateRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateRevisionList.
+func (in *TemplateRevisionList) DeepCopy() *TemplateRevisionList {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRevisionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TemplateRevisionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateRevisionSpec) DeepCopyInto(out *TemplateRevisionSpec) {
+	*out = *in
+	if in.ResourceVersions != nil {
+		in, out := &in.ResourceVersions, &out.ResourceVersions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Data.DeepCopyInto(&out.Data)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateRevisionSpec.
+func (in *TemplateRevisionSpec) DeepCopy() *TemplateRevisionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRevisionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TemplateSpec) DeepCopyInto(out *TemplateSpec) {
 	*out = *in
+	if in.Extends != nil {
+		in, out := &in.Extends, &out.Extends
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	if in.Dependencies != nil {
 		in, out := &in.Dependencies, &out.Dependencies
 		*out = make([]LocalObjectReference, len(*in))
@@ -731,13 +1405,46 @@ func (in *TemplateSpec) DeepCopyInto(out *TemplateSpec) {
 	if in.Options != nil {
 		in, out := &in.Options, &out.Options
 		*out = make([]TemplateOption, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.OptionGroups != nil {
+		in, out := &in.OptionGroups, &out.OptionGroups
+		*out = make([]OptionGroup, len(*in))
 		copy(*out, *in)
 	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make([]TemplateParameter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Required != nil {
 		in, out := &in.Required, &out.Required
-		*out = make([]v1.LocalObjectReference, len(*in))
+		*out = make([]PodDefaultReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.AllowedImages != nil {
+		in, out := &in.AllowedImages, &out.AllowedImages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(TemplateResources)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Deprecated != nil {
+		in, out := &in.Deprecated, &out.Deprecated
+		*out = new(TemplateDeprecation)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SunsetDate != nil {
+		in, out := &in.SunsetDate, &out.SunsetDate
+		*out = (*in).DeepCopy()
+	}
 	in.Template.DeepCopyInto(&out.Template)
 }
 
@@ -750,3 +1457,41 @@ func (in *TemplateSpec) DeepCopy() *TemplateSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateStatus) DeepCopyInto(out *TemplateStatus) {
+	*out = *in
+	if in.Revisions != nil {
+		in, out := &in.Revisions, &out.Revisions
+		*out = make([]TemplateVersion, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateStatus.
+func (in *TemplateStatus) DeepCopy() *TemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateVersion) DeepCopyInto(out *TemplateVersion) {
+	*out = *in
+	in.CreatedAt.DeepCopyInto(&out.CreatedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateVersion.
+func (in *TemplateVersion) DeepCopy() *TemplateVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateVersion)
+	in.DeepCopyInto(out)
+	return out
+}
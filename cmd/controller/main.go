@@ -1,8 +1,11 @@
 package main
 
 import (
+	"time"
+
 	"github.com/alecthomas/kong"
 	"go.uber.org/zap/zapcore"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -10,11 +13,32 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
 
 	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/controller/dependency"
 	"github.com/johnhoman/notebook-controller/controller/execution"
+	"github.com/johnhoman/notebook-controller/controller/gc"
 	"github.com/johnhoman/notebook-controller/controller/notebook"
+	"github.com/johnhoman/notebook-controller/controller/revision"
+	"github.com/johnhoman/notebook-controller/controller/template"
+	"github.com/johnhoman/notebook-controller/internal/image"
+	"github.com/johnhoman/notebook-controller/internal/logs"
 )
 
-var CommandLineArgs struct{}
+var CommandLineArgs struct {
+	Namespace      string  `help:"Namespace the controller runs in. Templates in this namespace can be used from any namespace." env:"POD_NAMESPACE"`
+	EnableWebhooks bool    `help:"Serve the validating admission webhooks."`
+	LimitRatio     float64 `help:"Ratio of cpu and memory limits to requests. Limits aren't set when the ratio is 0." default:"0"`
+	LogSink        string  `help:"Where to store the logs of finished tasks." enum:"none,configmap,file" default:"configmap"`
+	LogDir         string  `help:"Directory task logs are written to when --log-sink=file." default:"/var/log/executions" type:"path"`
+	LogLimitBytes  int     `help:"Number of bytes kept from the end of each task's logs." default:"262144"`
+
+	ImageDigestTTL time.Duration `help:"How long image digests resolved for templates with the Digest image policy are cached." default:"5m"`
+
+	MaintenanceWindow string `help:"Daily window, as HH:MM-HH:MM in UTC, in which notebook pods out of date with their revision are restarted. Pods aren't restarted when it's empty."`
+
+	GCInterval time.Duration `help:"How often orphaned revisions and dependency copies are removed." default:"10m"`
+	GCMinAge   time.Duration `help:"How old a revision has to be before it's removed." default:"10m"`
+	GCDryRun   bool          `help:"Log the revisions and dependency copies that would be removed instead of removing them."`
+}
 
 func main() {
 	setupLog := zap.New(zap.UseDevMode(true)).WithName("startup")
@@ -32,8 +56,52 @@ func main() {
 
 	cmd.FatalIfErrorf(err, "failed to create controller manager")
 
-	cmd.FatalIfErrorf(notebook.Setup(mgr), "failed to setup notebook controller")
-	cmd.FatalIfErrorf(execution.Setup(mgr), "failed to setup execution controller")
+	cmd.FatalIfErrorf(template.Setup(mgr), "failed to setup template controller")
+	cmd.FatalIfErrorf(dependency.Setup(mgr, dependency.DefaultKinds), "failed to setup dependency controller")
+	cmd.FatalIfErrorf(revision.Setup(mgr), "failed to setup revision controller")
+	// The resolver is shared so both controllers use the same digests.
+	images := image.NewCachingResolver(image.NewRegistryResolver(nil), CommandLineArgs.ImageDigestTTL)
+	notebookOpts := []notebook.Option{
+		notebook.WithNamespace(CommandLineArgs.Namespace),
+		notebook.WithLimitRatio(CommandLineArgs.LimitRatio),
+		notebook.WithImageResolver(images),
+	}
+	if CommandLineArgs.MaintenanceWindow != "" {
+		window, err := notebook.ParseMaintenanceWindow(CommandLineArgs.MaintenanceWindow)
+		cmd.FatalIfErrorf(err, "failed to parse maintenance window")
+		notebookOpts = append(notebookOpts, notebook.WithMaintenanceWindow(window))
+	}
+	cmd.FatalIfErrorf(notebook.Setup(mgr, notebookOpts...), "failed to setup notebook controller")
+	executionOpts := []execution.Option{
+		execution.WithNamespace(CommandLineArgs.Namespace),
+		execution.WithLimitRatio(CommandLineArgs.LimitRatio),
+		execution.WithImageResolver(images),
+	}
+	if CommandLineArgs.LogSink != "none" {
+		cs, err := kubernetes.NewForConfig(mgr.GetConfig())
+		cmd.FatalIfErrorf(err, "failed to create kubernetes clientset")
+
+		collector := &logs.Collector{
+			Source:     logs.NewClientsetSource(cs),
+			Sink:       logs.NewConfigMapSink(mgr.GetClient()),
+			LimitBytes: CommandLineArgs.LogLimitBytes,
+		}
+		if CommandLineArgs.LogSink == "file" {
+			collector.Sink = logs.NewFileSink(CommandLineArgs.LogDir)
+		}
+		executionOpts = append(executionOpts, execution.WithLogCollector(collector))
+	}
+
+	cmd.FatalIfErrorf(execution.Setup(mgr, executionOpts...), "failed to setup execution controller")
+	cmd.FatalIfErrorf(gc.Setup(mgr,
+		gc.WithInterval(CommandLineArgs.GCInterval),
+		gc.WithMinAge(CommandLineArgs.GCMinAge),
+		gc.WithDryRun(CommandLineArgs.GCDryRun),
+	), "failed to setup garbage collector")
+	if CommandLineArgs.EnableWebhooks {
+		cmd.FatalIfErrorf(notebook.SetupWebhook(mgr), "failed to setup notebook webhook")
+		cmd.FatalIfErrorf(execution.SetupWebhook(mgr), "failed to setup dag webhook")
+	}
 	setupLog.Info("finished setting up notebook controller")
 	setupLog.Info("starting manager")
 	cmd.FatalIfErrorf(err, mgr.Start(signals.SetupSignalHandler()), "failed to start controller manager")
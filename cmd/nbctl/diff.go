@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+type DiffCmd struct {
+	Name            string  `arg:"" help:"Name of the Notebook."`
+	From            string  `help:"Revision to diff from. Defaults to the revision published before --to, or the elected revision with --template."`
+	To              string  `help:"Revision to diff to. Defaults to the elected revision."`
+	Template        bool    `help:"Diff against the revision the Notebook's template would publish now."`
+	SystemNamespace string  `help:"Namespace the controller runs in, used to render ClusterTemplates with --template." env:"POD_NAMESPACE"`
+	LimitRatio      float64 `help:"Ratio of limits to requests the controller uses, used with --template." default:"0"`
+	Output          string  `short:"o" help:"Output format." enum:"summary,patch,json" default:"summary"`
+}
+
+func (d *DiffCmd) Run(c *Context) error {
+	ctx := context.Background()
+	k8s, err := c.Client()
+	if err != nil {
+		return err
+	}
+
+	revList := &v1beta1.RevisionList{}
+	err = k8s.List(ctx, revList, client.InNamespace(c.Namespace), client.MatchingLabelsSelector{Selector: revision.Selector(d.Name, "")})
+	if err != nil {
+		return err
+	}
+	revList.Sort()
+
+	find := func(name string) (int, error) {
+		for k := 0; k < revList.Len(); k++ {
+			rev := revList.Revision(k)
+			if rev.Name == name || name == "" && rev.Elected() {
+				return k, nil
+			}
+		}
+		if name == "" {
+			return -1, fmt.Errorf("notebook %q doesn't have an elected revision", d.Name)
+		}
+		return -1, fmt.Errorf("revision %q not found", name)
+	}
+
+	var diff *revision.Diff
+	if d.Template {
+		from, err := find(d.From)
+		if err != nil {
+			return err
+		}
+		nb := &v1beta1.Notebook{}
+		if err := k8s.Get(ctx, types.NamespacedName{Name: d.Name, Namespace: c.Namespace}, nb); err != nil {
+			return err
+		}
+		pub := revision.NewPublisher(k8s,
+			revision.WithNamespace(d.SystemNamespace),
+			revision.WithLimitRatio(d.LimitRatio),
+		)
+		if diff, err = pub.Diff(ctx, nb, revList.Revision(from)); err != nil {
+			return err
+		}
+	} else {
+		to, err := find(d.To)
+		if err != nil {
+			return err
+		}
+		from := to - 1
+		if d.From != "" {
+			if from, err = find(d.From); err != nil {
+				return err
+			}
+		}
+		if from < 0 {
+			return fmt.Errorf("revision %q is the first revision", revList.Revision(to).Name)
+		}
+		if diff, err = revision.DiffRevisions(revList.Revision(from), revList.Revision(to)); err != nil {
+			return err
+		}
+	}
+
+	switch d.Output {
+	case "patch":
+		fmt.Println(string(diff.Patch))
+	case "json":
+		out, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	default:
+		for _, change := range diff.Changes {
+			fmt.Println(change.String())
+		}
+		if diff.Empty() {
+			fmt.Println(diff.Summary())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/graph"
+)
+
+type GraphCmd struct {
+	Name      string `arg:"" optional:"" help:"Name of the Dag in the cluster."`
+	File      string `short:"f" help:"Read the Dag from a YAML file instead of the cluster." type:"existingfile"`
+	Execution string `short:"e" help:"Colour tasks by their status in the named Execution."`
+	Format    string `help:"Output format." enum:"dot,mermaid" default:"dot"`
+}
+
+func (g *GraphCmd) Run(c *Context) error {
+	ctx := context.Background()
+
+	if (g.Name == "") == (g.File == "") {
+		return fmt.Errorf("exactly one of a Dag name or --file is required")
+	}
+
+	dag := &v1beta1.Dag{}
+	var execution *v1beta1.Execution
+	if g.File != "" {
+		raw, err := os.ReadFile(g.File)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(raw, dag); err != nil {
+			return err
+		}
+	}
+
+	if g.Name != "" || g.Execution != "" {
+		k8s, err := c.Client()
+		if err != nil {
+			return err
+		}
+		if g.Name != "" {
+			if err := k8s.Get(ctx, types.NamespacedName{Name: g.Name, Namespace: c.Namespace}, dag); err != nil {
+				return err
+			}
+		}
+		if g.Execution != "" {
+			execution = &v1beta1.Execution{}
+			if err := k8s.Get(ctx, types.NamespacedName{Name: g.Execution, Namespace: c.Namespace}, execution); err != nil {
+				return err
+			}
+		}
+	}
+
+	out, err := graph.Render(g.Format, dag, execution)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
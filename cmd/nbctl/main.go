@@ -0,0 +1,44 @@
+// Command nbctl is a command line client for the notebook controller's
+// resources.
+package main
+
+import (
+	"github.com/alecthomas/kong"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+var CommandLineArgs struct {
+	Namespace string `short:"n" help:"Namespace of the resources." default:"default"`
+
+	Graph GraphCmd `cmd:"" help:"Render a Dag as a Graphviz DOT or Mermaid graph."`
+	Diff  DiffCmd  `cmd:"" help:"Show how two revisions of a Notebook differ."`
+}
+
+// Context is passed to the Run method of every command.
+type Context struct {
+	Namespace string
+	// Client returns a client for the cluster in the current
+	// kubeconfig context.
+	Client func() (client.Client, error)
+}
+
+func main() {
+	cmd := kong.Parse(&CommandLineArgs)
+	cmd.FatalIfErrorf(v1beta1.AddToScheme(scheme.Scheme), "failed to add scheme")
+
+	err := cmd.Run(&Context{
+		Namespace: CommandLineArgs.Namespace,
+		Client: func() (client.Client, error) {
+			cfg, err := config.GetConfig()
+			if err != nil {
+				return nil, err
+			}
+			return client.New(cfg, client.Options{Scheme: scheme.Scheme})
+		},
+	})
+	cmd.FatalIfErrorf(err)
+}
@@ -0,0 +1,110 @@
+package dependency
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/internal/dependency"
+)
+
+var (
+	_ reconcile.Reconciler = &Reconciler{}
+
+	// DefaultKinds are the kinds of dependencies that are kept in sync
+	// with their sources.
+	DefaultKinds = []schema.GroupVersionKind{
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		corev1.SchemeGroupVersion.WithKind("Secret"),
+	}
+)
+
+// Setup adds a dependency controller to manager.Manager for each of the
+// kinds. Any options provided are applied after the defaults.
+func Setup(mgr manager.Manager, kinds []schema.GroupVersionKind, opts ...Option) error {
+	for _, gvk := range kinds {
+		r := NewReconciler(mgr.GetClient(), gvk, append([]Option{
+			WithLogger(mgr.GetLogger().WithName("dependency-controller").WithValues("kind", gvk.Kind)),
+		}, opts...)...)
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		err := builder.ControllerManagedBy(mgr).
+			Named("dependency-" + strings.ToLower(gvk.Kind)).
+			For(obj).
+			Complete(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Option func(r *Reconciler)
+
+func WithLogger(logger logr.Logger) Option {
+	return func(r *Reconciler) {
+		r.logger = logger
+	}
+}
+
+// NewReconciler returns a Reconciler for dependencies of the kind.
+func NewReconciler(c client.Client, gvk schema.GroupVersionKind, opts ...Option) *Reconciler {
+	r := &Reconciler{
+		client:     c,
+		gvk:        gvk,
+		logger:     logr.New(nil),
+		propagator: dependency.NewPropagator(c),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Reconciler keeps the copies of dependencies in sync with their source.
+type Reconciler struct {
+	client     client.Client
+	gvk        schema.GroupVersionKind
+	logger     logr.Logger
+	propagator *dependency.Propagator
+}
+
+// Reconcile syncs the copies of an object. When the object is a copy, its
+// source is synced instead, so changes to a copy are reverted.
+func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.gvk)
+	if err := r.client.Get(ctx, req.NamespacedName, obj); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if obj.GetLabels()[dependency.LabelKeyManaged] == "true" {
+		ns, name, ok := strings.Cut(obj.GetAnnotations()[dependency.AnnotationKeySource], "/")
+		if !ok {
+			r.logger.Info("dependency copy doesn't have a source", "namespace", obj.GetNamespace(), "name", obj.GetName())
+			return reconcile.Result{}, nil
+		}
+		source := &unstructured.Unstructured{}
+		source.SetGroupVersionKind(r.gvk)
+		if err := r.client.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, source); err != nil {
+			return reconcile.Result{}, client.IgnoreNotFound(err)
+		}
+		obj = source
+	}
+
+	if err := r.propagator.Sync(ctx, obj); err != nil {
+		r.logger.Error(err, "failed to sync dependency copies", "namespace", obj.GetNamespace(), "name", obj.GetName())
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,127 @@
+package execution
+
+import (
+	"context"
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+// admit returns true if the Execution can start running. Executions
+// that don't reference an ExecutionQueue, or that have already started,
+// are always admitted. Otherwise, the Execution is admitted if it's
+// among the highest priority queued Executions that fit in the free
+// slots of the queue.
+func (r *Reconciler) admit(ctx context.Context, execution *v1beta1.Execution) (bool, error) {
+	if !execution.Queued() || execution.Spec.QueueRef == nil {
+		return true, nil
+	}
+
+	logger := r.logger.WithValues("execution", execution.Name, "namespace", execution.Namespace)
+
+	queue := &v1beta1.ExecutionQueue{}
+	queue.SetName(execution.Spec.QueueRef.Name)
+	queue.SetNamespace(execution.Namespace)
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(queue), queue); err != nil {
+		if apierrors.IsNotFound(err) {
+			// hold the execution until the queue exists
+			logger.Info("execution queue not found", "queue", queue.Name)
+			return false, nil
+		}
+		return false, err
+	}
+
+	executionList := &v1beta1.ExecutionList{}
+	if err := r.client.List(ctx, executionList, client.InNamespace(execution.Namespace)); err != nil {
+		return false, err
+	}
+
+	running := 0
+	waiting := make([]v1beta1.Execution, 0)
+	for _, item := range executionList.Items {
+		if item.Spec.QueueRef == nil || item.Spec.QueueRef.Name != queue.Name {
+			continue
+		}
+		if item.Status.Completed {
+			continue
+		}
+		if item.Queued() {
+			waiting = append(waiting, item)
+			continue
+		}
+		running++
+	}
+
+	slots := queue.MaxConcurrentExecutions() - running
+	if slots <= 0 {
+		return false, nil
+	}
+
+	sort.SliceStable(waiting, func(i, j int) bool {
+		if waiting[i].Priority() != waiting[j].Priority() {
+			return waiting[i].Priority() > waiting[j].Priority()
+		}
+		if !waiting[i].CreationTimestamp.Equal(&waiting[j].CreationTimestamp) {
+			return waiting[i].CreationTimestamp.Before(&waiting[j].CreationTimestamp)
+		}
+		return waiting[i].Name < waiting[j].Name
+	})
+	for k := 0; k < slots && k < len(waiting); k++ {
+		if waiting[k].Name == execution.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// EnqueueRequestsForQueue enqueues the Executions waiting in an
+// ExecutionQueue when the queue changes, or when an Execution that
+// references the queue changes, so the slot of a completed Execution is
+// filled without waiting for the next poll.
+func EnqueueRequestsForQueue(c client.Reader) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var name string
+		switch o := obj.(type) {
+		case *v1beta1.ExecutionQueue:
+			name = o.Name
+		case *v1beta1.Execution:
+			if o.Spec.QueueRef == nil {
+				return nil
+			}
+			name = o.Spec.QueueRef.Name
+		default:
+			return nil
+		}
+		requests, err := queuedExecutions(ctx, c, obj.GetNamespace(), name)
+		if err != nil {
+			return nil
+		}
+		return requests
+	})
+}
+
+// queuedExecutions returns requests for the Executions waiting in the
+// named ExecutionQueue.
+func queuedExecutions(ctx context.Context, c client.Reader, namespace, queue string) ([]reconcile.Request, error) {
+	executionList := &v1beta1.ExecutionList{}
+	if err := c.List(ctx, executionList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, item := range executionList.Items {
+		if item.Spec.QueueRef == nil || item.Spec.QueueRef.Name != queue {
+			continue
+		}
+		if item.Status.Completed || !item.Queued() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name}})
+	}
+	return requests, nil
+}
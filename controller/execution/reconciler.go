@@ -3,48 +3,94 @@ package execution
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply"
+	"github.com/johnhoman/notebook-controller/internal/image"
+	"github.com/johnhoman/notebook-controller/internal/logs"
 	"github.com/johnhoman/notebook-controller/internal/revision"
 )
 
-func Setup(mgr manager.Manager) error {
+// Setup adds the Execution controller to manager.Manager. Any options
+// provided are applied after the defaults.
+func Setup(mgr manager.Manager, opts ...Option) error {
+	pods, err := NewTaskPodCache(mgr)
+	if err != nil {
+		return err
+	}
+	if err := mgr.Add(pods); err != nil {
+		return err
+	}
 
-	r := NewReconciler(mgr.GetClient(),
+	r := NewReconciler(mgr.GetClient(), append([]Option{
 		WithLogger(mgr.GetLogger().WithName("workflow-controller")),
 		WithScheme(mgr.GetScheme()),
-	)
+		WithPodReader(pods),
+		WithEventRecorder(mgr.GetEventRecorderFor("execution-controller")),
+	}, opts...)...)
 
+	enqueue := EnqueueRequestsForQueue(mgr.GetClient())
 	return builder.ControllerManagedBy(mgr).
 		For(&v1beta1.Execution{}).
 		Owns(&batchv1.Job{}).
+		Owns(&v1beta1.Execution{}).
+		Watches(&v1beta1.ExecutionQueue{}, enqueue).
+		Watches(&v1beta1.Execution{}, enqueue).
 		Complete(r)
 }
 
+// NewTaskPodCache returns a cache that only holds the pods of tasks, so
+// collecting logs doesn't need an informer for every pod in the cluster.
+func NewTaskPodCache(mgr manager.Manager) (cache.Cache, error) {
+	selector, err := labels.Parse(logs.LabelKeyExecution)
+	if err != nil {
+		return nil, err
+	}
+	return cache.New(mgr.GetConfig(), cache.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Pod{}: {Label: selector},
+		},
+	})
+}
+
 func NewReconciler(client client.Client, opts ...Option) *Reconciler {
 	r := &Reconciler{
-		client: client,
-		scheme: client.Scheme(),
-		logger: logr.New(nil),
+		client:     client,
+		scheme:     client.Scheme(),
+		logger:     logr.New(nil),
+		limitRatio: revision.DefaultLimitRatio,
 	}
 
 	for _, f := range opts {
 		f(r)
 	}
+	if r.pods == nil {
+		r.pods = r.client
+	}
 	return r
 }
 
@@ -62,10 +108,68 @@ func WithScheme(s *runtime.Scheme) Option {
 	}
 }
 
+// WithLogCollector sets the collector used to store the logs of finished
+// tasks. If the collector isn't provided, logs aren't collected.
+func WithLogCollector(c *logs.Collector) Option {
+	return func(r *Reconciler) {
+		r.logs = c
+	}
+}
+
+// WithPodReader sets the reader the pods of finished tasks are listed
+// with to collect their logs. If the reader isn't provided, the client is
+// used.
+func WithPodReader(reader client.Reader) Option {
+	return func(r *Reconciler) {
+		r.pods = reader
+	}
+}
+
+// WithLimitRatio sets the ratio of cpu and memory limits to requests
+// on published revisions. If the ratio is zero, limits aren't set.
+func WithLimitRatio(ratio float64) Option {
+	return func(r *Reconciler) {
+		r.limitRatio = ratio
+	}
+}
+
+// WithNamespace sets the namespace the controller is running in. PodDefaults
+// and dependencies of ClusterTemplates are read from this namespace.
+func WithNamespace(namespace string) Option {
+	return func(r *Reconciler) {
+		r.namespace = namespace
+	}
+}
+
+// WithEventRecorder sets the recorder for Events about Executions. If
+// the recorder isn't provided, Events aren't recorded.
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(r *Reconciler) {
+		r.recorder = recorder
+	}
+}
+
+// WithImageResolver sets the Resolver used to pin images to digests for
+// templates with the Digest image policy. If the resolver isn't provided,
+// registries are queried directly, and digests are cached for
+// image.DefaultCacheTTL.
+func WithImageResolver(resolver image.Resolver) Option {
+	return func(r *Reconciler) {
+		r.images = resolver
+	}
+}
+
 type Reconciler struct {
-	client client.Client
-	scheme *runtime.Scheme
-	logger logr.Logger
+	client   client.Client
+	scheme   *runtime.Scheme
+	logger   logr.Logger
+	logs     *logs.Collector
+	pods     client.Reader
+	recorder record.EventRecorder
+	images   image.Resolver
+
+	namespace  string
+	limitRatio float64
 }
 
 func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
@@ -80,6 +184,31 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 
 	logger := r.logger.WithValues("execution", execution.Name, "namespace", execution.Namespace)
 
+	admitted, err := r.admit(ctx, execution)
+	if err != nil {
+		logger.Error(err, "failed to admit execution")
+		return reconcile.Result{}, err
+	}
+	if !admitted {
+		// Queued executions are enqueued again when their queue changes
+		// or another execution in it completes.
+		if execution.Status.Phase == v1beta1.ExecutionPhaseQueued {
+			return reconcile.Result{}, nil
+		}
+		execution.Status.Phase = v1beta1.ExecutionPhaseQueued
+		return reconcile.Result{}, r.client.Status().Update(ctx, execution)
+	}
+	if execution.Queued() {
+		// The admission is persisted before any tasks start, so the
+		// execution keeps its slot in the queue if starting them fails.
+		execution.Status.Phase = v1beta1.ExecutionPhaseRunning
+		if err := r.client.Status().Update(ctx, execution); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	execution.Status.Phase = v1beta1.ExecutionPhaseRunning
+	previous := execution.Status.Tasks
 	execution.Status.Tasks = make(map[string]v1beta1.ExecutionTaskStatus)
 
 	dag := &v1beta1.Dag{}
@@ -90,89 +219,103 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		return reconcile.Result{}, err
 	}
 
+	err = v1beta1.ValidateDagRecursion(dag, func(name string) (*v1beta1.Dag, error) {
+		child := &v1beta1.Dag{}
+		return child, r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: execution.Namespace}, child)
+	})
+	if err != nil {
+		if apierrors.IsNotFound(errors.Cause(err)) {
+			logger.Error(err, "failed to get sub-Dag for execution")
+			return reconcile.Result{}, err
+		}
+		logger.Error(err, "Dag cannot be executed")
+		execution.Status.Phase = v1beta1.ExecutionPhaseFailed
+		execution.Status.Completed = true
+		execution.Status.Succeeded = false
+		return reconcile.Result{}, r.updateStatus(ctx, execution, event{
+			corev1.EventTypeWarning, v1beta1.ReasonExecutionFailed, fmt.Sprintf("dag %s can't be executed: %s", dag.Name, err),
+		})
+	}
+
 	tasks := dag.TaskMap()
 	completed := sets.New[string]()
+	// events are recorded once the status they report is updated.
+	events := make([]event, 0)
+	// visited are tasks that have either been started or are waiting
+	// on a dependency that's been started, so they aren't pushed
+	// again until the next reconcile.
+	visited := sets.New[string]()
 
 	stack := NewStack(execution.MaxConcurrentTasks())
 	stack.Push(dag.Entrypoint())
 	for !stack.Empty() {
 		current := stack.Pop()
+		if visited.Has(current.Name) {
+			continue
+		}
 		// check if all dependencies are complete, if they are then
 		// create a task for the current node. If not, push the
 		// current node onto the stack and then all the dependencies
 		// onto the stack.
 
 		if !completed.HasAll(current.Dependencies...) {
-			stack.Push(current)
+			pending := make([]v1beta1.DagTask, 0, len(current.Dependencies))
 			for _, dep := range current.Dependencies {
-				if !completed.Has(dep) {
-					stack.Push(tasks[dep])
+				if !completed.Has(dep) && !visited.Has(dep) {
+					pending = append(pending, tasks[dep])
 				}
 			}
+			if len(pending) == 0 {
+				// all the remaining dependencies are in progress
+				visited.Insert(current.Name)
+				continue
+			}
+			stack.Push(current)
+			for _, dep := range pending {
+				stack.Push(dep)
+			}
 			continue
 		}
+		visited.Insert(current.Name)
 
 		// if current is completed or has no dependencies
 		// create a task for it
-		task := &batchv1.Job{}
-		task.SetName(execution.Name + "-" + current.Name)
-		task.SetNamespace(execution.Namespace)
-
-		// if the current task isn't completed, increment the inProgress counter
-		// so, we can control the number of concurrent tasks
-		if err := r.client.Get(ctx, client.ObjectKeyFromObject(task), task); err != nil {
-			if !apierrors.IsNotFound(err) {
-				return reconcile.Result{}, err
-			}
-
-			patches := []v1beta1.PodTemplateSpec{RestartPatch()}
-
-			if len(current.Command) > 0 {
-				patches = append(patches, CommandPatch(current.Command...))
-			}
-
-			// create the task
-			pub := revision.NewPublisher(r.client, revision.WithLogger(r.logger), revision.WithPatches(patches...))
-			rev, err := pub.Create(ctx, NamespacedTask{
-				Namespace: execution.Namespace,
-				DagTask:   &current,
-			})
-			if err != nil {
-				return reconcile.Result{}, err
-			}
-			// maybe switch this to an init container and run a small sidecar to manage
-			// inputs and outputs
-			spec := corev1.PodTemplateSpec{}
-			if err := json.Unmarshal(rev.GetData(), &spec); err != nil {
-				logger.Error(err, "failed to unmarshal pod template spec from revision")
-				return reconcile.Result{}, errors.Wrap(err, "failed to unmarshal pod template spec")
-			}
-
-			task.OwnerReferences = append(task.OwnerReferences, execution.AsOwner())
-			task.Spec = batchv1.JobSpec{
-				Template:     spec,
-				BackoffLimit: pointer.Int32(0),
-				Completions:  pointer.Int32(1),
+		var status v1beta1.ExecutionTaskStatus
+		var err error
+		if current.IsDag() {
+			status, err = r.runDag(ctx, execution, current, previous[current.Name])
+		} else {
+			status, err = r.runJob(ctx, execution, dag, current)
+		}
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if !current.IsDag() && status.Completed && status.Message == "" {
+			status.Logs, status.LogsError = previous[current.Name].Logs, previous[current.Name].LogsError
+			if status.Logs == "" && status.LogsError == "" {
+				status.Logs, status.LogsError = r.collectLogs(ctx, execution, current)
 			}
+		}
+		execution.SetTaskStatus(current.Name, status)
 
-			if err := r.client.Create(ctx, task); err != nil {
-				return reconcile.Result{}, err
+		if status.Completed && !previous[current.Name].Completed {
+			if status.Succeeded {
+				events = append(events, event{corev1.EventTypeNormal, v1beta1.ReasonTaskSucceeded, fmt.Sprintf("task %s succeeded", current.Name)})
+			} else {
+				events = append(events, event{corev1.EventTypeWarning, v1beta1.ReasonTaskFailed, taskFailedMessage(current.Name, status)})
 			}
 		}
-		execution.SetTaskStatus(current.Name, v1beta1.ExecutionTaskStatus{
-			Conditions: task.Status.Conditions,
-			Completed:  !task.Status.CompletionTime.IsZero(),
-			Succeeded:  task.Status.Succeeded > 0,
-		})
 
-		if !task.Status.CompletionTime.IsZero() {
+		if status.Completed {
 			completed.Insert(current.Name)
 		}
 
-		if task.Status.Failed > 0 {
+		if status.Completed && !status.Succeeded {
+			events = append(events, event{corev1.EventTypeWarning, v1beta1.ReasonExecutionFailed, fmt.Sprintf("task %s failed", current.Name)})
+			execution.Status.Phase = v1beta1.ExecutionPhaseFailed
 			execution.Status.Completed = true
 			execution.Status.Succeeded = false
-			return reconcile.Result{}, r.client.Status().Update(ctx, execution)
+			return reconcile.Result{}, r.updateStatus(ctx, execution, events...)
 		}
 	}
 
@@ -184,9 +327,302 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	}
 
 	if !execution.Status.Completed {
-		return reconcile.Result{RequeueAfter: time.Second * 10}, r.client.Status().Update(ctx, execution)
+		return reconcile.Result{RequeueAfter: time.Second * 10}, r.updateStatus(ctx, execution, events...)
+	}
+	execution.Status.Phase = v1beta1.ExecutionPhaseSucceeded
+	if !execution.Status.Succeeded {
+		execution.Status.Phase = v1beta1.ExecutionPhaseFailed
+		events = append(events, event{corev1.EventTypeWarning, v1beta1.ReasonExecutionFailed, "the execution failed"})
+	} else {
+		events = append(events, event{corev1.EventTypeNormal, v1beta1.ReasonExecutionSucceeded, "all tasks succeeded"})
+	}
+	return reconcile.Result{}, r.updateStatus(ctx, execution, events...)
+}
+
+// An event is an Event about an Execution.
+type event struct {
+	eventType, reason, message string
+}
+
+// updateStatus updates the Execution's status, then records the events.
+// The events aren't recorded if the update fails, since the next
+// reconcile records them again.
+func (r *Reconciler) updateStatus(ctx context.Context, execution *v1beta1.Execution, events ...event) error {
+	if err := r.client.Status().Update(ctx, execution); err != nil {
+		return err
+	}
+	for _, e := range events {
+		r.event(execution, e.eventType, e.reason, e.message)
+	}
+	return nil
+}
+
+func (r *Reconciler) event(obj runtime.Object, eventType, reason, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(obj, eventType, reason, message)
+	}
+}
+
+// taskFailedMessage returns the message of the Event recorded when a task
+// fails, including why if it's known.
+func taskFailedMessage(name string, status v1beta1.ExecutionTaskStatus) string {
+	if status.Message != "" {
+		return fmt.Sprintf("task %s failed: %s", name, status.Message)
+	}
+	return fmt.Sprintf("task %s failed", name)
+}
+
+// runJob creates the Job for a Template task if it doesn't exist yet and
+// returns the task status derived from the Job.
+func (r *Reconciler) runJob(ctx context.Context, execution *v1beta1.Execution, dag *v1beta1.Dag, current v1beta1.DagTask) (v1beta1.ExecutionTaskStatus, error) {
+	logger := r.logger.WithValues("execution", execution.Name, "namespace", execution.Namespace, "task", current.Name)
+
+	task := &batchv1.Job{}
+	task.SetName(execution.Name + "-" + current.Name)
+	task.SetNamespace(execution.Namespace)
+
+	// if the current task isn't completed, increment the inProgress counter
+	// so, we can control the number of concurrent tasks
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(task), task); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return v1beta1.ExecutionTaskStatus{}, err
+		}
+
+		referrer := NamespacedTask{
+			Namespace:  execution.Namespace,
+			Dag:        dag.Name,
+			Labels:     execution.Labels,
+			DagTask:    &current,
+			Generation: dag.Generation,
+		}
+		template, err := revision.ResolveReferrerTemplate(ctx, r.client, referrer)
+		if err != nil {
+			logger.Error(err, "failed to get Template for task")
+			if apierrors.IsNotFound(err) {
+				r.event(execution, corev1.EventTypeWarning, v1beta1.ReasonTemplateNotFound,
+					fmt.Sprintf("template %q of task %s not found", referrer.TemplateRef().Name, current.Name))
+			}
+			return v1beta1.ExecutionTaskStatus{}, err
+		}
+		current.Parameters = inheritParameters(template, execution, current)
+		if current.Image != "" && !template.AllowsImage(current.Image) {
+			return v1beta1.ExecutionTaskStatus{
+				Completed: true,
+				Message:   fmt.Sprintf("image %q is not allowed by template %q", current.Image, template.Name),
+			}, nil
+		}
+
+		if _, err := template.ResolveParameters(current.Parameters); err != nil {
+			return v1beta1.ExecutionTaskStatus{Completed: true, Message: err.Error()}, nil
+		}
+		options := make([]string, 0, len(current.Options))
+		for _, opt := range current.Options {
+			options = append(options, opt.Name)
+		}
+		if err := template.ValidateOptions(options); err != nil {
+			r.event(execution, corev1.EventTypeWarning, v1beta1.ReasonInvalidOptions, fmt.Sprintf("task %s: %s", current.Name, err))
+			return v1beta1.ExecutionTaskStatus{Completed: true, Message: err.Error()}, nil
+		}
+		if _, err := template.ResolveResources(current.Preset, current.Resources); err != nil {
+			return v1beta1.ExecutionTaskStatus{Completed: true, Message: err.Error()}, nil
+		}
+
+		patches := []v1beta1.PodTemplateSpec{RestartPatch(), TaskPatch(template.ContainerName(), &current)}
+
+		// create the task
+		opts := []revision.Option{
+			revision.WithLogger(r.logger),
+			revision.WithNamespace(r.namespace),
+			revision.WithLimitRatio(r.limitRatio),
+			revision.WithPatches(patches...),
+		}
+		if r.images != nil {
+			opts = append(opts, revision.WithImageResolver(r.images))
+		}
+		pub := revision.NewPublisher(r.client, opts...)
+		if _, err := pub.Migrate(ctx, referrer); err != nil {
+			return v1beta1.ExecutionTaskStatus{}, err
+		}
+		rev, err := pub.Create(ctx, referrer)
+		if _, ok := revision.IsInvalid(err); ok {
+			return v1beta1.ExecutionTaskStatus{Completed: true, Message: err.Error()}, nil
+		}
+		if err != nil {
+			return v1beta1.ExecutionTaskStatus{}, err
+		}
+		// maybe switch this to an init container and run a small sidecar to manage
+		// inputs and outputs
+		spec := corev1.PodTemplateSpec{}
+		if err := json.Unmarshal(rev.GetData(), &spec); err != nil {
+			logger.Error(err, "failed to unmarshal pod template spec from revision")
+			return v1beta1.ExecutionTaskStatus{}, errors.Wrap(err, "failed to unmarshal pod template spec")
+		}
+
+		if spec.Labels == nil {
+			spec.Labels = make(map[string]string)
+		}
+		spec.Labels[revision.LabelKeyRevision] = rev.GetName()
+		spec.Labels[logs.LabelKeyExecution] = execution.Name
+
+		task.OwnerReferences = append(task.OwnerReferences, execution.AsOwner())
+		task.Spec = batchv1.JobSpec{
+			Template:     spec,
+			BackoffLimit: pointer.Int32(0),
+			Completions:  pointer.Int32(1),
+		}
+
+		if err := apply.Apply(ctx, r.client, task); err != nil {
+			return v1beta1.ExecutionTaskStatus{}, err
+		}
+		r.event(execution, corev1.EventTypeNormal, v1beta1.ReasonTaskStarted, fmt.Sprintf("started task %s as job %s", current.Name, task.Name))
+	}
+	return v1beta1.ExecutionTaskStatus{
+		Conditions: task.Status.Conditions,
+		Completed:  !task.Status.CompletionTime.IsZero() || task.Status.Failed > 0,
+		Succeeded:  task.Status.Succeeded > 0,
+	}, nil
+}
+
+// collectLogs stores the logs of a finished task's pod and returns a
+// reference to them, or why they couldn't be collected. Failures aren't
+// returned, so a pod that's already been removed doesn't hold up the
+// execution.
+func (r *Reconciler) collectLogs(ctx context.Context, execution *v1beta1.Execution, current v1beta1.DagTask) (string, string) {
+	if r.logs == nil {
+		return "", ""
+	}
+	logger := r.logger.WithValues("execution", execution.Name, "namespace", execution.Namespace, "task", current.Name)
+
+	podList := &corev1.PodList{}
+	err := r.pods.List(ctx, podList,
+		client.InNamespace(execution.Namespace),
+		client.MatchingLabels{
+			logs.LabelKeyExecution: execution.Name,
+			"job-name":             execution.Name + "-" + current.Name,
+		},
+	)
+	if err != nil {
+		logger.Error(err, "failed to list task pods")
+		return "", fmt.Sprintf("unable to list the task's pods: %s", err)
+	}
+	if len(podList.Items) == 0 {
+		logger.Info("no pods found for task, logs will not be collected")
+		return "", "the task's pod was removed before its logs were collected"
+	}
+
+	container := v1beta1.DefaultContainerName
+	referrer := NamespacedTask{DagTask: &current, Namespace: execution.Namespace, Dag: execution.Spec.DagRef.Name}
+	if template, err := revision.ResolveReferrerTemplate(ctx, r.client, referrer); err == nil {
+		container = template.ContainerName()
+	}
+
+	ref, err := r.logs.Collect(ctx, execution, current.Name, podList.Items[0].Name, container)
+	if err != nil {
+		logger.Error(err, "failed to collect task logs")
+		return "", fmt.Sprintf("unable to collect the task's logs: %s", err)
 	}
-	return reconcile.Result{}, r.client.Status().Update(ctx, execution)
+	return ref, ""
+}
+
+// runDag creates a child Execution for a sub-Dag task if it doesn't exist
+// yet and returns the task status derived from the child Execution. The
+// child Execution is owned by the parent, so it's removed with it.
+func (r *Reconciler) runDag(ctx context.Context, execution *v1beta1.Execution, current v1beta1.DagTask, previous v1beta1.ExecutionTaskStatus) (v1beta1.ExecutionTaskStatus, error) {
+	child := &v1beta1.Execution{}
+	child.SetName(execution.Name + "-" + current.Name)
+	child.SetNamespace(execution.Namespace)
+
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(child), child); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return v1beta1.ExecutionTaskStatus{}, err
+		}
+		child.OwnerReferences = append(child.OwnerReferences, execution.AsOwner())
+		child.Spec = v1beta1.ExecutionSpec{
+			DagRef:      *current.DagRef,
+			Parallelism: execution.Spec.Parallelism,
+			Parameters:  mergeParameters(execution.Spec.Parameters, current.Parameters),
+		}
+		if err := r.client.Create(ctx, child); err != nil {
+			return v1beta1.ExecutionTaskStatus{}, err
+		}
+		r.event(execution, corev1.EventTypeNormal, v1beta1.ReasonTaskStarted, fmt.Sprintf("started task %s as execution %s", current.Name, child.Name))
+	}
+	return childTaskStatus(child, previous), nil
+}
+
+// childTaskStatus returns the status of a sub-Dag task from its child
+// Execution. A failed task explains which of the child's tasks failed.
+// The transition time of the previous status's condition is kept.
+func childTaskStatus(child *v1beta1.Execution, previous v1beta1.ExecutionTaskStatus) v1beta1.ExecutionTaskStatus {
+	status := v1beta1.ExecutionTaskStatus{
+		Completed: child.Status.Completed,
+		Succeeded: child.Status.Succeeded,
+	}
+	if !child.Status.Completed {
+		return status
+	}
+	condition := batchv1.JobCondition{
+		Type:               batchv1.JobComplete,
+		Status:             corev1.ConditionTrue,
+		Reason:             v1beta1.ReasonExecutionSucceeded,
+		Message:            fmt.Sprintf("execution %s succeeded", child.Name),
+		LastTransitionTime: metav1.Now(),
+	}
+	if !child.Status.Succeeded {
+		status.Message = fmt.Sprintf("execution %s failed", child.Name)
+		names := make([]string, 0, len(child.Status.Tasks))
+		for name := range child.Status.Tasks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			task := child.Status.Tasks[name]
+			if !task.Completed || task.Succeeded {
+				continue
+			}
+			status.Message = fmt.Sprintf("task %s of execution %s failed", name, child.Name)
+			if task.Message != "" {
+				status.Message += ": " + task.Message
+			}
+			break
+		}
+		condition.Type = batchv1.JobFailed
+		condition.Reason = v1beta1.ReasonExecutionFailed
+		condition.Message = status.Message
+	}
+	if len(previous.Conditions) > 0 && previous.Conditions[0].Type == condition.Type {
+		condition.LastTransitionTime = previous.Conditions[0].LastTransitionTime
+	}
+	status.Conditions = []batchv1.JobCondition{condition}
+	return status
+}
+
+// mergeParameters returns the parameters with the overrides applied.
+func mergeParameters(parameters, overrides map[string]string) map[string]string {
+	if len(parameters) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(parameters)+len(overrides))
+	for k, v := range parameters {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// inheritParameters returns the values of the task's parameters, with the
+// Execution's values for any parameters the Template declares that the
+// task doesn't set.
+func inheritParameters(template *v1beta1.Template, execution *v1beta1.Execution, task v1beta1.DagTask) map[string]string {
+	inherited := make(map[string]string)
+	for _, param := range template.Spec.Parameters {
+		if value, ok := execution.Spec.Parameters[param.Name]; ok {
+			inherited[param.Name] = value
+		}
+	}
+	return mergeParameters(inherited, task.Parameters)
 }
 
 func NewStack(maxSize int) *Stack {
@@ -219,15 +655,36 @@ func (s *Stack) Empty() bool {
 	return len(s.tasks) == 0
 }
 
+var _ revision.TaskReferrer = NamespacedTask{}
+
+// NamespacedTask is a DagTask in the namespace of its Execution. Tasks
+// have the labels of their Execution.
 type NamespacedTask struct {
 	*v1beta1.DagTask
 	Namespace string
+	// Dag is the name of the Dag the task is in.
+	Dag    string
+	Labels map[string]string
+	// Generation is the generation of the Dag the task is in.
+	Generation int64
 }
 
 func (task NamespacedTask) GetNamespace() string {
 	return task.Namespace
 }
 
+func (task NamespacedTask) DagName() string {
+	return task.Dag
+}
+
+func (task NamespacedTask) GetLabels() map[string]string {
+	return task.Labels
+}
+
+func (task NamespacedTask) GetGeneration() int64 {
+	return task.Generation
+}
+
 func RestartPatch() v1beta1.PodTemplateSpec {
 	return v1beta1.PodTemplateSpec{
 		Spec: corev1.PodSpec{
@@ -236,13 +693,34 @@ func RestartPatch() v1beta1.PodTemplateSpec {
 	}
 }
 
+// CommandPatch returns a patch that sets the command of the default
+// container. Use TaskPatch to target the container a Template configures.
 func CommandPatch(command ...string) v1beta1.PodTemplateSpec {
-	return v1beta1.PodTemplateSpec{
+	return TaskPatch(v1beta1.DefaultContainerName, &v1beta1.DagTask{Command: command})
+}
+
+// TaskPatch returns a patch that applies the pod overrides of a DagTask to
+// the named container of a Template's pod spec. Fields that aren't set on
+// the task are left as they are in the Template.
+func TaskPatch(container string, task *v1beta1.DagTask) v1beta1.PodTemplateSpec {
+	patch := v1beta1.PodTemplateSpec{
 		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{{
-				Name:    "main",
-				Command: command,
-			}},
+			Volumes:      task.Volumes,
+			NodeSelector: task.NodeSelector,
 		},
 	}
+	c := corev1.Container{
+		Name:         container,
+		Image:        task.Image,
+		Command:      task.Command,
+		Args:         task.Args,
+		WorkingDir:   task.WorkingDir,
+		EnvFrom:      task.EnvFrom,
+		Env:          task.Env,
+		VolumeMounts: task.VolumeMounts,
+	}
+	if !equality.Semantic.DeepEqual(c, corev1.Container{Name: container}) {
+		patch.Spec.Containers = []corev1.Container{c}
+	}
+	return patch
 }
@@ -2,22 +2,31 @@ package execution
 
 import (
 	"context"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	qt "github.com/frankban/quicktest"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/logs"
+	"github.com/johnhoman/notebook-controller/internal/revision"
 )
 
 func TestReconciler_Reconcile(t *testing.T) {
@@ -47,6 +56,7 @@ func TestReconciler_Reconcile(t *testing.T) {
 		WithScheme(scheme.Scheme).
 		WithObjects(dag, template, execution).
 		WithStatusSubresource(execution).
+		WithInterceptorFuncs(applytest.Funcs()).
 		Build()
 
 	ctx := context.Background()
@@ -76,10 +86,20 @@ func TestReconciler_Reconcile(t *testing.T) {
 
 		tmpl := template.DeepCopy()
 		tmpl.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+		// the task's pods are labeled with the revision they're started from
+		revList := &v1beta1.RevisionList{}
+		qt.Assert(t, k8s.List(ctx, revList, client.InNamespace("test")), qt.IsNil)
+		qt.Assert(t, revList.Items, qt.HasLen, 1)
 		want.Spec = batchv1.JobSpec{
 			BackoffLimit: pointer.Int32(0),
 			Completions:  pointer.Int32(1),
 			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						revision.LabelKeyRevision: revList.Items[0].Name,
+						logs.LabelKeyExecution:    "execution1",
+					},
+				},
 				Spec: tmpl.Spec.Template.Spec,
 			},
 		}
@@ -87,6 +107,686 @@ func TestReconciler_Reconcile(t *testing.T) {
 		qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(want), got), qt.IsNil)
 		qt.Assert(t, got, compareEquals, want)
 	})
+	t.Run("ForeignFieldsSurvive", func(t *testing.T) {
+		job := &batchv1.Job{}
+		qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "execution1-task1", Namespace: "test"}, job), qt.IsNil)
+		job.SetLabels(map[string]string{"kueue.x-k8s.io/queue-name": "ml"})
+		job.SetAnnotations(map[string]string{"injected": "true"})
+		qt.Assert(t, k8s.Update(ctx, job), qt.IsNil)
+
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(job), job), qt.IsNil)
+		qt.Assert(t, job.Labels["kueue.x-k8s.io/queue-name"], qt.Equals, "ml")
+		qt.Assert(t, job.Annotations["injected"], qt.Equals, "true")
+	})
+}
+
+func TestReconciler_Reconcile_SubDag(t *testing.T) {
+	child := newDag("child", "test", v1beta1.DagTask{
+		Name:     "task1",
+		Template: v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+	})
+	parent := newDag("parent", "test", v1beta1.DagTask{
+		Name:       "preprocess",
+		DagRef:     &corev1.LocalObjectReference{Name: "child"},
+		Parameters: map[string]string{"dataset": "s3://bucket/data"},
+	})
+	template := newTemplate("template1", "test", v1beta1.PodTemplateSpec{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "python", Args: []string{"$(params.dataset)"}}}},
+	})
+	template.Spec.Parameters = []v1beta1.TemplateParameter{{Name: "dataset"}}
+	execution := &v1beta1.Execution{
+		ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+		Spec: v1beta1.ExecutionSpec{
+			DagRef:      corev1.LocalObjectReference{Name: "parent"},
+			Parallelism: 5,
+			Parameters:  map[string]string{"dataset": "s3://bucket/default", "epochs": "10"},
+		},
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(child, parent, template, execution).
+		WithStatusSubresource(&v1beta1.Execution{}, &batchv1.Job{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "execution1", Namespace: "test"}}
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	got := &v1beta1.Execution{}
+	key := types.NamespacedName{Name: "execution1-preprocess", Namespace: "test"}
+	t.Run("ChildExecutionIsCreated", func(t *testing.T) {
+		qt.Assert(t, k8s.Get(ctx, key, got), qt.IsNil)
+		qt.Assert(t, got.Spec.DagRef.Name, qt.Equals, "child")
+		qt.Assert(t, got.Spec.Parallelism, qt.Equals, 5)
+		qt.Assert(t, got.OwnerReferences, qt.HasLen, 1)
+		qt.Assert(t, got.OwnerReferences[0].Name, qt.Equals, "execution1")
+	})
+	t.Run("ParametersArePropagated", func(t *testing.T) {
+		qt.Assert(t, got.Spec.Parameters, qt.DeepEquals, map[string]string{"dataset": "s3://bucket/data", "epochs": "10"})
+
+		// the child's task is only given the parameters its template declares
+		_, err := NewReconciler(k8s).Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		qt.Assert(t, err, qt.IsNil)
+		job := &batchv1.Job{}
+		qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "execution1-preprocess-task1", Namespace: "test"}, job), qt.IsNil)
+		qt.Assert(t, job.Spec.Template.Spec.Containers[0].Args, qt.DeepEquals, []string{"s3://bucket/data"})
+	})
+	t.Run("ChildFailureFailsParent", func(t *testing.T) {
+		qt.Assert(t, k8s.Get(ctx, key, got), qt.IsNil)
+		got.Status.Completed = true
+		got.Status.Succeeded = false
+		got.Status.Tasks = map[string]v1beta1.ExecutionTaskStatus{
+			"task1": {Completed: true, Message: "image \"ubuntu\" is not allowed"},
+		}
+		qt.Assert(t, k8s.Status().Update(ctx, got), qt.IsNil)
+
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+
+		parent := &v1beta1.Execution{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, parent), qt.IsNil)
+		qt.Assert(t, parent.Status.Completed, qt.IsTrue)
+		qt.Assert(t, parent.Status.Succeeded, qt.IsFalse)
+		task := parent.Status.Tasks["preprocess"]
+		qt.Assert(t, task.Completed, qt.IsTrue)
+		qt.Assert(t, task.Message, qt.Equals, `task task1 of execution execution1-preprocess failed: image "ubuntu" is not allowed`)
+		qt.Assert(t, task.Conditions, qt.HasLen, 1)
+		qt.Assert(t, task.Conditions[0].Type, qt.Equals, batchv1.JobFailed)
+		qt.Assert(t, task.Conditions[0].Message, qt.Equals, task.Message)
+	})
+}
+
+func TestReconciler_Reconcile_RecursiveDag(t *testing.T) {
+	a := newDag("a", "test", v1beta1.DagTask{Name: "b", DagRef: &corev1.LocalObjectReference{Name: "b"}})
+	b := newDag("b", "test", v1beta1.DagTask{Name: "a", DagRef: &corev1.LocalObjectReference{Name: "a"}})
+	execution := &v1beta1.Execution{
+		ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+		Spec:       v1beta1.ExecutionSpec{DagRef: corev1.LocalObjectReference{Name: "a"}},
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(a, b, execution).
+		WithStatusSubresource(execution).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "execution1", Namespace: "test"}}
+	_, err := NewReconciler(k8s).Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	got := &v1beta1.Execution{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, got), qt.IsNil)
+	qt.Assert(t, got.Status.Completed, qt.IsTrue)
+	qt.Assert(t, got.Status.Succeeded, qt.IsFalse)
+
+	children := &v1beta1.ExecutionList{}
+	qt.Assert(t, k8s.List(ctx, children), qt.IsNil)
+	qt.Assert(t, children.Items, qt.HasLen, 1)
+}
+
+func TestReconciler_Reconcile_TaskOverrides(t *testing.T) {
+	template := newTemplate("template1", "test", v1beta1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:  "notebook",
+				Image: "jupyter-scipy:v1.7.0",
+				Env:   []corev1.EnvVar{{Name: "A", Value: "1"}},
+			}},
+		},
+	})
+	template.Spec.ContainerName = "notebook"
+	template.Spec.AllowedImages = []string{"jupyter-*"}
+
+	dag := newDag("dag1", "test", v1beta1.DagTask{
+		Name:         "task2",
+		Template:     v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+		Image:        "ubuntu:latest",
+		Dependencies: []string{"task1"},
+	}, v1beta1.DagTask{
+		Name:       "task1",
+		Template:   v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+		Image:      "jupyter-pytorch:v1.7.0",
+		Args:       []string{"--verbose"},
+		Env:        []corev1.EnvVar{{Name: "B", Value: "2"}},
+		WorkingDir: "/work",
+	})
+	execution := &v1beta1.Execution{
+		ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+		Spec:       v1beta1.ExecutionSpec{DagRef: corev1.LocalObjectReference{Name: "dag1"}},
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(dag, template, execution).
+		WithStatusSubresource(execution, &batchv1.Job{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "execution1", Namespace: "test"}}
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	job := &batchv1.Job{}
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "execution1-task1", Namespace: "test"}, job), qt.IsNil)
+	t.Run("OverridesAreApplied", func(t *testing.T) {
+		want := corev1.Container{
+			Name:       "notebook",
+			Image:      "jupyter-pytorch:v1.7.0",
+			Args:       []string{"--verbose"},
+			WorkingDir: "/work",
+			Env:        []corev1.EnvVar{{Name: "B", Value: "2"}, {Name: "A", Value: "1"}},
+		}
+		qt.Assert(t, job.Spec.Template.Spec.Containers, compareEquals, []corev1.Container{want})
+	})
+	t.Run("DisallowedImageFailsTask", func(t *testing.T) {
+		job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+		job.Status.Succeeded = 1
+		qt.Assert(t, k8s.Status().Update(ctx, job), qt.IsNil)
+
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+
+		got := &v1beta1.Execution{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, got), qt.IsNil)
+		qt.Assert(t, got.Status.Phase, qt.Equals, v1beta1.ExecutionPhaseFailed)
+		qt.Assert(t, got.Status.Tasks["task2"].Message, qt.Contains, "ubuntu:latest")
+	})
+}
+
+func TestReconciler_Reconcile_RunningDependencies(t *testing.T) {
+	template := v1beta1.TemplateReference{Name: "template1", Namespace: "test"}
+	// report depends on two tasks, one of which depends on the other, so
+	// both are pushed while they're still running
+	dag := newDag("dag1", "test",
+		v1beta1.DagTask{Name: "report", Template: template, Dependencies: []string{"train", "prepare"}},
+		v1beta1.DagTask{Name: "train", Template: template, Dependencies: []string{"prepare"}},
+		v1beta1.DagTask{Name: "prepare", Template: template},
+	)
+	execution := &v1beta1.Execution{
+		ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+		Spec:       v1beta1.ExecutionSpec{DagRef: corev1.LocalObjectReference{Name: "dag1"}},
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(dag, newTemplate("template1", "test", v1beta1.PodTemplateSpec{}), execution).
+		WithStatusSubresource(execution, &batchv1.Job{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(execution)}
+	reconcileWithin := func(t *testing.T) {
+		t.Helper()
+		done := make(chan error, 1)
+		go func() {
+			_, err := r.Reconcile(ctx, req)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			qt.Assert(t, err, qt.IsNil)
+		case <-time.After(5 * time.Second):
+			t.Fatal("reconcile didn't return while dependencies are running")
+		}
+	}
+	jobExists := func(name string) bool {
+		t.Helper()
+		err := k8s.Get(ctx, types.NamespacedName{Name: "execution1-" + name, Namespace: "test"}, &batchv1.Job{})
+		qt.Assert(t, client.IgnoreNotFound(err), qt.IsNil)
+		return err == nil
+	}
+
+	reconcileWithin(t)
+	reconcileWithin(t)
+	qt.Assert(t, jobExists("prepare"), qt.IsTrue)
+	qt.Assert(t, jobExists("train"), qt.IsFalse)
+	qt.Assert(t, jobExists("report"), qt.IsFalse)
+
+	job := &batchv1.Job{}
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "execution1-prepare", Namespace: "test"}, job), qt.IsNil)
+	job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	job.Status.Succeeded = 1
+	qt.Assert(t, k8s.Status().Update(ctx, job), qt.IsNil)
+	reconcileWithin(t)
+	reconcileWithin(t)
+	qt.Assert(t, jobExists("train"), qt.IsTrue)
+	qt.Assert(t, jobExists("report"), qt.IsFalse)
+}
+
+func TestReconciler_Reconcile_PodDefaultContainer(t *testing.T) {
+	template := newTemplate("template1", "test", v1beta1.PodTemplateSpec{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+	})
+	template.Spec.ContainerName = "trainer"
+	template.Spec.Required = []v1beta1.PodDefaultReference{{Name: "trainer"}}
+	pd := &v1beta1.PodDefault{
+		ObjectMeta: metav1.ObjectMeta{Name: "trainer", Namespace: "test"},
+		Spec: v1beta1.PodDefaultSpec{Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "trainer", Image: "trainer:v1"}}},
+		}},
+	}
+	newExecution := func(name string) *v1beta1.Execution {
+		return &v1beta1.Execution{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+			Spec:       v1beta1.ExecutionSpec{DagRef: corev1.LocalObjectReference{Name: name}},
+		}
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			template, pd,
+			newDag("pd", "test", v1beta1.DagTask{
+				Name:     "task1",
+				Template: v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+				Args:     []string{"--epochs=10"},
+			}),
+			newDag("missing", "test", v1beta1.DagTask{
+				Name:     "task1",
+				Template: v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+				Args:     []string{"--epochs=10"},
+			}),
+			newExecution("pd"), newExecution("missing"),
+		).
+		WithStatusSubresource(&v1beta1.Execution{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	t.Run("ContainerFromPodDefault", func(t *testing.T) {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "pd", Namespace: "test"}})
+		qt.Assert(t, err, qt.IsNil)
+		job := &batchv1.Job{}
+		qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "pd-task1", Namespace: "test"}, job), qt.IsNil)
+		containers := make(map[string]corev1.Container)
+		for _, c := range job.Spec.Template.Spec.Containers {
+			containers[c.Name] = c
+		}
+		qt.Assert(t, containers, qt.HasLen, 2)
+		qt.Assert(t, containers["trainer"].Image, qt.Equals, "trainer:v1")
+		qt.Assert(t, containers["trainer"].Args, qt.DeepEquals, []string{"--epochs=10"})
+		qt.Assert(t, containers["main"].Args, qt.HasLen, 0)
+	})
+	t.Run("ContainerNotFound", func(t *testing.T) {
+		// the PodDefault no longer adds the container
+		qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(pd), pd), qt.IsNil)
+		pd.Spec.Template.Spec.Containers[0].Name = "sidecar"
+		qt.Assert(t, k8s.Update(ctx, pd), qt.IsNil)
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "missing", Namespace: "test"}}
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		got := &v1beta1.Execution{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, got), qt.IsNil)
+		qt.Assert(t, got.Status.Phase, qt.Equals, v1beta1.ExecutionPhaseFailed)
+		qt.Assert(t, got.Status.Tasks["task1"].Message, qt.Equals, revision.ErrPatchedContainerNotFound+": trainer")
+	})
+}
+
+func TestCommandPatch(t *testing.T) {
+	want := v1beta1.PodTemplateSpec{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:    v1beta1.DefaultContainerName,
+			Command: []string{"python", "train.py"},
+		}}},
+	}
+	qt.Assert(t, CommandPatch("python", "train.py"), qt.DeepEquals, want)
+}
+
+type fakeLogSource struct {
+	logs map[string]string
+}
+
+func (f fakeLogSource) Stream(_ context.Context, namespace, pod, container string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(f.logs[namespace+"/"+pod+"/"+container])), nil
+}
+
+func TestReconciler_Reconcile_CollectLogs(t *testing.T) {
+	dag := newDag("dag1", "test", v1beta1.DagTask{
+		Name:     "task1",
+		Template: v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+	})
+	template := newTemplate("template1", "test", v1beta1.PodTemplateSpec{})
+	execution := &v1beta1.Execution{
+		ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+		Spec:       v1beta1.ExecutionSpec{DagRef: corev1.LocalObjectReference{Name: "dag1"}},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "execution1-task1-abcde",
+		Namespace: "test",
+		Labels:    map[string]string{"job-name": "execution1-task1", logs.LabelKeyExecution: "execution1"},
+	}}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(dag, template, execution, pod).
+		WithStatusSubresource(execution, &batchv1.Job{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s, WithLogCollector(&logs.Collector{
+		Source:     fakeLogSource{logs: map[string]string{"test/execution1-task1-abcde/main": "lots of output\ntraceback"}},
+		Sink:       logs.NewConfigMapSink(k8s),
+		LimitBytes: 9,
+	}))
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "execution1", Namespace: "test"}}
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	job := &batchv1.Job{}
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "execution1-task1", Namespace: "test"}, job), qt.IsNil)
+	job.Status.Failed = 1
+	qt.Assert(t, k8s.Status().Update(ctx, job), qt.IsNil)
+
+	_, err = r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	got := &v1beta1.Execution{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, got), qt.IsNil)
+	qt.Assert(t, got.Status.Tasks["task1"].Logs, qt.Equals, "configmap/execution1-task1-logs")
+
+	cm := &corev1.ConfigMap{}
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "execution1-task1-logs", Namespace: "test"}, cm), qt.IsNil)
+	qt.Assert(t, cm.Data[logs.ConfigMapKey], qt.Equals, "traceback")
+	qt.Assert(t, cm.OwnerReferences, qt.HasLen, 1)
+	qt.Assert(t, job.Spec.Template.Labels[logs.LabelKeyExecution], qt.Equals, "execution1")
+}
+
+type countingReader struct {
+	client.Reader
+	lists int
+}
+
+func (c *countingReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	c.lists++
+	return c.Reader.List(ctx, list, opts...)
+}
+
+func TestReconciler_Reconcile_CollectLogsFailure(t *testing.T) {
+	template := v1beta1.TemplateReference{Name: "template1", Namespace: "test"}
+	dag := newDag("dag1", "test",
+		v1beta1.DagTask{Name: "task2", Template: template, Dependencies: []string{"task1"}},
+		v1beta1.DagTask{Name: "task1", Template: template},
+	)
+	execution := &v1beta1.Execution{
+		ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+		Spec:       v1beta1.ExecutionSpec{DagRef: corev1.LocalObjectReference{Name: "dag1"}},
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(dag, newTemplate("template1", "test", v1beta1.PodTemplateSpec{}), execution).
+		WithStatusSubresource(execution, &batchv1.Job{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	pods := &countingReader{Reader: k8s}
+	r := NewReconciler(k8s, WithPodReader(pods), WithLogCollector(&logs.Collector{
+		Source: fakeLogSource{},
+		Sink:   logs.NewConfigMapSink(k8s),
+	}))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(execution)}
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	// the task's pod is gone by the time it's finished
+	job := &batchv1.Job{}
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "execution1-task1", Namespace: "test"}, job), qt.IsNil)
+	job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	job.Status.Succeeded = 1
+	qt.Assert(t, k8s.Status().Update(ctx, job), qt.IsNil)
+
+	for k := 0; k < 3; k++ {
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+	}
+	qt.Assert(t, pods.lists, qt.Equals, 1)
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, execution), qt.IsNil)
+	qt.Assert(t, execution.Status.Tasks["task1"].Logs, qt.Equals, "")
+	qt.Assert(t, execution.Status.Tasks["task1"].LogsError, qt.Contains, "removed before its logs were collected")
+}
+
+func TestReconciler_Reconcile_Events(t *testing.T) {
+	drain := func(recorder *record.FakeRecorder) []string {
+		events := make([]string, 0)
+		for {
+			select {
+			case event := <-recorder.Events:
+				events = append(events, event)
+			default:
+				return events
+			}
+		}
+	}
+	setup := func(t *testing.T, task v1beta1.DagTask) (client.WithWatch, *Reconciler, *record.FakeRecorder, reconcile.Request) {
+		t.Helper()
+		execution := &v1beta1.Execution{
+			ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+			Spec:       v1beta1.ExecutionSpec{DagRef: corev1.LocalObjectReference{Name: "dag1"}},
+		}
+		qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+		k8s := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(newDag("dag1", "test", task), newTemplate("template1", "test", v1beta1.PodTemplateSpec{}), execution).
+			WithStatusSubresource(execution, &batchv1.Job{}).
+			WithInterceptorFuncs(applytest.Funcs()).
+			Build()
+		recorder := record.NewFakeRecorder(100)
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "execution1", Namespace: "test"}}
+		return k8s, NewReconciler(k8s, WithEventRecorder(recorder)), recorder, req
+	}
+	finish := func(t *testing.T, k8s client.Client, fn func(job *batchv1.Job)) {
+		t.Helper()
+		job := &batchv1.Job{}
+		qt.Assert(t, k8s.Get(context.Background(), types.NamespacedName{Name: "execution1-task1", Namespace: "test"}, job), qt.IsNil)
+		fn(job)
+		qt.Assert(t, k8s.Status().Update(context.Background(), job), qt.IsNil)
+	}
+	task := v1beta1.DagTask{
+		Name:     "task1",
+		Template: v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+	}
+
+	t.Run("Succeeded", func(t *testing.T) {
+		k8s, r, recorder, req := setup(t, task)
+		ctx := context.Background()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, drain(recorder), qt.DeepEquals, []string{"Normal TaskStarted started task task1 as job execution1-task1"})
+
+		// nothing is recorded while the task runs
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, drain(recorder), qt.HasLen, 0)
+
+		finish(t, k8s, func(job *batchv1.Job) {
+			job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+			job.Status.Succeeded = 1
+		})
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, drain(recorder), qt.DeepEquals, []string{
+			"Normal TaskSucceeded task task1 succeeded",
+			"Normal ExecutionSucceeded all tasks succeeded",
+		})
+	})
+	t.Run("Failed", func(t *testing.T) {
+		k8s, r, recorder, req := setup(t, task)
+		ctx := context.Background()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		drain(recorder)
+
+		finish(t, k8s, func(job *batchv1.Job) {
+			job.Status.Failed = 1
+		})
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, drain(recorder), qt.DeepEquals, []string{
+			"Warning TaskFailed task task1 failed",
+			"Warning ExecutionFailed task task1 failed",
+		})
+	})
+	t.Run("UpdateFailed", func(t *testing.T) {
+		k8s, r, recorder, req := setup(t, task)
+		ctx := context.Background()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		drain(recorder)
+
+		finish(t, k8s, func(job *batchv1.Job) {
+			job.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+			job.Status.Succeeded = 1
+		})
+		// nothing is recorded until the status is updated
+		conflicting := interceptor.NewClient(k8s, interceptor.Funcs{
+			SubResourceUpdate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				return apierrors.NewConflict(v1beta1.GroupVersion.WithResource("executions").GroupResource(), obj.GetName(), errors.New("modified"))
+			},
+		})
+		_, err = NewReconciler(conflicting, WithEventRecorder(recorder)).Reconcile(ctx, req)
+		qt.Assert(t, apierrors.IsConflict(err), qt.IsTrue)
+		qt.Assert(t, drain(recorder), qt.HasLen, 0)
+
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, drain(recorder), qt.DeepEquals, []string{
+			"Normal TaskSucceeded task task1 succeeded",
+			"Normal ExecutionSucceeded all tasks succeeded",
+		})
+	})
+	t.Run("InvalidOptions", func(t *testing.T) {
+		invalid := task
+		invalid.Options = []corev1.LocalObjectReference{{Name: "pypi-mirror"}}
+		_, r, recorder, req := setup(t, invalid)
+		_, err := r.Reconcile(context.Background(), req)
+		qt.Assert(t, err, qt.IsNil)
+		events := drain(recorder)
+		qt.Assert(t, events, qt.HasLen, 3)
+		qt.Assert(t, events[0], qt.Equals, "Warning InvalidOptions task task1: "+v1beta1.ErrUnknownOption+": pypi-mirror")
+		qt.Assert(t, events[1], qt.Contains, "Warning TaskFailed task task1 failed: "+v1beta1.ErrUnknownOption)
+		qt.Assert(t, events[2], qt.Equals, "Warning ExecutionFailed task task1 failed")
+	})
+	t.Run("TemplateNotFound", func(t *testing.T) {
+		missing := task
+		missing.Template.Name = "template2"
+		_, r, recorder, req := setup(t, missing)
+		_, err := r.Reconcile(context.Background(), req)
+		qt.Assert(t, apierrors.IsNotFound(errors.Cause(err)), qt.IsTrue)
+		qt.Assert(t, drain(recorder), qt.DeepEquals, []string{`Warning TemplateNotFound template "template2" of task task1 not found`})
+	})
+}
+
+func TestReconciler_Reconcile_Queue(t *testing.T) {
+	dag := newDag("dag1", "test", v1beta1.DagTask{
+		Name:     "task1",
+		Template: v1beta1.TemplateReference{Name: "template1", Namespace: "test"},
+	})
+	template := newTemplate("template1", "test", v1beta1.PodTemplateSpec{})
+	queue := &v1beta1.ExecutionQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "test"},
+		Spec:       v1beta1.ExecutionQueueSpec{MaxConcurrentExecutions: 1},
+	}
+	newExecution := func(name string, priority int) *v1beta1.Execution {
+		return &v1beta1.Execution{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+			Spec: v1beta1.ExecutionSpec{
+				DagRef:   corev1.LocalObjectReference{Name: "dag1"},
+				QueueRef: &corev1.LocalObjectReference{Name: "nightly"},
+				Priority: pointer.Int(priority),
+			},
+		}
+	}
+	low, high := newExecution("low", 0), newExecution("high", 10)
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(dag, template, queue, low, high).
+		WithStatusSubresource(&v1beta1.Execution{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	phase := func(name string) string {
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "test"}}
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+
+		got := &v1beta1.Execution{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, got), qt.IsNil)
+		return got.Status.Phase
+	}
+
+	qt.Assert(t, phase("low"), qt.Equals, v1beta1.ExecutionPhaseQueued)
+	qt.Assert(t, phase("high"), qt.Equals, v1beta1.ExecutionPhaseRunning)
+	qt.Assert(t, phase("low"), qt.Equals, v1beta1.ExecutionPhaseQueued)
+
+	job := &batchv1.Job{}
+	key := types.NamespacedName{Name: "low-task1", Namespace: "test"}
+	qt.Assert(t, apierrors.IsNotFound(k8s.Get(ctx, key, job)), qt.IsTrue)
+
+	// the waiting execution is enqueued when the queue changes
+	requests, err := queuedExecutions(ctx, k8s, "test", "nightly")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, requests, qt.DeepEquals, []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "low", Namespace: "test"}}})
+
+	// it's admitted once the running execution completes
+	got := &v1beta1.Execution{}
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "high", Namespace: "test"}, got), qt.IsNil)
+	got.Status.Completed = true
+	qt.Assert(t, k8s.Status().Update(ctx, got), qt.IsNil)
+	qt.Assert(t, phase("low"), qt.Equals, v1beta1.ExecutionPhaseRunning)
+}
+
+func TestReconciler_Reconcile_AdmissionIsPersisted(t *testing.T) {
+	dag := newDag("dag1", "test", v1beta1.DagTask{
+		Name:     "task1",
+		Template: v1beta1.TemplateReference{Name: "missing", Namespace: "test"},
+	})
+	queue := &v1beta1.ExecutionQueue{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "test"},
+		Spec:       v1beta1.ExecutionQueueSpec{MaxConcurrentExecutions: 1},
+	}
+	execution := &v1beta1.Execution{
+		ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"},
+		Spec: v1beta1.ExecutionSpec{
+			DagRef:   corev1.LocalObjectReference{Name: "dag1"},
+			QueueRef: &corev1.LocalObjectReference{Name: "nightly"},
+		},
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(dag, queue, execution).
+		WithStatusSubresource(&v1beta1.Execution{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	// the task can't start because its template is missing, but the
+	// execution keeps its slot in the queue
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(execution)}
+	_, err := NewReconciler(k8s).Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNotNil)
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, execution), qt.IsNil)
+	qt.Assert(t, execution.Status.Phase, qt.Equals, v1beta1.ExecutionPhaseRunning)
 }
 
 func newTemplate(name, namespace string, podSpec v1beta1.PodTemplateSpec) *v1beta1.Template {
@@ -0,0 +1,141 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+var (
+	_ admission.CustomValidator = &Validator{}
+)
+
+// SetupWebhook adds the Dag validating webhook to manager.Manager.
+func SetupWebhook(mgr manager.Manager) error {
+	return builder.WebhookManagedBy(mgr).
+		For(&v1beta1.Dag{}).
+		WithValidator(NewValidator(mgr.GetClient())).
+		Complete()
+}
+
+// NewValidator returns a Validator that reads templates with
+// the provided client.
+func NewValidator(c client.Reader) *Validator {
+	return &Validator{client: c}
+}
+
+// Validator rejects Dags that aren't well-formed, that are reachable from
+// themselves through their sub-Dags, or whose tasks provide parameter
+// values, options or resource requests their Template doesn't accept.
+type Validator struct {
+	client client.Reader
+}
+
+func (v *Validator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	dag, ok := obj.(*v1beta1.Dag)
+	if !ok {
+		return nil, fmt.Errorf("expected a Dag but got %T", obj)
+	}
+	if err := v1beta1.ValidateDag(dag); err != nil {
+		return nil, err
+	}
+	if err := v.validateRecursion(ctx, dag); err != nil {
+		return nil, err
+	}
+	return nil, v.validateTasks(ctx, dag, nil)
+}
+
+func (v *Validator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	dag, ok := newObj.(*v1beta1.Dag)
+	if !ok {
+		return nil, fmt.Errorf("expected a Dag but got %T", newObj)
+	}
+	old, ok := oldObj.(*v1beta1.Dag)
+	if !ok {
+		return nil, fmt.Errorf("expected a Dag but got %T", oldObj)
+	}
+	if err := v1beta1.ValidateDag(dag); err != nil {
+		return nil, err
+	}
+	if err := v.validateRecursion(ctx, dag); err != nil {
+		return nil, err
+	}
+	return nil, v.validateTasks(ctx, dag, old)
+}
+
+func (v *Validator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateRecursion returns an error if the Dag is reachable from itself
+// through the Dags its sub-Dag tasks reference. Sub-Dags that don't exist
+// may be created before the Dag is run, so they aren't an error here.
+func (v *Validator) validateRecursion(ctx context.Context, dag *v1beta1.Dag) error {
+	return v1beta1.ValidateDagRecursion(dag, func(name string) (*v1beta1.Dag, error) {
+		child := &v1beta1.Dag{}
+		if err := v.client.Get(ctx, types.NamespacedName{Name: name, Namespace: dag.Namespace}, child); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			child.SetName(name)
+		}
+		return child, nil
+	})
+}
+
+// validateTasks returns an error if a Template task provides a parameter
+// the Template doesn't declare or a value that isn't valid for it, elects
+// options the Template doesn't allow, or requests resources outside of its
+// bounds. Values that are missing may be provided by the Execution, so
+// they aren't an error here. Tasks that are unchanged from old aren't
+// validated, so a Template that's been changed or deleted since doesn't
+// block updates.
+func (v *Validator) validateTasks(ctx context.Context, dag, old *v1beta1.Dag) error {
+	previous := make(map[string]v1beta1.DagTask)
+	if old != nil {
+		for _, task := range old.Spec.Tasks {
+			previous[task.Name] = task
+		}
+	}
+	for k := range dag.Spec.Tasks {
+		task := &dag.Spec.Tasks[k]
+		if task.IsDag() || (len(task.Parameters) == 0 && len(task.Options) == 0 && len(task.Resources) == 0 && task.Preset == "") {
+			continue
+		}
+		if prev, ok := previous[task.Name]; ok &&
+			equality.Semantic.DeepEqual(prev.Template, task.Template) &&
+			equality.Semantic.DeepEqual(prev.Parameters, task.Parameters) &&
+			equality.Semantic.DeepEqual(prev.Options, task.Options) &&
+			equality.Semantic.DeepEqual(prev.Resources, task.Resources) &&
+			prev.Preset == task.Preset {
+			continue
+		}
+		referrer := NamespacedTask{DagTask: task, Namespace: dag.Namespace, Dag: dag.Name}
+		template, err := revision.ResolveReferrerTemplate(ctx, v.client, referrer)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				// The template may be created before the Dag is run.
+				continue
+			}
+			return err
+		}
+		if err := template.ValidateParameters(task.Parameters); err != nil {
+			return fmt.Errorf("task %q: %w", task.Name, err)
+		}
+		if err := revision.Validate(template, referrer); err != nil {
+			return fmt.Errorf("task %q: %w", task.Name, err)
+		}
+	}
+	return nil
+}
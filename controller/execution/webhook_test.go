@@ -0,0 +1,129 @@
+package execution
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestValidator_TaskParameters(t *testing.T) {
+	template := newTemplate("spark", "test", v1beta1.PodTemplateSpec{})
+	template.Spec.Parameters = []v1beta1.TemplateParameter{
+		{Name: "executors", Type: v1beta1.ParameterTypeInteger, Maximum: pointer.Int64(8)},
+		{Name: "python", Default: pointer.String("3.11")},
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template).
+		Build()
+
+	ctx := context.Background()
+	v := NewValidator(k8s)
+	newTask := func(params map[string]string) v1beta1.DagTask {
+		return v1beta1.DagTask{
+			Name:       "train",
+			Template:   v1beta1.TemplateReference{Name: "spark", Namespace: "test"},
+			Parameters: params,
+		}
+	}
+
+	// values that are missing may come from the Execution
+	_, err := v.ValidateCreate(ctx, newDag("dag", "test", newTask(map[string]string{"python": "3.8"})))
+	qt.Assert(t, err, qt.IsNil)
+
+	_, err = v.ValidateCreate(ctx, newDag("dag", "test", newTask(map[string]string{"executors": "16"})))
+	qt.Assert(t, err, qt.ErrorMatches, `task "train": `+v1beta1.ErrInvalidParameter+`: executors: 16 is greater than the maximum 8`)
+
+	_, err = v.ValidateCreate(ctx, newDag("dag", "test", newTask(map[string]string{"scala": "2.13"})))
+	qt.Assert(t, err, qt.ErrorMatches, `task "train": `+v1beta1.ErrUnknownParameter+`: scala`)
+
+	// unchanged tasks aren't validated again, so a deleted template
+	// doesn't block updates to the rest of the Dag
+	old := newDag("dag", "test", newTask(map[string]string{"executors": "4"}))
+	qt.Assert(t, k8s.Delete(ctx, template), qt.IsNil)
+	dag := old.DeepCopy()
+	dag.Spec.Tasks = append(dag.Spec.Tasks, v1beta1.DagTask{
+		Name:     "report",
+		Template: v1beta1.TemplateReference{Name: "report", Namespace: "test"},
+	})
+	_, err = v.ValidateUpdate(ctx, old, dag)
+	qt.Assert(t, err, qt.IsNil)
+}
+
+func TestValidator_Recursion(t *testing.T) {
+	subDag := func(name string) v1beta1.DagTask {
+		return v1beta1.DagTask{Name: name, DagRef: &corev1.LocalObjectReference{Name: name}}
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newDag("b", "test", subDag("c")), newDag("c", "test", subDag("a"))).
+		Build()
+
+	ctx := context.Background()
+	v := NewValidator(k8s)
+	_, err := v.ValidateCreate(ctx, newDag("a", "test", subDag("b")))
+	qt.Assert(t, err, qt.ErrorMatches, v1beta1.ErrRecursiveDag+": a -> b -> c -> a")
+
+	old := newDag("a", "test", subDag("d"))
+	_, err = v.ValidateUpdate(ctx, old, newDag("a", "test", subDag("b")))
+	qt.Assert(t, err, qt.ErrorMatches, v1beta1.ErrRecursiveDag+": a -> b -> c -> a")
+
+	// sub-Dags that don't exist yet may be created before the Dag runs
+	_, err = v.ValidateCreate(ctx, newDag("a", "test", subDag("d")))
+	qt.Assert(t, err, qt.IsNil)
+}
+
+func TestValidator_TaskResourcesAndOptions(t *testing.T) {
+	template := newTemplate("spark", "test", v1beta1.PodTemplateSpec{})
+	template.Spec.Resources = &v1beta1.TemplateResources{
+		Max: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("16Gi")},
+	}
+	template.Spec.Options = []v1beta1.TemplateOption{{Name: "pypi"}}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template).
+		Build()
+
+	ctx := context.Background()
+	v := NewValidator(k8s)
+	newTask := func(fn func(task *v1beta1.DagTask)) v1beta1.DagTask {
+		task := v1beta1.DagTask{
+			Name:     "train",
+			Template: v1beta1.TemplateReference{Name: "spark", Namespace: "test"},
+		}
+		fn(&task)
+		return task
+	}
+
+	_, err := v.ValidateCreate(ctx, newDag("dag", "test", newTask(func(task *v1beta1.DagTask) {
+		task.Resources = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("8Gi")}
+		task.Options = []corev1.LocalObjectReference{{Name: "pypi"}}
+	})))
+	qt.Assert(t, err, qt.IsNil)
+
+	_, err = v.ValidateCreate(ctx, newDag("dag", "test", newTask(func(task *v1beta1.DagTask) {
+		task.Resources = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Gi")}
+	})))
+	qt.Assert(t, err, qt.ErrorMatches, `task "train": `+v1beta1.ErrResourceAboveMaximum+`: memory: 32Gi is greater than 16Gi`)
+
+	_, err = v.ValidateCreate(ctx, newDag("dag", "test", newTask(func(task *v1beta1.DagTask) {
+		task.Preset = v1beta1.PresetLarge
+	})))
+	qt.Assert(t, err, qt.ErrorMatches, `task "train": `+v1beta1.ErrUnknownPreset+`: large`)
+
+	_, err = v.ValidateCreate(ctx, newDag("dag", "test", newTask(func(task *v1beta1.DagTask) {
+		task.Options = []corev1.LocalObjectReference{{Name: "conda"}}
+	})))
+	qt.Assert(t, err, qt.ErrorMatches, `task "train": `+v1beta1.ErrUnknownOption+`: conda`)
+}
@@ -0,0 +1,358 @@
+// Package gc removes the Revisions and dependency copies that are left
+// behind when the workloads that use them are deleted.
+package gc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/dependency"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+const (
+	// DefaultInterval is how often garbage is collected.
+	DefaultInterval = 10 * time.Minute
+	// DefaultMinAge is how old a Revision has to be before it's collected.
+	// It gives workloads time to start from a Revision after it's
+	// published.
+	DefaultMinAge = 10 * time.Minute
+
+	// taskHistoryLimit is the number of revisions kept for a Dag task.
+	taskHistoryLimit = 1
+)
+
+var (
+	_ manager.Runnable               = &Collector{}
+	_ manager.LeaderElectionRunnable = &Collector{}
+
+	// DefaultKinds are the kinds of dependency copies that are collected.
+	DefaultKinds = []schema.GroupVersionKind{
+		corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		corev1.SchemeGroupVersion.WithKind("Secret"),
+	}
+)
+
+// Setup adds the Collector to manager.Manager. Any options provided are
+// applied after the defaults.
+func Setup(mgr manager.Manager, opts ...Option) error {
+	return mgr.Add(NewCollector(mgr.GetClient(), append([]Option{
+		WithLogger(mgr.GetLogger().WithName("garbage-collector")),
+		WithAPIReader(mgr.GetAPIReader()),
+	}, opts...)...))
+}
+
+type Option func(c *Collector)
+
+func WithLogger(logger logr.Logger) Option {
+	return func(c *Collector) {
+		c.logger = logger
+	}
+}
+
+// WithAPIReader sets the reader the Revisions that own dependency copies
+// are listed with. The cache may not have seen a Revision that a copy was
+// just applied for, so the copies of Revisions are checked against the
+// API server. If the reader isn't provided, the client is used.
+func WithAPIReader(reader client.Reader) Option {
+	return func(c *Collector) {
+		c.reader = reader
+	}
+}
+
+// WithInterval sets how often garbage is collected.
+func WithInterval(interval time.Duration) Option {
+	return func(c *Collector) {
+		c.interval = interval
+	}
+}
+
+// WithMinAge sets how old a Revision or dependency copy has to be before
+// it's collected.
+func WithMinAge(age time.Duration) Option {
+	return func(c *Collector) {
+		c.minAge = age
+	}
+}
+
+// WithDryRun logs the objects that would be deleted instead of
+// deleting them.
+func WithDryRun(dryRun bool) Option {
+	return func(c *Collector) {
+		c.dryRun = dryRun
+	}
+}
+
+// WithKinds sets the kinds of dependency copies that are collected.
+func WithKinds(kinds ...schema.GroupVersionKind) Option {
+	return func(c *Collector) {
+		c.kinds = kinds
+	}
+}
+
+// NewCollector returns a new Collector with default options set as well
+// as any options provided.
+func NewCollector(c client.Client, opts ...Option) *Collector {
+	collector := &Collector{
+		client:   c,
+		logger:   logr.New(nil),
+		interval: DefaultInterval,
+		minAge:   DefaultMinAge,
+		kinds:    DefaultKinds,
+	}
+	for _, opt := range opts {
+		opt(collector)
+	}
+	if collector.reader == nil {
+		collector.reader = collector.client
+	}
+	return collector
+}
+
+// Collector periodically deletes Revisions whose workload no longer
+// exists, trims the history of every workload to its limit, and deletes
+// dependency copies that no Revision owns. Revisions that are elected, or
+// that pods are running from, are never deleted.
+type Collector struct {
+	client   client.Client
+	reader   client.Reader
+	logger   logr.Logger
+	interval time.Duration
+	minAge   time.Duration
+	dryRun   bool
+	kinds    []schema.GroupVersionKind
+}
+
+// Start collects garbage every interval until the context is done.
+func (c *Collector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Collect(ctx); err != nil {
+			c.logger.Error(err, "failed to collect garbage")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns true, so only one replica collects garbage.
+func (c *Collector) NeedLeaderElection() bool {
+	return true
+}
+
+// Collect deletes the orphaned and over limit Revisions, and then the
+// dependency copies that aren't owned by any remaining Revision.
+func (c *Collector) Collect(ctx context.Context) error {
+	if err := c.collectRevisions(ctx); err != nil {
+		return err
+	}
+	return c.collectDependencies(ctx)
+}
+
+const (
+	kindNotebook = "Notebook"
+	kindTask     = "DagTask"
+)
+
+// groupKey identifies the workload of a group of revisions. Task names are
+// only unique within a Dag, so tasks are also keyed by their Dag.
+type groupKey struct {
+	kind      string
+	namespace string
+	dag       string
+	name      string
+}
+
+func (key groupKey) String() string {
+	return key.kind + "/" + key.namespace + "/" + key.dag + "/" + key.name
+}
+
+// groupKeyOf returns the key of the workload the Revision was published
+// for. Revisions of tasks are labelled with their Dag. It returns false if
+// the workload isn't known, such as for Revisions published before
+// provenance was recorded.
+func groupKeyOf(rev *v1beta1.Revision) (groupKey, bool) {
+	key := groupKey{namespace: rev.Namespace, name: rev.Labels[revision.LabelKeyName]}
+	if dag, ok := rev.Labels[revision.LabelKeyDag]; ok {
+		key.kind, key.dag = kindTask, dag
+		return key, true
+	}
+	p, err := rev.Provenance()
+	if err != nil || p == nil {
+		return key, false
+	}
+	if p.Referrer.Kind != kindNotebook {
+		return key, false
+	}
+	key.kind = kindNotebook
+	return key, true
+}
+
+func (c *Collector) collectRevisions(ctx context.Context) error {
+	nbList := &v1beta1.NotebookList{}
+	if err := c.client.List(ctx, nbList); err != nil {
+		return err
+	}
+	notebooks := make(map[types.NamespacedName]*v1beta1.Notebook, len(nbList.Items))
+	for k := range nbList.Items {
+		notebooks[client.ObjectKeyFromObject(&nbList.Items[k])] = &nbList.Items[k]
+	}
+
+	dagList := &v1beta1.DagList{}
+	if err := c.client.List(ctx, dagList); err != nil {
+		return err
+	}
+	dags := make(map[types.NamespacedName]map[string]v1beta1.DagTask, len(dagList.Items))
+	for k := range dagList.Items {
+		dags[client.ObjectKeyFromObject(&dagList.Items[k])] = dagList.Items[k].TaskMap()
+	}
+
+	podList := &corev1.PodList{}
+	if err := c.client.List(ctx, podList, client.HasLabels{revision.LabelKeyRevision}); err != nil {
+		return err
+	}
+	running := sets.New[types.NamespacedName]()
+	for _, pod := range podList.Items {
+		running.Insert(types.NamespacedName{Namespace: pod.Namespace, Name: pod.Labels[revision.LabelKeyRevision]})
+	}
+
+	revList := &v1beta1.RevisionList{}
+	if err := c.client.List(ctx, revList, client.HasLabels{revision.LabelKeyName}); err != nil {
+		return err
+	}
+	// the revisions of each workload
+	groups := make(map[groupKey][]*v1beta1.Revision)
+	for k := range revList.Items {
+		rev := &revList.Items[k]
+		key, ok := groupKeyOf(rev)
+		if !ok {
+			// The workload of the revision isn't known, so it can't
+			// be known to be gone. Its workload trims it.
+			continue
+		}
+		groups[key] = append(groups[key], rev)
+	}
+
+	keys := make([]groupKey, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	for _, key := range keys {
+		revs := groups[key]
+		limit, orphaned := taskHistoryLimit, false
+		reason := "over the history limit"
+		switch {
+		case key.kind == kindNotebook:
+			if nb, ok := notebooks[types.NamespacedName{Namespace: key.namespace, Name: key.name}]; ok {
+				limit = nb.HistoryLimit()
+			} else {
+				limit, orphaned, reason = 0, true, "notebook not found"
+			}
+		case key.kind == kindTask:
+			tasks, ok := dags[types.NamespacedName{Namespace: key.namespace, Name: key.dag}]
+			if !ok {
+				limit, orphaned, reason = 0, true, "dag not found"
+			} else if _, ok := tasks[key.name]; !ok {
+				limit, orphaned, reason = 0, true, "task not found in dag"
+			}
+		}
+
+		// newest first, so the oldest are beyond the limit
+		sort.Slice(revs, func(i, j int) bool { return revs[j].Less(revs[i]) })
+		for k := limit; k < len(revs); k++ {
+			rev := revs[k]
+			if rev.Elected() && !orphaned {
+				continue
+			}
+			if running.Has(client.ObjectKeyFromObject(rev)) {
+				continue
+			}
+			if time.Since(rev.CreationTimestamp.Time) < c.minAge {
+				continue
+			}
+			if err := c.deleteRevision(ctx, rev, reason); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Collector) deleteRevision(ctx context.Context, rev *v1beta1.Revision, reason string) error {
+	logger := c.logger.WithValues("revision", rev.Name, "namespace", rev.Namespace, "reason", reason)
+	if c.dryRun {
+		logger.Info("would delete revision")
+		return nil
+	}
+	if err := dependency.NewPropagator(c.client).Release(ctx, rev); err != nil {
+		return err
+	}
+	if err := c.client.Delete(ctx, rev); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	logger.Info("deleted revision")
+	return nil
+}
+
+func (c *Collector) collectDependencies(ctx context.Context) error {
+	revList := &v1beta1.RevisionList{}
+	if err := c.reader.List(ctx, revList); err != nil {
+		return err
+	}
+	live := sets.New[types.UID]()
+	for _, rev := range revList.Items {
+		live.Insert(rev.UID)
+	}
+
+	for _, gvk := range c.kinds {
+		objList := &unstructured.UnstructuredList{}
+		objList.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := c.client.List(ctx, objList, client.MatchingLabels{dependency.LabelKeyManaged: "true"}); err != nil {
+			return err
+		}
+		for k := range objList.Items {
+			obj := &objList.Items[k]
+			owned := false
+			for _, owner := range obj.GetOwnerReferences() {
+				if owner.Kind == "Revision" && live.Has(owner.UID) {
+					owned = true
+				}
+			}
+			if owned {
+				continue
+			}
+			// The copy may have been applied for a Revision that's
+			// about to be created.
+			if time.Since(obj.GetCreationTimestamp().Time) < c.minAge {
+				continue
+			}
+			logger := c.logger.WithValues("kind", gvk.Kind, "name", obj.GetName(), "namespace", obj.GetNamespace())
+			if c.dryRun {
+				logger.Info("would delete dependency copy")
+				continue
+			}
+			if err := c.client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			logger.Info("deleted dependency copy")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/dependency"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func newRevision(t *testing.T, name, referrer string, kind string, age time.Duration, elected bool) *v1beta1.Revision {
+	t.Helper()
+	rev := &v1beta1.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "test",
+			UID:               types.UID(name),
+			Labels:            map[string]string{revision.LabelKeyName: referrer},
+			CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+		},
+		Spec: v1beta1.RevisionSpec{Elected: elected},
+	}
+	p := &v1beta1.Provenance{Referrer: v1beta1.ReferrerProvenance{Kind: kind, Name: referrer, Namespace: "test"}}
+	qt.Assert(t, rev.SetProvenance(p), qt.IsNil)
+	return rev
+}
+
+func newTaskRevision(t *testing.T, name, dag, task string, age time.Duration) *v1beta1.Revision {
+	t.Helper()
+	rev := newRevision(t, name, task, "", age, false)
+	rev.Labels[revision.LabelKeyDag] = dag
+	return rev
+}
+
+func newCopy(name string, owners ...*v1beta1.Revision) *corev1.Secret {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "test",
+		Labels:    map[string]string{dependency.LabelKeyManaged: "true"},
+	}}
+	for _, owner := range owners {
+		secret.OwnerReferences = append(secret.OwnerReferences, metav1.OwnerReference{
+			APIVersion: v1beta1.GroupVersion.String(),
+			Kind:       "Revision",
+			Name:       owner.Name,
+			UID:        owner.UID,
+		})
+	}
+	return secret
+}
+
+func TestCollector_Collect(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "test"},
+		Spec:       v1beta1.NotebookSpec{RevisionHistoryLimit: 1},
+	}
+	hour := time.Hour
+	elected := newRevision(t, "nb-elected", "nb", "Notebook", 4*hour, true)
+	running := newRevision(t, "nb-running", "nb", "Notebook", 3*hour, false)
+	old := newRevision(t, "nb-old", "nb", "Notebook", 2*hour, false)
+	latest := newRevision(t, "nb-latest", "nb", "Notebook", hour, false)
+	orphan := newRevision(t, "gone-1", "gone", "Notebook", hour, true)
+	young := newRevision(t, "new-1", "new", "Notebook", time.Minute, false)
+	dag := &v1beta1.Dag{
+		ObjectMeta: metav1.ObjectMeta{Name: "pipeline", Namespace: "test"},
+		Spec:       v1beta1.DagSpec{Entrypoint: "task", Tasks: []v1beta1.DagTask{{Name: "task"}}},
+	}
+	taskOld := newTaskRevision(t, "task-old", "pipeline", "task", 2*hour)
+	taskLatest := newTaskRevision(t, "task-latest", "pipeline", "task", hour)
+	youngCopy := newCopy("young-secret")
+	youngCopy.CreationTimestamp = metav1.Now()
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "nb",
+		Namespace: "test",
+		Labels:    map[string]string{revision.LabelKeyRevision: running.Name},
+	}}
+
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			nb, dag, pod, elected, running, old, latest, orphan, young, taskOld, taskLatest, youngCopy,
+			newCopy("orphan-secret", orphan),
+			newCopy("shared-secret", orphan, latest),
+			newCopy("stray-secret", &v1beta1.Revision{ObjectMeta: metav1.ObjectMeta{Name: "deleted", UID: "deleted"}}),
+		).
+		Build()
+
+	ctx := context.Background()
+	exists := func(obj client.Object) bool {
+		t.Helper()
+		err := k8s.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		qt.Assert(t, client.IgnoreNotFound(err), qt.IsNil)
+		return !apierrors.IsNotFound(err)
+	}
+	secret := func(name string) client.Object {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"}}
+	}
+	all := []client.Object{
+		elected, running, old, latest, orphan, young, taskOld, taskLatest,
+		secret("orphan-secret"), secret("shared-secret"), secret("stray-secret"), secret("young-secret"),
+	}
+
+	// a dry run doesn't delete anything
+	qt.Assert(t, NewCollector(k8s, WithDryRun(true)).Collect(ctx), qt.IsNil)
+	for _, obj := range all {
+		qt.Assert(t, exists(obj), qt.IsTrue, qt.Commentf("%s", obj.GetName()))
+	}
+
+	qt.Assert(t, NewCollector(k8s).Collect(ctx), qt.IsNil)
+	want := map[string]bool{
+		// elected, running and the latest revisions are kept
+		"nb-elected": true,
+		"nb-running": true,
+		"nb-old":     false,
+		"nb-latest":  true,
+		// revisions of deleted notebooks are removed, even if elected
+		"gone-1": false,
+		// revisions are given time to be used after they're published
+		"new-1": true,
+		// tasks only keep their latest revision
+		"task-old":    false,
+		"task-latest": true,
+		// copies are removed when no revision owns them
+		"orphan-secret": false,
+		"shared-secret": true,
+		"stray-secret":  false,
+		// copies are given time to be owned after they're applied
+		"young-secret": true,
+	}
+	for _, obj := range all {
+		qt.Assert(t, exists(obj), qt.Equals, want[obj.GetName()], qt.Commentf("%s", obj.GetName()))
+	}
+}
+
+func TestCollector_Collect_Tasks(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "train", Namespace: "test"},
+		Spec:       v1beta1.NotebookSpec{RevisionHistoryLimit: 1},
+	}
+	dag := &v1beta1.Dag{
+		ObjectMeta: metav1.ObjectMeta{Name: "pipeline", Namespace: "test"},
+		Spec: v1beta1.DagSpec{
+			Entrypoint: "train",
+			Tasks:      []v1beta1.DagTask{{Name: "train"}},
+		},
+	}
+	hour := time.Hour
+	// no provenance was recorded, so the workload isn't known
+	legacy := &v1beta1.Revision{ObjectMeta: metav1.ObjectMeta{
+		Name:              "gone-legacy",
+		Namespace:         "test",
+		Labels:            map[string]string{revision.LabelKeyName: "gone"},
+		CreationTimestamp: metav1.Time{Time: time.Now().Add(-hour)},
+	}}
+	// the workload of a kind that isn't known isn't collected
+	unknown := newRevision(t, "gone-unknown", "gone", "Job", hour, false)
+	notebook := newRevision(t, "train-notebook", "train", "Notebook", 3*hour, false)
+	taskOld := newTaskRevision(t, "train-old", "pipeline", "train", 2*hour)
+	taskLatest := newTaskRevision(t, "train-latest", "pipeline", "train", hour)
+	other := newTaskRevision(t, "train-other", "other", "train", hour)
+	removed := newTaskRevision(t, "eval-1", "pipeline", "eval", hour)
+
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(nb, dag, legacy, unknown, notebook, taskOld, taskLatest, other, removed).
+		Build()
+
+	ctx := context.Background()
+	qt.Assert(t, NewCollector(k8s).Collect(ctx), qt.IsNil)
+	want := map[string]bool{
+		// revisions without provenance are never orphaned
+		"gone-legacy":  true,
+		"gone-unknown": true,
+		// a task with the same name doesn't count towards the history
+		// of the notebook
+		"train-notebook": true,
+		"train-old":      false,
+		"train-latest":   true,
+		// tasks are checked against their Dag
+		"train-other": false,
+		"eval-1":      false,
+	}
+	for _, rev := range []*v1beta1.Revision{legacy, unknown, notebook, taskOld, taskLatest, other, removed} {
+		err := k8s.Get(ctx, client.ObjectKeyFromObject(rev), &v1beta1.Revision{})
+		qt.Assert(t, client.IgnoreNotFound(err), qt.IsNil)
+		qt.Assert(t, err == nil, qt.Equals, want[rev.Name], qt.Commentf("%s", rev.Name))
+	}
+}
+
+func TestCollector_Collect_APIReader(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	rev := newRevision(t, "nb-1", "nb", "Notebook", time.Minute, true)
+	nb := &v1beta1.Notebook{ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "test"}}
+	// the cache hasn't seen the revision the copy was applied for yet
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(nb, newCopy("secret", rev)).
+		Build()
+	reader := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(nb, rev).
+		Build()
+
+	ctx := context.Background()
+	qt.Assert(t, NewCollector(k8s, WithAPIReader(reader)).Collect(ctx), qt.IsNil)
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "secret", Namespace: "test"}, &corev1.Secret{}), qt.IsNil)
+}
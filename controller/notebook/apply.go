@@ -0,0 +1,132 @@
+package notebook
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+// newPod returns the Notebook's Pod as it's applied from the Revision.
+func newPod(nb *v1beta1.Notebook, rev *v1beta1.Revision) (*corev1.Pod, error) {
+	spec := v1beta1.PodTemplateSpec{}
+	if err := json.Unmarshal(rev.GetData(), &spec); err != nil {
+		return nil, err
+	}
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string)
+	}
+	if spec.Annotations == nil {
+		spec.Annotations = make(map[string]string)
+	}
+
+	spec.Labels[LabelKeyNotebookName] = nb.Name
+	spec.Labels[revision.LabelKeyRevision] = rev.GetName()
+	spec.Annotations[AnnotationKeyOwner] = nb.Spec.Owner.Name
+	spec.Annotations[v1beta1.AnnotationKeyRevisionHash] = rev.Sum()
+
+	pod := &corev1.Pod{}
+	pod.SetName(nb.Name)
+	pod.SetNamespace(nb.Namespace)
+	pod.Spec = spec.Spec
+	pod.Labels = spec.Labels
+	pod.Annotations = spec.Annotations
+	pod.OwnerReferences = append(pod.OwnerReferences, nb.AsOwner())
+	return pod, nil
+}
+
+// applyPodMetadata applies the Pod again from the Revision it was started
+// from when the labels and annotations the Notebook sets on it are out of
+// date, such as when the owner of the Notebook changes, or the images the
+// Pod started with aren't recorded yet. The spec the Pod is applied with
+// is the one it was started with, and its containers keep the images they
+// run, since webhooks can rewrite them and changing them would restart the
+// containers. Pods whose Revision doesn't exist anymore are left alone.
+func (r *Reconciler) applyPodMetadata(ctx context.Context, nb *v1beta1.Notebook, pod *corev1.Pod, elected *v1beta1.Revision) error {
+	rev := elected
+	if rev == nil || !startedFrom(pod, rev) {
+		rev = &v1beta1.Revision{}
+		key := types.NamespacedName{Namespace: pod.Namespace, Name: pod.GetLabels()[revision.LabelKeyRevision]}
+		if err := r.client.Get(ctx, key, rev); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+	}
+	desired, err := newPod(nb, rev)
+	if err != nil {
+		return err
+	}
+	images, ok := pod.GetAnnotations()[AnnotationKeyImages]
+	if !ok {
+		if images, err = podImages(pod, desired); err != nil {
+			return err
+		}
+	}
+	desired.Annotations[AnnotationKeyImages] = images
+	running := make(map[string]string)
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		running[c.Name] = c.Image
+	}
+	for _, containers := range [][]corev1.Container{desired.Spec.InitContainers, desired.Spec.Containers} {
+		for k := range containers {
+			if image, ok := running[containers[k].Name]; ok {
+				containers[k].Image = image
+			}
+		}
+	}
+	if hasMetadata(pod, desired) {
+		return nil
+	}
+	if err := apply.Apply(ctx, r.client, desired); err != nil {
+		return err
+	}
+	desired.DeepCopyInto(pod)
+	return nil
+}
+
+// hasMetadata returns true if the Pod has the labels, annotations and
+// owners of the desired Pod.
+func hasMetadata(pod, desired *corev1.Pod) bool {
+	for k, v := range desired.Labels {
+		if value, ok := pod.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	for k, v := range desired.Annotations {
+		if value, ok := pod.Annotations[k]; !ok || value != v {
+			return false
+		}
+	}
+	for _, owner := range desired.OwnerReferences {
+		found := false
+		for _, ref := range pod.OwnerReferences {
+			found = found || ref.UID == owner.UID
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// podImages returns the images the containers of the Pod that are in the
+// desired Pod run, as they're recorded in AnnotationKeyImages.
+func podImages(pod, desired *corev1.Pod) (string, error) {
+	names := make(map[string]bool)
+	for _, c := range append(desired.Spec.InitContainers, desired.Spec.Containers...) {
+		names[c.Name] = true
+	}
+	images := make(map[string]string)
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if names[c.Name] {
+			images[c.Name] = c.Image
+		}
+	}
+	raw, err := json.Marshal(images)
+	return string(raw), err
+}
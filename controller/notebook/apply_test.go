@@ -0,0 +1,86 @@
+package notebook
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func TestReconciler_Reconcile_ForeignFields(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	nb.SetUpdatePolicy(v1beta1.UpdatePolicyAuto)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newTemplate("jupyter", "jupyter:v1"), nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	pub := revision.NewPublisher(k8s)
+	run := func() {
+		t.Helper()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		checkRevisions(t, k8s)
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+	}
+
+	run()
+	first, err := pub.Elected(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+
+	// a mutating webhook injects a sidecar, and another controller
+	// labels the pod and the revision
+	pod := &corev1.Pod{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+	pod.Labels["istio.io/rev"] = "default"
+	pod.Annotations["sidecar.istio.io/status"] = "injected"
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "istio-proxy", Image: "istio/proxyv2"})
+	qt.Assert(t, k8s.Update(ctx, pod), qt.IsNil)
+	first.Labels["audit"] = "true"
+	qt.Assert(t, k8s.Update(ctx, first), qt.IsNil)
+
+	// the pod is applied again when its metadata changes
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	nb.Spec.Owner.Name = "jane"
+	qt.Assert(t, k8s.Update(ctx, nb), qt.IsNil)
+	run()
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+	qt.Assert(t, pod.Annotations[AnnotationKeyOwner], qt.Equals, "jane")
+	qt.Assert(t, pod.Labels["istio.io/rev"], qt.Equals, "default")
+	qt.Assert(t, pod.Annotations["sidecar.istio.io/status"], qt.Equals, "injected")
+	qt.Assert(t, pod.Spec.Containers, qt.HasLen, 2)
+
+	// a new revision is published and elected, which recalls the first
+	template := &v1beta1.Template{}
+	qt.Assert(t, k8s.Get(ctx, client.ObjectKey{Name: "jupyter", Namespace: "test"}, template), qt.IsNil)
+	template.Spec.Template.Spec.Containers[0].Image = "jupyter:v2"
+	qt.Assert(t, k8s.Update(ctx, template), qt.IsNil)
+	run()
+
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+	qt.Assert(t, pod.Labels["istio.io/rev"], qt.Equals, "default")
+	qt.Assert(t, pod.Labels[LabelKeyNotebookName], qt.Equals, "nb")
+	qt.Assert(t, pod.Annotations["sidecar.istio.io/status"], qt.Equals, "injected")
+	qt.Assert(t, pod.Spec.Containers, qt.HasLen, 2)
+
+	qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(first), first), qt.IsNil)
+	qt.Assert(t, first.Elected(), qt.IsFalse)
+	qt.Assert(t, first.Labels["audit"], qt.Equals, "true")
+	qt.Assert(t, first.Spec.Data.Raw, qt.Not(qt.HasLen), 0)
+}
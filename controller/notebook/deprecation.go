@@ -0,0 +1,125 @@
+package notebook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+// deprecatedTemplate returns the template the Notebook references if it's
+// deprecated, or nil otherwise. The template is read as it is now, rather
+// than from a pinned revision, since a template can be deprecated after the
+// revision was taken.
+func (r *Reconciler) deprecatedTemplate(ctx context.Context, nb *v1beta1.Notebook) (*v1beta1.Template, error) {
+	template, err := revision.ResolveTemplate(ctx, r.client, nb.TemplateKind(), nb.TemplateRef())
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if !template.Deprecated() {
+		return nil, nil
+	}
+	return template, nil
+}
+
+// migrate moves a stopped Notebook from a template past its sunset date to
+// the template's replacement, and publishes and elects a revision from the
+// replacement, so the Notebook uses it the next time it starts. The
+// Notebook is left as it is if it can't be published from the replacement.
+func (r *Reconciler) migrate(ctx context.Context, nb *v1beta1.Notebook, template *v1beta1.Template) (bool, error) {
+	replacement := template.Replacement()
+	if replacement == nil {
+		return false, nil
+	}
+
+	candidate := nb.DeepCopy()
+	candidate.Spec.TemplateRef = *replacement
+	if err := r.checkMigration(ctx, nb, candidate); err != nil {
+		r.logger.Info("unable to migrate notebook", "error", err)
+		r.event(nb, corev1.EventTypeWarning, v1beta1.ReasonTemplateMigrationFailed,
+			fmt.Sprintf("unable to migrate to %s %q: %s", replacement.TemplateKind(), replacement.Name, err))
+		return false, nil
+	}
+
+	from := nb.Spec.TemplateRef
+	patch := client.MergeFrom(nb.DeepCopy())
+	nb.Spec.TemplateRef = *replacement
+	// a pinned revision would elect the deprecated template again
+	nb.Spec.RevisionRef = ""
+	if err := r.client.Patch(ctx, nb, patch); err != nil {
+		return false, err
+	}
+
+	pub := r.publisher()
+	rev, err := pub.Create(ctx, nb)
+	if err != nil {
+		return false, err
+	}
+	if err := pub.Elect(ctx, nb, rev); err != nil {
+		return false, err
+	}
+	r.event(nb, corev1.EventTypeNormal, v1beta1.ReasonTemplateMigrated,
+		fmt.Sprintf("migrated from %s %q to %s %q", from.TemplateKind(), from.Name, replacement.TemplateKind(), replacement.Name))
+	return true, nil
+}
+
+// checkMigration returns an error if the Notebook can't be migrated to
+// the template the candidate references.
+func (r *Reconciler) checkMigration(ctx context.Context, nb, candidate *v1beta1.Notebook) error {
+	if candidate.TemplateKind() == nb.TemplateKind() && candidate.TemplateRef() == nb.TemplateRef() {
+		return fmt.Errorf("the template replaces itself")
+	}
+	if ns := candidate.TemplateRef().Namespace; candidate.TemplateKind() == v1beta1.KindTemplate && ns != r.namespace && ns != nb.Namespace {
+		return fmt.Errorf("the replacement isn't in the namespace of the Notebook or the system namespace")
+	}
+	template, err := revision.ResolveReferrerTemplate(ctx, r.client, candidate)
+	if err != nil {
+		return err
+	}
+	if candidate.TemplateKind() == v1beta1.KindClusterTemplate {
+		if err := revision.CheckAllowedNamespace(ctx, r.client, template.Name, nb.Namespace); err != nil {
+			return err
+		}
+	}
+	return validateTemplate(template, candidate)
+}
+
+// setDeprecatedCondition sets the TemplateDeprecated condition on the
+// Notebook's status if the template is deprecated, and removes it if it
+// isn't. An Event is recorded when the condition is first set, or its
+// reason changes.
+func (r *Reconciler) setDeprecatedCondition(nb *v1beta1.Notebook, template *v1beta1.Template) {
+	if template == nil {
+		meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionTemplateDeprecated)
+		return
+	}
+	reason := v1beta1.ReasonTemplateDeprecated
+	if template.Sunset(time.Now()) {
+		reason = v1beta1.ReasonTemplateSunset
+	}
+	prev := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateDeprecated)
+	if prev == nil || prev.Reason != reason {
+		r.event(nb, corev1.EventTypeWarning, reason, template.DeprecationMessage())
+	}
+	setCondition(nb, v1beta1.NotebookConditionTemplateDeprecated, metav1.ConditionTrue, reason, template.DeprecationMessage())
+}
+
+// deprecationResult requeues the Notebook at the sunset date of a
+// deprecated template, so it's migrated as soon as it's stopped.
+func deprecationResult(template *v1beta1.Template) reconcile.Result {
+	if template == nil || template.Spec.SunsetDate == nil {
+		return reconcile.Result{}
+	}
+	if d := time.Until(template.Spec.SunsetDate.Time); d > 0 {
+		return reconcile.Result{RequeueAfter: d}
+	}
+	return reconcile.Result{}
+}
@@ -0,0 +1,273 @@
+package notebook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func newTemplate(name, image string) *v1beta1.Template {
+	return &v1beta1.Template{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec: v1beta1.TemplateSpec{
+			Template: v1beta1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: image}}},
+			},
+		},
+	}
+}
+
+func newDeprecatedTemplate(name, image, replacement string, sunset time.Time) *v1beta1.Template {
+	template := newTemplate(name, image)
+	template.Spec.Deprecated = &v1beta1.TemplateDeprecation{
+		Message:     "python 3.8 is end of life",
+		Replacement: &v1beta1.TemplateReference{Name: replacement},
+	}
+	template.Spec.SunsetDate = &metav1.Time{Time: sunset}
+	return template
+}
+
+func newNotebook(name, template string, stopped bool) *v1beta1.Notebook {
+	return &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec: v1beta1.NotebookSpec{
+			RevisionHistoryLimit: 3,
+			Stopped:              stopped,
+			TemplateRef:          v1beta1.TemplateReference{Name: template},
+			Owner:                rbacv1.Subject{Kind: rbacv1.UserKind, Name: "jack"},
+		},
+	}
+}
+
+func findCondition(conditions []metav1.Condition, conditionType string) *metav1.Condition {
+	return meta.FindStatusCondition(conditions, conditionType)
+}
+
+// drainEvents returns the recorded Events. If reasons are provided, only
+// Events with one of the reasons are returned.
+func drainEvents(recorder *record.FakeRecorder, reasons ...string) []string {
+	events := make([]string, 0)
+	for {
+		select {
+		case event := <-recorder.Events:
+			if len(reasons) == 0 || sets.New(reasons...).Has(strings.Fields(event)[1]) {
+				events = append(events, event)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func TestReconciler_Reconcile_Deprecated(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	sunset := time.Now().Add(24 * time.Hour)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			newDeprecatedTemplate("py38", "jupyter:py38", "py311", sunset),
+			newTemplate("py311", "jupyter:py311"),
+			newNotebook("stopped", "py38", true),
+		).
+		WithStatusSubresource(&v1beta1.Notebook{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKey{Name: "stopped", Namespace: "test"}}
+
+	res, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+	// requeued at the sunset date so it's migrated then
+	qt.Assert(t, res.RequeueAfter > 23*time.Hour, qt.IsTrue)
+	qt.Assert(t, res.RequeueAfter <= 24*time.Hour, qt.IsTrue)
+
+	nb := &v1beta1.Notebook{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	qt.Assert(t, nb.Spec.TemplateRef.Name, qt.Equals, "py38")
+	condition := findCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateDeprecated)
+	qt.Assert(t, condition, qt.IsNotNil)
+	qt.Assert(t, condition.Reason, qt.Equals, v1beta1.ReasonTemplateDeprecated)
+	qt.Assert(t, condition.Message, qt.Contains, "python 3.8 is end of life")
+	qt.Assert(t, condition.Message, qt.Contains, `use Template "py311" instead`)
+
+	events := drainEvents(recorder)
+	qt.Assert(t, events, qt.HasLen, 1)
+	qt.Assert(t, events[0], qt.Contains, v1beta1.ReasonTemplateDeprecated)
+
+	// the event isn't recorded again while the condition doesn't change
+	_, err = r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, drainEvents(recorder), qt.HasLen, 0)
+}
+
+func TestReconciler_Reconcile_Sunset(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			newDeprecatedTemplate("py38", "jupyter:py38", "py311", time.Now().Add(-time.Hour)),
+			newTemplate("py311", "jupyter:py311"),
+			newNotebook("stopped", "py38", true),
+		).
+		WithStatusSubresource(&v1beta1.Notebook{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKey{Name: "stopped", Namespace: "test"}}
+
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	nb := &v1beta1.Notebook{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	qt.Assert(t, nb.Spec.TemplateRef.Name, qt.Equals, "py311")
+	qt.Assert(t, nb.Spec.TemplateRef.Namespace, qt.Equals, "test")
+	qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateDeprecated), qt.IsNil)
+
+	// a revision of the replacement is elected, so the notebook runs it
+	// the next time it starts
+	elected, err := revision.NewPublisher(k8s).Elected(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, elected, qt.IsNotNil)
+	qt.Assert(t, string(elected.GetData()), qt.Contains, "jupyter:py311")
+
+	events := drainEvents(recorder, v1beta1.ReasonTemplateMigrated)
+	qt.Assert(t, events, qt.HasLen, 1)
+}
+
+func TestReconciler_Reconcile_SunsetRunning(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			newDeprecatedTemplate("py38", "jupyter:py38", "py311", time.Now().Add(-time.Hour)),
+			newTemplate("py311", "jupyter:py311"),
+			newNotebook("running", "py38", false),
+		).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKey{Name: "running", Namespace: "test"}}
+
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+	checkRevisions(t, k8s)
+	_, err = r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	nb := &v1beta1.Notebook{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	qt.Assert(t, nb.Spec.TemplateRef.Name, qt.Equals, "py38")
+	condition := findCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateDeprecated)
+	qt.Assert(t, condition, qt.IsNotNil)
+	qt.Assert(t, condition.Reason, qt.Equals, v1beta1.ReasonTemplateSunset)
+
+	pod := &corev1.Pod{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+	qt.Assert(t, pod.Spec.Containers[0].Image, qt.Equals, "jupyter:py38")
+
+	events := drainEvents(recorder, v1beta1.ReasonTemplateSunset)
+	qt.Assert(t, events, qt.HasLen, 1)
+}
+
+func TestReconciler_Reconcile_SunsetInvalidReplacement(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("stopped", "py38", true)
+	nb.Spec.Options = []string{"pypi-mirror"}
+	template := newDeprecatedTemplate("py38", "jupyter:py38", "py311", time.Now().Add(-time.Hour))
+	template.Spec.Options = []v1beta1.TemplateOption{{Name: "pypi-mirror"}}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template, newTemplate("py311", "jupyter:py311"), nb).
+		WithStatusSubresource(&v1beta1.Notebook{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	// the replacement doesn't have the option, so the notebook stays
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	qt.Assert(t, nb.Spec.TemplateRef.Name, qt.Equals, "py38")
+
+	events := strings.Join(drainEvents(recorder), "\n")
+	qt.Assert(t, events, qt.Contains, v1beta1.ReasonTemplateMigrationFailed)
+	qt.Assert(t, events, qt.Contains, v1beta1.ReasonTemplateSunset)
+}
+
+func TestValidator_Deprecated(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			newDeprecatedTemplate("py38", "jupyter:py38", "py311", time.Now().Add(time.Hour)),
+			newTemplate("py311", "jupyter:py311"),
+		).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	v := NewValidator(k8s)
+
+	warnings, err := v.ValidateCreate(ctx, newNotebook("nb", "py38", false))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, warnings, qt.HasLen, 1)
+	qt.Assert(t, warnings[0], qt.Contains, `Template "py38" is deprecated`)
+
+	warnings, err = v.ValidateCreate(ctx, newNotebook("nb", "py311", false))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, warnings, qt.HasLen, 0)
+}
+
+func TestValidator_ValidateUpdate(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		Build()
+
+	ctx := context.Background()
+	v := NewValidator(k8s)
+
+	// the template was deleted after the notebook was created, which
+	// doesn't stop it from being stopped
+	old := newNotebook("nb", "jupyter", false)
+	nb := newNotebook("nb", "jupyter", true)
+	_, err := v.ValidateUpdate(ctx, old, nb)
+	qt.Assert(t, err, qt.IsNil)
+
+	nb.Spec.Options = []string{"pypi-mirror"}
+	_, err = v.ValidateUpdate(ctx, old, nb)
+	qt.Assert(t, err, qt.ErrorMatches, `Template "jupyter" not found`)
+}
@@ -0,0 +1,138 @@
+package notebook
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+const (
+	ErrInvalidMaintenanceWindow = "invalid maintenance window"
+)
+
+// A MaintenanceWindow is a daily window, in UTC, in which Notebooks whose
+// Pods are out of date with their Revision are restarted.
+type MaintenanceWindow struct {
+	// Start is the time of day the window opens at.
+	Start time.Duration
+	// Duration is how long the window is open for.
+	Duration time.Duration
+}
+
+// ParseMaintenanceWindow parses a window formatted as HH:MM-HH:MM. A
+// window that ends before it starts ends the next day, and a window that
+// ends when it starts is open all day.
+func ParseMaintenanceWindow(s string) (*MaintenanceWindow, error) {
+	var startH, startM, endH, endM int
+	if _, err := fmt.Sscanf(s, "%d:%d-%d:%d", &startH, &startM, &endH, &endM); err != nil {
+		return nil, errors.Errorf("%s: %q isn't formatted as HH:MM-HH:MM", ErrInvalidMaintenanceWindow, s)
+	}
+	for _, v := range []struct{ value, max int }{{startH, 23}, {startM, 59}, {endH, 23}, {endM, 59}} {
+		if v.value < 0 || v.value > v.max {
+			return nil, errors.Errorf("%s: %q isn't a time of day", ErrInvalidMaintenanceWindow, s)
+		}
+	}
+	start := time.Duration(startH)*time.Hour + time.Duration(startM)*time.Minute
+	end := time.Duration(endH)*time.Hour + time.Duration(endM)*time.Minute
+	duration := (end - start + 24*time.Hour) % (24 * time.Hour)
+	if duration == 0 {
+		duration = 24 * time.Hour
+	}
+	return &MaintenanceWindow{Start: start, Duration: duration}, nil
+}
+
+// Until returns how long it is until the window opens, or zero if the
+// window is open at t.
+func (w *MaintenanceWindow) Until(t time.Time) time.Duration {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	// the window that opened yesterday can still be open
+	for _, day := range []int{-1, 0} {
+		open := midnight.AddDate(0, 0, day).Add(w.Start)
+		if !t.Before(open) && t.Before(open.Add(w.Duration)) {
+			return 0
+		}
+	}
+	open := midnight.Add(w.Start)
+	if open.Before(t) {
+		open = open.AddDate(0, 0, 1)
+	}
+	return open.Sub(t)
+}
+
+// drift compares the Pod to the elected Revision. If the Pod is out of
+// date, the reason and a message explaining why are returned. Pods started
+// from another Revision are out of date, as are Pods whose containers were
+// edited to run another image than they started with. The images are
+// compared to the ones recorded on the Pod, since webhooks can rewrite the
+// images of the Revision when the Pod is created. Containers that aren't
+// in the Revision, such as sidecars injected by webhooks, are ignored.
+func drift(pod *corev1.Pod, rev *v1beta1.Revision) (string, string, error) {
+	if !startedFrom(pod, rev) {
+		return v1beta1.ReasonRevisionChanged, fmt.Sprintf("revision %s is elected, but the pod was started from %s", rev.GetName(), pod.GetLabels()[revision.LabelKeyRevision]), nil
+	}
+
+	images, err := recordedImages(pod)
+	if err != nil {
+		return "", "", err
+	}
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if image, ok := images[c.Name]; ok && image != c.Image {
+			return v1beta1.ReasonPodModified, fmt.Sprintf("container %s runs %s, but the pod was started with %s", c.Name, c.Image, image), nil
+		}
+	}
+	return "", "", nil
+}
+
+// startedFrom returns true if the Pod was started from the Revision. Pods
+// started before the hash was recorded only have the name of their
+// Revision, which may have been renamed when it was migrated.
+func startedFrom(pod *corev1.Pod, rev *v1beta1.Revision) bool {
+	if hash, ok := pod.GetAnnotations()[v1beta1.AnnotationKeyRevisionHash]; ok {
+		return hash == rev.Sum()
+	}
+	name, ok := pod.GetLabels()[revision.LabelKeyRevision]
+	if !ok {
+		return true
+	}
+	return name == rev.GetName() || name == rev.GetAnnotations()[v1beta1.AnnotationKeyMigratedFrom]
+}
+
+// recordedImages returns the images the containers of the Pod started
+// with, or nil if they aren't recorded yet.
+func recordedImages(pod *corev1.Pod) (map[string]string, error) {
+	raw, ok := pod.GetAnnotations()[AnnotationKeyImages]
+	if !ok {
+		return nil, nil
+	}
+	images := make(map[string]string)
+	if err := json.Unmarshal([]byte(raw), &images); err != nil {
+		return nil, errors.Wrapf(err, "failed to read the images of pod %s", pod.GetName())
+	}
+	return images, nil
+}
+
+// setRevisionOutOfDateCondition sets the RevisionOutOfDate condition on
+// the Notebook's status and marks it as pending a restart if the reason
+// isn't empty, and removes it if it is. An Event is recorded when the Pod
+// is first found to be out of date, or the reason changes.
+func (r *Reconciler) setRevisionOutOfDateCondition(nb *v1beta1.Notebook, reason, message string) {
+	nb.Status.PendingRestart = reason != ""
+	if reason == "" {
+		meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate)
+		return
+	}
+	prev := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate)
+	if prev == nil || prev.Reason != reason {
+		r.event(nb, corev1.EventTypeNormal, reason, message)
+	}
+	setCondition(nb, v1beta1.NotebookConditionRevisionOutOfDate, metav1.ConditionTrue, reason, message)
+}
@@ -0,0 +1,190 @@
+package notebook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, "2024-05-01T"+clock+":00Z")
+		qt.Assert(t, err, qt.IsNil)
+		return v
+	}
+	tests := map[string]struct {
+		window string
+		now    string
+		until  time.Duration
+	}{
+		"Open":           {window: "02:00-04:00", now: "03:00", until: 0},
+		"BeforeOpening":  {window: "02:00-04:00", now: "01:30", until: 30 * time.Minute},
+		"AfterClosing":   {window: "02:00-04:00", now: "04:00", until: 22 * time.Hour},
+		"PastMidnight":   {window: "23:00-01:00", now: "00:30", until: 0},
+		"BeforeMidnight": {window: "23:00-01:00", now: "23:30", until: 0},
+		"AllDay":         {window: "00:00-00:00", now: "12:00", until: 0},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			window, err := ParseMaintenanceWindow(tc.window)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, window.Until(at(tc.now)), qt.Equals, tc.until)
+		})
+	}
+
+	_, err := ParseMaintenanceWindow("2am-4am")
+	qt.Assert(t, err, qt.ErrorMatches, ErrInvalidMaintenanceWindow+`: .*`)
+	_, err = ParseMaintenanceWindow("02:00-25:00")
+	qt.Assert(t, err, qt.ErrorMatches, ErrInvalidMaintenanceWindow+`: .*`)
+}
+
+func TestReconciler_Reconcile_Drift(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	nb.SetUpdatePolicy(v1beta1.UpdatePolicyAuto)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newTemplate("jupyter", "jupyter:v1"), nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	run := func() {
+		t.Helper()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		checkRevisions(t, k8s)
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	}
+	getPod := func() *corev1.Pod {
+		t.Helper()
+		pod := &corev1.Pod{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+		return pod
+	}
+
+	run()
+	qt.Assert(t, nb.Status.PendingRestart, qt.IsFalse)
+	qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate), qt.IsNil)
+	drainEvents(recorder)
+
+	// someone edits the pod's image
+	pod := getPod()
+	pod.Spec.Containers[0].Image = "jupyter:latest"
+	qt.Assert(t, k8s.Update(ctx, pod), qt.IsNil)
+	run()
+	qt.Assert(t, nb.Status.PendingRestart, qt.IsTrue)
+	condition := findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate)
+	qt.Assert(t, condition, qt.IsNotNil)
+	qt.Assert(t, condition.Reason, qt.Equals, v1beta1.ReasonPodModified)
+	qt.Assert(t, condition.Message, qt.Contains, "container main runs jupyter:latest")
+	qt.Assert(t, strings.Join(drainEvents(recorder), "\n"), qt.Contains, v1beta1.ReasonPodModified)
+
+	// the event isn't recorded again while the pod stays out of date
+	run()
+	qt.Assert(t, drainEvents(recorder), qt.HasLen, 0)
+
+	// a new revision is elected while the pod is running
+	template := &v1beta1.Template{}
+	qt.Assert(t, k8s.Get(ctx, client.ObjectKey{Name: "jupyter", Namespace: "test"}, template), qt.IsNil)
+	template.Spec.Template.Spec.Containers[0].Image = "jupyter:v2"
+	qt.Assert(t, k8s.Update(ctx, template), qt.IsNil)
+	run()
+	condition = findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate)
+	qt.Assert(t, condition.Reason, qt.Equals, v1beta1.ReasonRevisionChanged)
+	qt.Assert(t, nb.Status.PendingRestart, qt.IsTrue)
+	qt.Assert(t, getPod().Spec.Containers[0].Image, qt.Equals, "jupyter:latest")
+	drainEvents(recorder)
+
+	// the pod is restarted during the maintenance window
+	window, err := ParseMaintenanceWindow("00:00-00:00")
+	qt.Assert(t, err, qt.IsNil)
+	r = NewReconciler(k8s, WithEventRecorder(recorder), WithMaintenanceWindow(window))
+	run()
+	qt.Assert(t, strings.Join(drainEvents(recorder), "\n"), qt.Contains, v1beta1.ReasonMaintenanceRestart)
+	run()
+	qt.Assert(t, getPod().Spec.Containers[0].Image, qt.Equals, "jupyter:v2")
+	qt.Assert(t, nb.Status.PendingRestart, qt.IsFalse)
+	qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate), qt.IsNil)
+}
+
+func TestReconciler_Reconcile_DriftRewrittenImage(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	// a webhook rewrites images to a mirror when pods are admitted
+	funcs := applytest.Funcs()
+	apply := funcs.Patch
+	funcs.Patch = func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			for k := range pod.Spec.Containers {
+				if !strings.HasPrefix(pod.Spec.Containers[k].Image, "mirror/") {
+					pod.Spec.Containers[k].Image = "mirror/" + pod.Spec.Containers[k].Image
+				}
+			}
+		}
+		return apply(ctx, c, obj, patch, opts...)
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newTemplate("jupyter", "jupyter:v1"), nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(funcs).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	for k := 0; k < 3; k++ {
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		checkRevisions(t, k8s)
+	}
+
+	pod := &corev1.Pod{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+	qt.Assert(t, pod.Spec.Containers[0].Image, qt.Equals, "mirror/jupyter:v1")
+	qt.Assert(t, pod.Annotations[AnnotationKeyImages], qt.Equals, `{"main":"mirror/jupyter:v1"}`)
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	qt.Assert(t, nb.Status.PendingRestart, qt.IsFalse)
+	qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate), qt.IsNil)
+}
+
+func TestDrift_Migrated(t *testing.T) {
+	rev := &v1beta1.Revision{}
+	rev.SetName("nb-5d4f8b")
+	rev.SetAnnotations(map[string]string{v1beta1.AnnotationKeyMigratedFrom: "nb-3"})
+	rev.SetData([]byte(`{"spec":{"containers":[{"name":"main","image":"jupyter:v1"}]}}`))
+
+	// pods started before the migration are labelled with the old name
+	pod := &corev1.Pod{}
+	pod.SetLabels(map[string]string{revision.LabelKeyRevision: "nb-3"})
+	reason, _, err := drift(pod, rev)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, reason, qt.Equals, "")
+
+	pod.SetLabels(map[string]string{revision.LabelKeyRevision: "nb-2"})
+	reason, message, err := drift(pod, rev)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, reason, qt.Equals, v1beta1.ReasonRevisionChanged)
+	qt.Assert(t, message, qt.Equals, "revision nb-5d4f8b is elected, but the pod was started from nb-2")
+}
@@ -0,0 +1,81 @@
+package notebook
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+// indexCache registers indexes on a fake client, which, like the cache,
+// only supports a single exact field selector.
+type indexCache struct {
+	cache.Cache
+	builder *fake.ClientBuilder
+	reader  client.Reader
+}
+
+func (c *indexCache) IndexField(_ context.Context, obj client.Object, field string, fn client.IndexerFunc) error {
+	c.builder.WithIndex(obj, field, fn)
+	return nil
+}
+
+func (c *indexCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.reader.List(ctx, list, opts...)
+}
+
+func TestEnqueueRequestFromTemplate(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+
+	child := newTemplate("jupyter-gpu", "jupyter:v1")
+	child.Spec.Extends = &corev1.LocalObjectReference{Name: "jupyter"}
+	other := newNotebook("other", "jupyter", false)
+	other.Namespace = "other"
+	cluster := newNotebook("cluster", "jupyter", false)
+	cluster.Spec.TemplateRef.Kind = v1beta1.KindClusterTemplate
+
+	c := &indexCache{builder: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		newTemplate("jupyter", "jupyter:v1"),
+		child,
+		newNotebook("nb", "jupyter", false),
+		newNotebook("gpu", "jupyter-gpu", false),
+		other,
+		cluster,
+	)}
+	enqueue := EnqueueRequestFromTemplate(c, logr.Discard())
+	c.reader = c.builder.Build()
+
+	requests := func(obj client.Object) []string {
+		t.Helper()
+		queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		defer queue.ShutDown()
+		enqueue.Create(context.Background(), event.CreateEvent{Object: obj}, queue)
+		names := make([]string, 0, queue.Len())
+		for queue.Len() > 0 {
+			item, _ := queue.Get()
+			names = append(names, item.(reconcile.Request).String())
+			queue.Done(item)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	qt.Assert(t, requests(newTemplate("jupyter", "jupyter:v1")), qt.DeepEquals, []string{"test/gpu", "test/nb"})
+	qt.Assert(t, requests(child), qt.DeepEquals, []string{"test/gpu"})
+
+	template := &v1beta1.ClusterTemplate{}
+	template.SetName("jupyter")
+	qt.Assert(t, requests(template), qt.DeepEquals, []string{"test/cluster"})
+}
@@ -0,0 +1,102 @@
+package notebook
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+)
+
+func TestReconciler_Reconcile_Events(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	run := func() {
+		t.Helper()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		checkRevisions(t, k8s)
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	}
+
+	// the template doesn't exist yet
+	run()
+	events := drainEvents(recorder)
+	qt.Assert(t, events, qt.DeepEquals, []string{`Warning TemplateNotFound Template "jupyter" not found`})
+
+	// the revision is published and elected, and the pod is created from it
+	qt.Assert(t, k8s.Create(ctx, newTemplate("jupyter", "jupyter:v1")), qt.IsNil)
+	run()
+	qt.Assert(t, nb.Status.Revisions, qt.HasLen, 1)
+	name := nb.Status.Revisions[0].Name
+	events = drainEvents(recorder)
+	qt.Assert(t, events, qt.DeepEquals, []string{
+		"Normal RevisionCreated published revision " + name,
+		"Normal RevisionElected elected revision " + name,
+		"Normal PodCreated created pod nb from revision " + name,
+	})
+
+	// nothing is recorded while nothing changes
+	run()
+	qt.Assert(t, drainEvents(recorder), qt.HasLen, 0)
+
+	// the pod is deleted when the notebook is stopped
+	nb.Spec.Stopped = true
+	qt.Assert(t, k8s.Update(ctx, nb), qt.IsNil)
+	run()
+	events = drainEvents(recorder)
+	qt.Assert(t, events, qt.DeepEquals, []string{"Normal PodDeleted deleted pod nb because the notebook is stopped"})
+}
+
+func TestReconciler_Reconcile_InvalidOptionsEvent(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	nb.Spec.Options = []string{"pypi-mirror"}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newTemplate("jupyter", "jupyter:v1"), nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.ErrorMatches, v1beta1.ErrUnknownOption+`: pypi-mirror`)
+	events := drainEvents(recorder)
+	qt.Assert(t, events, qt.HasLen, 1)
+	qt.Assert(t, events[0], qt.Matches, `Warning InvalidOptions unable to elect a revision: .*pypi-mirror`)
+
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	condition := findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionElected)
+	qt.Assert(t, condition, qt.IsNotNil)
+	qt.Assert(t, condition.Reason, qt.Equals, v1beta1.ReasonInvalidOptions)
+
+	// the event isn't recorded again while the options stay invalid
+	_, err = r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNotNil)
+	qt.Assert(t, drainEvents(recorder), qt.HasLen, 0)
+}
@@ -0,0 +1,104 @@
+package notebook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	revisioncontroller "github.com/johnhoman/notebook-controller/controller/revision"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+// checkRevisions runs the revision controller over every Revision, so
+// their readiness is set the way it would be in a cluster.
+func checkRevisions(t *testing.T, k8s client.Client) {
+	t.Helper()
+	ctx := context.Background()
+	revList := &v1beta1.RevisionList{}
+	qt.Assert(t, k8s.List(ctx, revList), qt.IsNil)
+	r := revisioncontroller.NewReconciler(k8s)
+	for k := range revList.Items {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&revList.Items[k])})
+		qt.Assert(t, err, qt.IsNil)
+	}
+}
+
+func TestReconciler_Reconcile_RevisionNotReady(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	template := newTemplate("jupyter", "jupyter:v1")
+	template.Spec.Template.Spec.Volumes = []corev1.Volume{{Name: "pypi", VolumeSource: corev1.VolumeSource{
+		Secret: &corev1.SecretVolumeSource{SecretName: "pypi"},
+	}}}
+	nb := newNotebook("nb", "jupyter", false)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template, nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	run := func() {
+		t.Helper()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	}
+	podExists := func() bool {
+		t.Helper()
+		err := k8s.Get(ctx, req.NamespacedName, &corev1.Pod{})
+		qt.Assert(t, client.IgnoreNotFound(err), qt.IsNil)
+		return err == nil
+	}
+
+	// the revision hasn't been checked yet
+	run()
+	qt.Assert(t, podExists(), qt.IsFalse)
+	qt.Assert(t, nb.Status.Phase, qt.Equals, corev1.PodPhase(v1beta1.NotebookPhasePending))
+	condition := findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionReady)
+	qt.Assert(t, condition, qt.IsNotNil)
+	qt.Assert(t, condition.Status, qt.Equals, metav1.ConditionFalse)
+	qt.Assert(t, condition.Message, qt.Contains, "hasn't been checked yet")
+	qt.Assert(t, drainEvents(recorder, v1beta1.ReasonRevisionNotReady), qt.HasLen, 0)
+
+	// the revision references a secret that doesn't exist
+	checkRevisions(t, k8s)
+	run()
+	qt.Assert(t, podExists(), qt.IsFalse)
+	condition = findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionReady)
+	qt.Assert(t, condition.Reason, qt.Equals, v1beta1.ReasonRevisionNotReady)
+	qt.Assert(t, condition.Message, qt.Contains, "referenced objects don't exist: Secret pypi")
+	events := strings.Join(drainEvents(recorder), "\n")
+	qt.Assert(t, events, qt.Contains, v1beta1.ReasonRevisionNotReady)
+
+	// the event isn't recorded again while the revision stays not ready
+	run()
+	qt.Assert(t, drainEvents(recorder), qt.HasLen, 0)
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pypi", Namespace: "test"}}
+	qt.Assert(t, k8s.Create(ctx, secret), qt.IsNil)
+	checkRevisions(t, k8s)
+	run()
+	qt.Assert(t, podExists(), qt.IsTrue)
+	qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionReady), qt.IsNil)
+
+	elected, err := revision.NewPublisher(k8s).Elected(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	pod := &corev1.Pod{}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+	qt.Assert(t, pod.Labels[revision.LabelKeyRevision], qt.Equals, elected.GetName())
+}
@@ -2,14 +2,20 @@ package notebook
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -18,6 +24,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply"
+	"github.com/johnhoman/notebook-controller/internal/image"
 	"github.com/johnhoman/notebook-controller/internal/revision"
 )
 
@@ -26,20 +34,33 @@ var (
 
 	LabelKeyNotebookName = fmt.Sprintf("%s/notebook-name", v1beta1.GroupName)
 	AnnotationKeyOwner   = fmt.Sprintf("%s/owner", v1beta1.GroupName)
+	// AnnotationKeyImages records the images the containers of a Pod
+	// started with, after webhooks rewrote them, as a JSON object of
+	// container names to images.
+	AnnotationKeyImages = fmt.Sprintf("%s/images", v1beta1.GroupName)
 )
 
-// Setup adds the Notebook controller to manager.Manager.
-func Setup(mgr manager.Manager) error {
-	r := NewReconciler(mgr.GetClient(),
+// IndexKeyTemplateRef indexes Notebooks by the kind, namespace and name of
+// the template they reference.
+const IndexKeyTemplateRef = "spec.templateRef"
+
+// Setup adds the Notebook controller to manager.Manager. Any options
+// provided are applied after the defaults.
+func Setup(mgr manager.Manager, opts ...Option) error {
+	r := NewReconciler(mgr.GetClient(), append([]Option{
 		WithLogger(mgr.GetLogger().WithName("notebook-controller")),
 		WithScheme(mgr.GetScheme()),
-	)
+		WithEventRecorder(mgr.GetEventRecorderFor("notebook-controller")),
+	}, opts...)...)
 
+	enqueue := EnqueueRequestFromTemplate(mgr.GetCache(), mgr.GetLogger())
 	return builder.ControllerManagedBy(mgr).
 		For(&v1beta1.Notebook{}).
 		Owns(&v1beta1.Revision{}).
 		Owns(&corev1.Pod{}).
-		Watches(&v1beta1.Template{}, EnqueueRequestFromTemplate(mgr.GetCache(), mgr.GetLogger())).
+		Watches(&v1beta1.Template{}, enqueue).
+		Watches(&v1beta1.ClusterTemplate{}, enqueue).
+		Watches(&v1beta1.Revision{}, EnqueueRequestForRevision()).
 		Complete(r)
 }
 
@@ -59,15 +80,61 @@ func WithScheme(scheme *runtime.Scheme) Option {
 	}
 }
 
+// WithLimitRatio sets the ratio of cpu and memory limits to requests
+// on published revisions. If the ratio is zero, limits aren't set.
+func WithLimitRatio(ratio float64) Option {
+	return func(r *Reconciler) {
+		r.limitRatio = ratio
+	}
+}
+
+// WithNamespace sets the namespace the controller is running in. Templates
+// in this namespace can be referenced by Notebooks in any namespace, and
+// PodDefaults and dependencies of ClusterTemplates are read from it.
+func WithNamespace(namespace string) Option {
+	return func(r *Reconciler) {
+		r.namespace = namespace
+	}
+}
+
+// WithEventRecorder sets the recorder for Events about Notebooks. If
+// the recorder isn't provided, Events aren't recorded.
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(r *Reconciler) {
+		r.recorder = recorder
+	}
+}
+
+// WithImageResolver sets the Resolver used to pin images to digests for
+// templates with the Digest image policy. If the resolver isn't provided,
+// registries are queried directly, and digests are cached for
+// image.DefaultCacheTTL.
+func WithImageResolver(resolver image.Resolver) Option {
+	return func(r *Reconciler) {
+		r.images = resolver
+	}
+}
+
+// WithMaintenanceWindow sets the daily window in which Notebooks whose
+// Pods are out of date with their elected Revision are restarted. If the
+// window isn't provided, Pods are only brought up to date when they're
+// stopped and started.
+func WithMaintenanceWindow(window *MaintenanceWindow) Option {
+	return func(r *Reconciler) {
+		r.window = window
+	}
+}
+
 // NewReconciler returns a new Reconciler with default options
 // set as well as any options provided. If the provided options
 // conflict with the defaults, the provided options will take
 // precedence.
 func NewReconciler(cli client.Client, opts ...Option) *Reconciler {
 	r := &Reconciler{
-		client: cli,
-		scheme: cli.Scheme(),
-		logger: logr.New(nil),
+		client:     cli,
+		scheme:     cli.Scheme(),
+		logger:     logr.New(nil),
+		limitRatio: revision.DefaultLimitRatio,
 	}
 	for _, opt := range opts {
 		opt(r)
@@ -76,21 +143,36 @@ func NewReconciler(cli client.Client, opts ...Option) *Reconciler {
 }
 
 type Reconciler struct {
-	client client.Client
-	scheme *runtime.Scheme
-	logger logr.Logger
+	client   client.Client
+	scheme   *runtime.Scheme
+	logger   logr.Logger
+	recorder record.EventRecorder
 
 	// Namespace is the namespace in which the controller is running.
 	// Templates that exist in this namespace can be referenced by notebooks
 	// in other namespace. Dependencies that exist in this namespace will
 	// be copied to other namespaces when referenced by a notebook.
 	namespace string
+
+	// limitRatio is the ratio of limits to requests for cpu and memory.
+	limitRatio float64
+
+	// images resolves image tags to digests.
+	images image.Resolver
+
+	// window is when out of date Pods are restarted. Out of date Pods
+	// aren't restarted if it's nil.
+	window *MaintenanceWindow
+
+	// migrated are the UIDs of the Notebooks whose legacy revisions have
+	// been migrated. Legacy revisions aren't published anymore, so each
+	// Notebook only has to be migrated once.
+	migrated sync.Map
 }
 
 // Reconcile creates a NotebookRevision from a Notebook and Template spec. Notebook
 // revisions are created when there is a change in the Template, and sometimes a change
-// in the Notebook spec, depending on what options from the template have been selected.
-// Changing resource requests and limits in the Notebook spec will not trigger a new revision.
+// in the Notebook spec, such as the selected options, parameters, or resource requests.
 func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
 
 	nb := &v1beta1.Notebook{}
@@ -103,25 +185,144 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 	pod.SetName(nb.Name)
 	pod.SetNamespace(nb.Namespace)
 
+	if err := r.migrateRevisions(ctx, nb); err != nil {
+		r.logger.Info("unable to migrate revisions", "error", err)
+		return reconcile.Result{}, err
+	}
+
+	deprecated, err := r.deprecatedTemplate(ctx, nb)
+	if err != nil {
+		r.logger.Info("unable to resolve template", "error", err)
+		return reconcile.Result{}, err
+	}
+
+	resolved, err := r.resolveTemplate(ctx, nb)
+	if err != nil {
+		r.logger.Info("unable to resolve template", "error", err)
+		return reconcile.Result{}, err
+	}
+
 	if nb.Stopped() {
 		r.logger.Info("notebook is stopped")
-		if err := r.client.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+		if err := r.client.Delete(ctx, pod); err == nil {
+			r.event(nb, corev1.EventTypeNormal, v1beta1.ReasonPodDeleted, fmt.Sprintf("deleted pod %s because the notebook is stopped", pod.GetName()))
+		} else if !errors.IsNotFound(err) {
 			r.logger.Info("unable to delete Pod", "error", err)
 			return reconcile.Result{}, err
 		}
+
+		// Stopped notebooks are moved off templates past their sunset
+		// date. Running notebooks keep the template until they're stopped.
+		if deprecated != nil && deprecated.Sunset(time.Now()) {
+			migrated, err := r.migrate(ctx, nb, deprecated)
+			if err != nil {
+				r.logger.Info("unable to migrate notebook", "error", err)
+				return reconcile.Result{}, err
+			}
+			if migrated {
+				if deprecated, err = r.deprecatedTemplate(ctx, nb); err != nil {
+					return reconcile.Result{}, err
+				}
+				if resolved, err = r.resolveTemplate(ctx, nb); err != nil {
+					return reconcile.Result{}, err
+				}
+			}
+		}
+
 		patch := client.MergeFrom(nb.DeepCopy())
+		// A stopped notebook is rolled back now, so it starts from the
+		// revision it's pinned to.
+		if nb.Spec.RevisionRef != "" {
+			if _, err := r.rollback(ctx, r.publisher(), nb); err != nil {
+				r.logger.Info("unable to roll back notebook", "error", err)
+				return reconcile.Result{}, err
+			}
+		} else {
+			meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionRevisionPinned)
+		}
 		nb.Status.Phase = v1beta1.NotebookPhaseStopped
-		nb.Status.Conditions = pod.Status.Conditions
-		return reconcile.Result{}, r.client.Status().Patch(ctx, nb, patch)
+		nb.Status.PendingRestart = false
+		setStoppedConditions(nb)
+		if resolved {
+			setDegradedCondition(nb, "", "")
+		} else {
+			reason, message := templateNotResolved(nb)
+			setDegradedCondition(nb, reason, message)
+		}
+		r.setDeprecatedCondition(nb, deprecated)
+		return deprecationResult(deprecated), r.patchStatus(ctx, nb, patch)
 	}
 
-	if nb.Spec.TemplateRef.Namespace != r.namespace && nb.Spec.TemplateRef.Namespace != nb.Namespace {
-		r.logger.Info("templateRef namespace must be the same as the namespace of the Notebook or the system namespace")
-		return reconcile.Result{}, nil
+	if !resolved {
+		r.logger.Info("template can't be used", "template", nb.TemplateRef())
+		patch := client.MergeFrom(nb.DeepCopy())
+		nb.Status.Phase = v1beta1.NotebookPhasePending
+		setCondition(nb, v1beta1.NotebookConditionCulled, metav1.ConditionFalse, v1beta1.ReasonRunning, "the notebook isn't stopped")
+		reason, message := templateNotResolved(nb)
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(pod), pod); client.IgnoreNotFound(err) != nil {
+			return reconcile.Result{}, err
+		} else if err == nil {
+			// the pod keeps running from its revision
+			setPodConditions(nb, pod)
+			nb.Status.Phase = pod.Status.Phase
+		} else {
+			setNotRunningConditions(nb, reason, message)
+		}
+		setDegradedCondition(nb, reason, message)
+		r.setDeprecatedCondition(nb, deprecated)
+		return reconcile.Result{}, r.patchStatus(ctx, nb, patch)
 	}
 
-	return reconcile.Result{}, func() error {
-		pub := revision.NewPublisher(r.client, revision.WithLogger(r.logger))
+	result := deprecationResult(deprecated)
+	err = func() error {
+		// The status is patched from here, since the election sets
+		// conditions before any of the patches below are made.
+		patch := client.MergeFrom(nb.DeepCopy())
+		pub := r.publisher()
+		published, err := pub.List(ctx, nb)
+		if err != nil {
+			return err
+		}
+
+		// Publish a new revision if the template or any of its ancestors
+		// have changed. Whether it's elected depends on the update policy,
+		// unless the notebook is pinned to a revision with revisionRef.
+		var elected *v1beta1.Revision
+		if nb.Spec.RevisionRef != "" {
+			elected, err = r.rollback(ctx, pub, nb)
+		} else {
+			meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionRevisionPinned)
+			elected, err = pub.ElectRevision(ctx, nb)
+		}
+		if err != nil {
+			r.logger.Info("unable to elect revision", "error", err)
+			reason := v1beta1.ReasonElectionFailed
+			if invalid, ok := revision.IsInvalid(err); ok {
+				reason = invalid.Reason
+			}
+			message := fmt.Sprintf("unable to elect a revision: %s", err)
+			prev := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionElected)
+			if prev == nil || prev.Reason != reason || prev.Message != message {
+				r.event(nb, corev1.EventTypeWarning, reason, message)
+			}
+			setCondition(nb, v1beta1.NotebookConditionRevisionElected, metav1.ConditionFalse, reason, message)
+			setDegradedCondition(nb, reason, message)
+			if err := r.patchStatus(ctx, nb, patch); err != nil {
+				r.logger.Info("unable to update status", "error", err)
+			}
+			return err
+		}
+		revList, err := pub.List(ctx, nb)
+		if err != nil {
+			return err
+		}
+		r.recordRevisionEvents(nb, published, revList)
+		if elected == nil {
+			setCondition(nb, v1beta1.NotebookConditionRevisionElected, metav1.ConditionFalse, v1beta1.ReasonNoRevisionElected, "none of the notebook's revisions are elected")
+		} else {
+			setCondition(nb, v1beta1.NotebookConditionRevisionElected, metav1.ConditionTrue, v1beta1.ReasonRevisionElected, fmt.Sprintf("revision %s is elected", elected.GetName()))
+		}
+		setCondition(nb, v1beta1.NotebookConditionCulled, metav1.ConditionFalse, v1beta1.ReasonRunning, "the notebook isn't stopped")
 
 		if err := r.client.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
 			if !errors.IsNotFound(err) {
@@ -130,48 +331,75 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 			}
 
 			// When the pod doesn't exist, we need to create it from the revision.
-			elected, err := pub.Elected(ctx, nb)
-			if err != nil {
-				r.logger.Info("unable to elect revision", "error", err)
-				return err
-			}
 			if elected == nil {
 				r.logger.Info("revision not elected")
-				return nil
+				nb.Status.Phase = v1beta1.NotebookPhasePending
+				setNotRunningConditions(nb, v1beta1.ReasonNoRevisionElected, "none of the notebook's revisions are elected")
+				setDegradedCondition(nb, "", "")
+				r.setDeprecatedCondition(nb, deprecated)
+				return r.patchStatus(ctx, nb, patch)
 			}
-			data := elected.GetData()
-			spec := v1beta1.PodTemplateSpec{}
-			if err := json.Unmarshal(data, &spec); err != nil {
+			if !elected.Ready() {
+				r.logger.Info("revision not ready", "revision", elected.GetName())
+				nb.Status.Phase = v1beta1.NotebookPhasePending
+				nb.Status.PendingRestart = false
+				meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate)
+				r.setRevisionNotReadyCondition(nb, elected)
+				r.setDeprecatedCondition(nb, deprecated)
+				return r.patchStatus(ctx, nb, patch)
+			}
+			desired, err := newPod(nb, elected)
+			if err != nil {
 				r.logger.Info("unable to unmarshal revision", "error", err)
 				return err
 			}
-			if spec.Labels == nil {
-				spec.Labels = make(map[string]string)
+			pod = desired
+			if err := apply.Apply(ctx, r.client, pod); err != nil {
+				return err
 			}
-			if spec.Annotations == nil {
-				spec.Annotations = make(map[string]string)
+			r.event(nb, corev1.EventTypeNormal, v1beta1.ReasonPodCreated, fmt.Sprintf("created pod %s from revision %s", pod.GetName(), elected.GetName()))
+		}
+		// The images the pod was admitted with are recorded as soon as
+		// it's created.
+		if pod.DeletionTimestamp == nil {
+			if err := r.applyPodMetadata(ctx, nb, pod, elected); err != nil {
+				r.logger.Info("unable to apply Pod", "error", err)
+				return err
 			}
+		}
 
-			spec.Labels[LabelKeyNotebookName] = nb.Name
-			spec.Annotations[AnnotationKeyOwner] = nb.Spec.Owner.Name
-
-			pod.Spec = spec.Spec
-			pod.Labels = spec.Labels
-			pod.Annotations = spec.Annotations
-			pod.OwnerReferences = append(pod.OwnerReferences, nb.AsOwner())
-			if err := r.client.Create(ctx, pod); err != nil {
+		reason, message := "", ""
+		if elected != nil && pod.DeletionTimestamp == nil {
+			if reason, message, err = drift(pod, elected); err != nil {
+				r.logger.Info("unable to compare pod to revision", "error", err)
 				return err
 			}
 		}
-
-		revList, err := pub.List(ctx, nb)
-		if err != nil {
-			return err
+		if reason != "" && r.window != nil {
+			until := r.window.Until(time.Now())
+			if until == 0 && elected.Ready() {
+				r.logger.Info("restarting out of date pod", "revision", elected.GetName(), "reason", reason)
+				if err := r.client.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+					r.logger.Info("unable to delete Pod", "error", err)
+					return err
+				}
+				r.event(nb, corev1.EventTypeNormal, v1beta1.ReasonMaintenanceRestart,
+					fmt.Sprintf("restarted the pod during the maintenance window: %s", message))
+				nb.Status.Phase = v1beta1.NotebookPhasePending
+				setNotRunningConditions(nb, v1beta1.ReasonMaintenanceRestart, "the pod is restarting to bring it up to date with its revision")
+				r.setRevisionOutOfDateCondition(nb, "", "")
+				r.setDeprecatedCondition(nb, deprecated)
+				return r.patchStatus(ctx, nb, patch)
+			}
+			if until > 0 && (result.RequeueAfter == 0 || until < result.RequeueAfter) {
+				result.RequeueAfter = until
+			}
 		}
 
-		patch := client.MergeFrom(nb.DeepCopy())
 		nb.Status.Phase = pod.Status.Phase
-		nb.Status.Conditions = pod.Status.Conditions
+		setPodConditions(nb, pod)
+		r.setDeprecatedCondition(nb, deprecated)
+		r.setRevisionOutOfDateCondition(nb, reason, message)
 		nb.Status.Revisions = make([]v1beta1.NotebookRevision, revList.Len())
 		for k := 0; k < revList.Len(); k++ {
 			nb.Status.Revisions[k].Name = revList.Revision(k).GetName()
@@ -181,49 +409,220 @@ func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reco
 		sort.Slice(nb.Status.Revisions, func(i, j int) bool {
 			return nb.Status.Revisions[j].CreatedAt.Before(&nb.Status.Revisions[i].CreatedAt)
 		})
-		return r.client.Status().Patch(ctx, nb, patch)
+		return r.patchStatus(ctx, nb, patch)
 	}()
+	return result, err
+}
+
+func (r *Reconciler) publisher() *revision.Publisher {
+	opts := []revision.Option{
+		revision.WithLogger(r.logger),
+		revision.WithNamespace(r.namespace),
+		revision.WithLimitRatio(r.limitRatio),
+	}
+	if r.images != nil {
+		opts = append(opts, revision.WithImageResolver(r.images))
+	}
+	return revision.NewPublisher(r.client, opts...)
+}
+
+// migrateRevisions replaces the revisions published before revisions were
+// named by their hash, and updates the Notebook's revisionRef if it names
+// one of them.
+func (r *Reconciler) migrateRevisions(ctx context.Context, nb *v1beta1.Notebook) error {
+	if _, ok := r.migrated.Load(nb.UID); ok {
+		return nil
+	}
+	renamed, err := r.publisher().Migrate(ctx, nb)
+	if err != nil {
+		return err
+	}
+	if name, ok := renamed[nb.Spec.RevisionRef]; ok {
+		patch := client.MergeFrom(nb.DeepCopy())
+		nb.Spec.RevisionRef = name
+		if err := r.client.Patch(ctx, nb, patch); err != nil {
+			return err
+		}
+	}
+	r.migrated.Store(nb.UID, true)
+	return nil
+}
+
+func (r *Reconciler) event(obj runtime.Object, eventType, reason, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(obj, eventType, reason, message)
+	}
+}
+
+// recordRevisionEvents records an Event for each Revision published for
+// the Notebook since before was listed, and for the elected Revision if
+// the election changed.
+func (r *Reconciler) recordRevisionEvents(nb *v1beta1.Notebook, before, after *v1beta1.RevisionList) {
+	names := sets.New[string]()
+	prev := ""
+	for k := 0; k < before.Len(); k++ {
+		names.Insert(before.Revision(k).GetName())
+		if before.Revision(k).Elected() {
+			prev = before.Revision(k).GetName()
+		}
+	}
+	for k := 0; k < after.Len(); k++ {
+		rev := after.Revision(k)
+		if !names.Has(rev.GetName()) {
+			r.event(nb, corev1.EventTypeNormal, v1beta1.ReasonRevisionCreated, fmt.Sprintf("published revision %s", rev.GetName()))
+		}
+		if rev.Elected() && rev.GetName() != prev {
+			r.event(nb, corev1.EventTypeNormal, v1beta1.ReasonRevisionElected, fmt.Sprintf("elected revision %s", rev.GetName()))
+		}
+	}
 }
 
+// setRevisionNotReadyCondition sets the RevisionReady condition on the
+// Notebook's status, explaining why its Pod can't be created. An Event is
+// recorded when the Revision is first found not to be ready, but not while
+// it's waiting to be checked. The Notebook is degraded once the Revision
+// has been checked.
+func (r *Reconciler) setRevisionNotReadyCondition(nb *v1beta1.Notebook, rev *v1beta1.Revision) {
+	message := fmt.Sprintf("revision %s hasn't been checked yet", rev.GetName())
+	ready := meta.FindStatusCondition(rev.Status.Conditions, v1beta1.RevisionConditionReady)
+	if ready != nil {
+		message = fmt.Sprintf("revision %s isn't ready: %s", rev.GetName(), ready.Message)
+		prev := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionReady)
+		if prev == nil || prev.Message != message {
+			r.event(nb, corev1.EventTypeWarning, v1beta1.ReasonRevisionNotReady, message)
+		}
+		setDegradedCondition(nb, v1beta1.ReasonRevisionNotReady, message)
+	} else {
+		setDegradedCondition(nb, "", "")
+	}
+	setCondition(nb, v1beta1.NotebookConditionRevisionReady, metav1.ConditionFalse, v1beta1.ReasonRevisionNotReady, message)
+	setNotRunningConditions(nb, v1beta1.ReasonRevisionNotReady, message)
+}
+
+// EnqueueRequestForRevision enqueues the Notebook a Revision was published
+// for, so a Notebook waiting on its Revision to be ready is started.
+func EnqueueRequestForRevision() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		// revisions of Dag tasks can have the name of a Notebook
+		name, ok := obj.GetLabels()[revision.LabelKeyName]
+		if _, task := obj.GetLabels()[revision.LabelKeyDag]; !ok || task {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+	})
+}
+
+// EnqueueRequestFromTemplate enqueues the Notebooks that reference a Template
+// or ClusterTemplate, or reference a template that extends it.
 func EnqueueRequestFromTemplate(cache cache.Cache, logger logr.Logger) handler.EventHandler {
-	err := cache.IndexField(context.Background(), &v1beta1.Notebook{}, "spec.templateRef.name", func(o client.Object) []string {
+	err := cache.IndexField(context.Background(), &v1beta1.Notebook{}, IndexKeyTemplateRef, func(o client.Object) []string {
 		nb, ok := o.(*v1beta1.Notebook)
 		if !ok {
 			return nil
 		}
-		return []string{nb.Spec.TemplateRef.Name}
+		ref := nb.TemplateRef()
+		return []string{templateRefKey(nb.TemplateKind(), ref.Namespace, ref.Name)}
 	})
 	if err != nil {
 		panic(err)
 	}
-	err = cache.IndexField(context.Background(), &v1beta1.Notebook{}, "spec.templateRef.namespace", func(o client.Object) []string {
-		nb, ok := o.(*v1beta1.Notebook)
-		if !ok {
+	err = cache.IndexField(context.Background(), &v1beta1.Template{}, "spec.extends.name", func(o client.Object) []string {
+		t, ok := o.(*v1beta1.Template)
+		if !ok || t.Spec.Extends == nil {
 			return nil
 		}
-		return []string{nb.Spec.TemplateRef.Namespace}
+		return []string{t.Spec.Extends.Name}
 	})
 	if err != nil {
 		panic(err)
 	}
-	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
-		t, ok := obj.(*v1beta1.Template)
-		if !ok {
+	err = cache.IndexField(context.Background(), &v1beta1.ClusterTemplate{}, "spec.extends.name", func(o client.Object) []string {
+		t, ok := o.(*v1beta1.ClusterTemplate)
+		if !ok || t.Spec.Extends == nil {
 			return nil
 		}
-
-		nbList := &v1beta1.NotebookList{}
-		if err := cache.List(ctx, nbList, client.MatchingFields{
-			"spec.templateRef.name":      t.Name,
-			"spec.templateRef.namespace": t.Namespace,
-		}); err != nil {
-			logger.Info("unable to list notebooks", "error", err)
+		return []string{t.Spec.Extends.Name}
+	})
+	if err != nil {
+		panic(err)
+	}
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var kind string
+		switch obj.(type) {
+		case *v1beta1.Template:
+			kind = v1beta1.KindTemplate
+		case *v1beta1.ClusterTemplate:
+			kind = v1beta1.KindClusterTemplate
+		default:
 			return nil
 		}
-		rv := make([]reconcile.Request, 0, len(nbList.Items))
-		for _, nb := range nbList.Items {
-			rv = append(rv, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&nb)})
+
+		// Notebooks that reference a Template extending this one, directly
+		// or through another Template, need to be republished as well.
+		rv := make([]reconcile.Request, 0)
+		seen := sets.New[string](obj.GetName())
+		queue := []string{obj.GetName()}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+
+			// The cache only supports a single exact field selector, so the
+			// kind, namespace and name are queried through one index.
+			key := templateRefKey(kind, obj.GetNamespace(), name)
+			nbList := &v1beta1.NotebookList{}
+			if err := cache.List(ctx, nbList, client.MatchingFields{IndexKeyTemplateRef: key}); err != nil {
+				logger.Info("unable to list notebooks", "error", err)
+				return nil
+			}
+			for _, nb := range nbList.Items {
+				rv = append(rv, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&nb)})
+			}
+
+			children, err := listChildren(ctx, cache, kind, obj.GetNamespace(), name)
+			if err != nil {
+				logger.Info("unable to list templates", "error", err)
+				return nil
+			}
+			for _, child := range children {
+				if !seen.Has(child) {
+					seen.Insert(child)
+					queue = append(queue, child)
+				}
+			}
 		}
 		return rv
 	})
 }
+
+// templateRefKey returns the IndexKeyTemplateRef value of a template.
+// ClusterTemplates don't have a namespace.
+func templateRefKey(kind, namespace, name string) string {
+	if kind == v1beta1.KindClusterTemplate {
+		namespace = ""
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+// listChildren returns the names of the templates of the given kind that
+// extend the named template.
+func listChildren(ctx context.Context, cache cache.Cache, kind, namespace, name string) ([]string, error) {
+	names := make([]string, 0)
+	if kind == v1beta1.KindClusterTemplate {
+		children := &v1beta1.ClusterTemplateList{}
+		if err := cache.List(ctx, children, client.MatchingFields{"spec.extends.name": name}); err != nil {
+			return nil, err
+		}
+		for _, child := range children.Items {
+			names = append(names, child.Name)
+		}
+		return names, nil
+	}
+	children := &v1beta1.TemplateList{}
+	if err := cache.List(ctx, children, client.InNamespace(namespace), client.MatchingFields{"spec.extends.name": name}); err != nil {
+		return nil, err
+	}
+	for _, child := range children.Items {
+		names = append(names, child.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,41 @@
+package notebook
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+// rollback elects the Revision the Notebook's revisionRef names, and
+// recalls the current one. The Pod isn't restarted, so a running Notebook
+// uses the Revision once it's stopped and started again. If the Revision
+// doesn't exist, the current Revision stays elected, and a Warning Event
+// is recorded when the RevisionPinned condition first becomes false.
+func (r *Reconciler) rollback(ctx context.Context, pub *revision.Publisher, nb *v1beta1.Notebook) (*v1beta1.Revision, error) {
+	rev, err := pub.Get(ctx, nb, nb.Spec.RevisionRef)
+	if err != nil {
+		r.logger.Info("unable to roll back notebook", "error", err)
+		prev := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionPinned)
+		if prev == nil || prev.Status != metav1.ConditionFalse {
+			r.event(nb, corev1.EventTypeWarning, v1beta1.ReasonRollbackFailed, err.Error())
+		}
+		setCondition(nb, v1beta1.NotebookConditionRevisionPinned, metav1.ConditionFalse, v1beta1.ReasonRollbackFailed, err.Error())
+		return pub.Elected(ctx, nb)
+	}
+	setCondition(nb, v1beta1.NotebookConditionRevisionPinned, metav1.ConditionTrue, v1beta1.ReasonRolledBack,
+		fmt.Sprintf("revision %s is elected", rev.GetName()))
+	if rev.Elected() {
+		return rev, nil
+	}
+	if err := pub.Elect(ctx, nb, rev); err != nil {
+		return nil, err
+	}
+	r.event(nb, corev1.EventTypeNormal, v1beta1.ReasonRolledBack, fmt.Sprintf("rolled back to revision %s", rev.GetName()))
+	return rev, nil
+}
@@ -0,0 +1,126 @@
+package notebook
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func TestReconciler_Reconcile_Rollback(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	nb.SetUpdatePolicy(v1beta1.UpdatePolicyAuto)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newTemplate("jupyter", "jupyter:v1"), nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	recorder := record.NewFakeRecorder(100)
+	r := NewReconciler(k8s, WithEventRecorder(recorder))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	pub := revision.NewPublisher(k8s)
+
+	run := func() {
+		t.Helper()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		checkRevisions(t, k8s)
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+	}
+	update := func(fn func(nb *v1beta1.Notebook)) {
+		t.Helper()
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+		fn(nb)
+		qt.Assert(t, k8s.Update(ctx, nb), qt.IsNil)
+	}
+	setImage := func(image string) {
+		t.Helper()
+		template := &v1beta1.Template{}
+		qt.Assert(t, k8s.Get(ctx, client.ObjectKey{Name: "jupyter", Namespace: "test"}, template), qt.IsNil)
+		template.Spec.Template.Spec.Containers[0].Image = image
+		qt.Assert(t, k8s.Update(ctx, template), qt.IsNil)
+	}
+	restart := func() {
+		t.Helper()
+		update(func(nb *v1beta1.Notebook) { nb.Spec.Stopped = true })
+		run()
+		update(func(nb *v1beta1.Notebook) { nb.Spec.Stopped = false })
+		run()
+	}
+	podImage := func() string {
+		t.Helper()
+		pod := &corev1.Pod{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+		return pod.Spec.Containers[0].Image
+	}
+
+	run()
+	first, err := pub.Elected(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, podImage(), qt.Equals, "jupyter:v1")
+
+	setImage("jupyter:v2")
+	run()
+	restart()
+	qt.Assert(t, podImage(), qt.Equals, "jupyter:v2")
+
+	// rolling back elects the first revision, and new template changes
+	// aren't elected despite the Auto update policy
+	update(func(nb *v1beta1.Notebook) { nb.Spec.RevisionRef = first.GetName() })
+	setImage("jupyter:v3")
+	run()
+	elected, err := pub.Elected(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, elected.GetName(), qt.Equals, first.GetName())
+	revList, err := pub.List(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, revList.Items, qt.HasLen, 2)
+
+	// the running pod is left until the notebook restarts
+	qt.Assert(t, podImage(), qt.Equals, "jupyter:v2")
+	restart()
+	qt.Assert(t, podImage(), qt.Equals, "jupyter:v1")
+
+	events := strings.Join(drainEvents(recorder), "\n")
+	qt.Assert(t, events, qt.Contains, v1beta1.ReasonRolledBack)
+
+	// an unknown revision leaves the elected revision as it is
+	update(func(nb *v1beta1.Notebook) { nb.Spec.RevisionRef = "nb-missing" })
+	run()
+	elected, err = pub.Elected(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, elected.GetName(), qt.Equals, first.GetName())
+	qt.Assert(t, strings.Join(drainEvents(recorder), "\n"), qt.Contains, v1beta1.ReasonRollbackFailed)
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	condition := findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionPinned)
+	qt.Assert(t, condition, qt.IsNotNil)
+	qt.Assert(t, condition.Status, qt.Equals, metav1.ConditionFalse)
+
+	// the Warning is only recorded when the condition changes
+	run()
+	run()
+	qt.Assert(t, strings.Join(drainEvents(recorder), "\n"), qt.Not(qt.Contains), v1beta1.ReasonRollbackFailed)
+
+	// clearing revisionRef removes the condition
+	update(func(nb *v1beta1.Notebook) { nb.Spec.RevisionRef = "" })
+	run()
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionRevisionPinned), qt.IsNil)
+}
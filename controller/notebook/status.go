@@ -0,0 +1,196 @@
+package notebook
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+// failingContainerReasons are the reasons a container waits for that
+// won't go away on their own.
+var failingContainerReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// notebookConditionTypes are the types of the conditions set on Notebooks.
+var notebookConditionTypes = map[string]bool{
+	v1beta1.NotebookConditionTemplateResolved:   true,
+	v1beta1.NotebookConditionTemplateDeprecated: true,
+	v1beta1.NotebookConditionRevisionElected:    true,
+	v1beta1.NotebookConditionRevisionReady:      true,
+	v1beta1.NotebookConditionRevisionOutOfDate:  true,
+	v1beta1.NotebookConditionRevisionPinned:     true,
+	v1beta1.NotebookConditionPodScheduled:       true,
+	v1beta1.NotebookConditionReady:              true,
+	v1beta1.NotebookConditionCulled:             true,
+	v1beta1.NotebookConditionDegraded:           true,
+}
+
+// setCondition sets the condition on the Notebook's status, observed at
+// the Notebook's current generation. The transition time is only changed
+// when the status changes.
+func setCondition(nb *v1beta1.Notebook, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&nb.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: nb.GetGeneration(),
+	})
+}
+
+// patchStatus patches the Notebook's status, recording the generation it
+// was computed for.
+func (r *Reconciler) patchStatus(ctx context.Context, nb *v1beta1.Notebook, patch client.Patch) error {
+	nb.Status.ObservedGeneration = nb.GetGeneration()
+	pruneConditions(nb)
+	return r.client.Status().Patch(ctx, nb, patch)
+}
+
+// pruneConditions removes the conditions of types the Notebook doesn't
+// set, and the conditions without a reason. Older versions copied the
+// Pod's conditions, such as Initialized and ContainersReady, which don't
+// always have a reason, and the API server rejects every status patch
+// while they're there.
+func pruneConditions(nb *v1beta1.Notebook) {
+	conditions := make([]metav1.Condition, 0, len(nb.Status.Conditions))
+	for _, condition := range nb.Status.Conditions {
+		if notebookConditionTypes[condition.Type] && condition.Reason != "" {
+			conditions = append(conditions, condition)
+		}
+	}
+	nb.Status.Conditions = conditions
+}
+
+// resolveTemplate sets the TemplateResolved condition, and returns false
+// if the Notebook can't use its template. An Event is recorded when the
+// template is first found to be unusable, or the reason changes.
+func (r *Reconciler) resolveTemplate(ctx context.Context, nb *v1beta1.Notebook) (bool, error) {
+	ref := nb.TemplateRef()
+	if nb.TemplateKind() == v1beta1.KindTemplate && ref.Namespace != r.namespace && ref.Namespace != nb.Namespace {
+		r.setTemplateNotResolvedCondition(nb, v1beta1.ReasonTemplateNotAllowed,
+			fmt.Sprintf("%s %q must be in the namespace of the Notebook or the system namespace", nb.TemplateKind(), ref.Name))
+		return false, nil
+	}
+	if _, err := revision.ResolveTemplate(ctx, r.client, nb.TemplateKind(), ref); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		r.setTemplateNotResolvedCondition(nb, v1beta1.ReasonTemplateNotFound,
+			fmt.Sprintf("%s %q not found", nb.TemplateKind(), ref.Name))
+		return false, nil
+	}
+	setCondition(nb, v1beta1.NotebookConditionTemplateResolved, metav1.ConditionTrue, v1beta1.ReasonTemplateResolved,
+		fmt.Sprintf("%s %q found", nb.TemplateKind(), ref.Name))
+	return true, nil
+}
+
+func (r *Reconciler) setTemplateNotResolvedCondition(nb *v1beta1.Notebook, reason, message string) {
+	prev := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateResolved)
+	if prev == nil || prev.Reason != reason {
+		r.event(nb, corev1.EventTypeWarning, reason, message)
+	}
+	setCondition(nb, v1beta1.NotebookConditionTemplateResolved, metav1.ConditionFalse, reason, message)
+}
+
+// setNotRunningConditions sets the conditions of a Notebook that doesn't
+// have a Pod, with the reason and message explaining why.
+func setNotRunningConditions(nb *v1beta1.Notebook, reason, message string) {
+	setCondition(nb, v1beta1.NotebookConditionPodScheduled, metav1.ConditionFalse, v1beta1.ReasonPodNotCreated, message)
+	setCondition(nb, v1beta1.NotebookConditionReady, metav1.ConditionFalse, reason, message)
+}
+
+// setDegradedCondition sets the Degraded condition. The Notebook is
+// degraded if the reason isn't empty.
+func setDegradedCondition(nb *v1beta1.Notebook, reason, message string) {
+	if reason == "" {
+		setCondition(nb, v1beta1.NotebookConditionDegraded, metav1.ConditionFalse, v1beta1.ReasonAsExpected, "the notebook is running as expected")
+		return
+	}
+	setCondition(nb, v1beta1.NotebookConditionDegraded, metav1.ConditionTrue, reason, message)
+}
+
+// setStoppedConditions sets the conditions of a stopped Notebook.
+func setStoppedConditions(nb *v1beta1.Notebook) {
+	message := "the notebook is stopped"
+	setCondition(nb, v1beta1.NotebookConditionPodScheduled, metav1.ConditionFalse, v1beta1.ReasonStopped, message)
+	setCondition(nb, v1beta1.NotebookConditionReady, metav1.ConditionFalse, v1beta1.ReasonStopped, message)
+	setCondition(nb, v1beta1.NotebookConditionCulled, metav1.ConditionTrue, v1beta1.ReasonStopped, "the notebook is stopped, so its pod was removed")
+	meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionRevisionReady)
+	meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionRevisionOutOfDate)
+}
+
+// setPodConditions sets the conditions of a Notebook from its Pod.
+func setPodConditions(nb *v1beta1.Notebook, pod *corev1.Pod) {
+	setCondition(nb, v1beta1.NotebookConditionCulled, metav1.ConditionFalse, v1beta1.ReasonRunning, "the notebook isn't stopped")
+	meta.RemoveStatusCondition(&nb.Status.Conditions, v1beta1.NotebookConditionRevisionReady)
+
+	scheduled := podCondition(pod, corev1.PodScheduled)
+	switch {
+	case scheduled == nil:
+		setCondition(nb, v1beta1.NotebookConditionPodScheduled, metav1.ConditionUnknown, v1beta1.ReasonPodNotReady, "waiting for the pod to be scheduled")
+	case scheduled.Status == corev1.ConditionTrue:
+		setCondition(nb, v1beta1.NotebookConditionPodScheduled, metav1.ConditionTrue, v1beta1.ReasonPodScheduled, "the pod is scheduled")
+	default:
+		reason := scheduled.Reason
+		if reason == "" {
+			reason = v1beta1.ReasonPodNotReady
+		}
+		setCondition(nb, v1beta1.NotebookConditionPodScheduled, metav1.ConditionStatus(scheduled.Status), reason, scheduled.Message)
+	}
+
+	if ready := podCondition(pod, corev1.PodReady); ready != nil && ready.Status == corev1.ConditionTrue {
+		setCondition(nb, v1beta1.NotebookConditionReady, metav1.ConditionTrue, v1beta1.ReasonPodReady, "the pod is ready")
+	} else {
+		message := "the pod isn't ready"
+		if ready != nil && ready.Message != "" {
+			message = ready.Message
+		}
+		setCondition(nb, v1beta1.NotebookConditionReady, metav1.ConditionFalse, v1beta1.ReasonPodNotReady, message)
+	}
+
+	if pod.Status.Phase == corev1.PodFailed {
+		setDegradedCondition(nb, v1beta1.ReasonPodFailed, fmt.Sprintf("the pod failed: %s", pod.Status.Message))
+		return
+	}
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if status.State.Waiting != nil && failingContainerReasons[status.State.Waiting.Reason] {
+			setDegradedCondition(nb, v1beta1.ReasonContainerFailing,
+				fmt.Sprintf("container %s is waiting: %s: %s", status.Name, status.State.Waiting.Reason, status.State.Waiting.Message))
+			return
+		}
+	}
+	setDegradedCondition(nb, "", "")
+}
+
+func podCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for k := range pod.Status.Conditions {
+		if pod.Status.Conditions[k].Type == conditionType {
+			return &pod.Status.Conditions[k]
+		}
+	}
+	return nil
+}
+
+// templateNotResolved returns the reason and message of the
+// TemplateResolved condition.
+func templateNotResolved(nb *v1beta1.Notebook) (string, string) {
+	condition := meta.FindStatusCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateResolved)
+	if condition == nil {
+		return v1beta1.ReasonTemplateNotFound, "the template hasn't been resolved"
+	}
+	return condition.Reason, condition.Message
+}
@@ -0,0 +1,179 @@
+package notebook
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+)
+
+func TestReconciler_Reconcile_Conditions(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	nb.SetGeneration(2)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(nb).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	run := func() {
+		t.Helper()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		checkRevisions(t, k8s)
+		_, err = r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	}
+	type want struct {
+		status metav1.ConditionStatus
+		reason string
+	}
+	assertConditions := func(t *testing.T, conditions map[string]want) {
+		t.Helper()
+		for conditionType, w := range conditions {
+			condition := findCondition(nb.Status.Conditions, conditionType)
+			qt.Assert(t, condition, qt.IsNotNil, qt.Commentf("%s", conditionType))
+			qt.Assert(t, condition.Status, qt.Equals, w.status, qt.Commentf("%s", conditionType))
+			qt.Assert(t, condition.Reason, qt.Equals, w.reason, qt.Commentf("%s", conditionType))
+			qt.Assert(t, condition.ObservedGeneration, qt.Equals, int64(2), qt.Commentf("%s", conditionType))
+		}
+		qt.Assert(t, nb.Status.ObservedGeneration, qt.Equals, int64(2))
+	}
+	updatePod := func(fn func(pod *corev1.Pod)) {
+		t.Helper()
+		pod := &corev1.Pod{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, pod), qt.IsNil)
+		fn(pod)
+		qt.Assert(t, k8s.Status().Update(ctx, pod), qt.IsNil)
+	}
+
+	t.Run("TemplateNotFound", func(t *testing.T) {
+		run()
+		assertConditions(t, map[string]want{
+			v1beta1.NotebookConditionTemplateResolved: {metav1.ConditionFalse, v1beta1.ReasonTemplateNotFound},
+			v1beta1.NotebookConditionReady:            {metav1.ConditionFalse, v1beta1.ReasonTemplateNotFound},
+			v1beta1.NotebookConditionDegraded:         {metav1.ConditionTrue, v1beta1.ReasonTemplateNotFound},
+			v1beta1.NotebookConditionCulled:           {metav1.ConditionFalse, v1beta1.ReasonRunning},
+		})
+		qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateResolved).Message,
+			qt.Equals, `Template "jupyter" not found`)
+	})
+	t.Run("PodNotReady", func(t *testing.T) {
+		qt.Assert(t, k8s.Create(ctx, newTemplate("jupyter", "jupyter:v1")), qt.IsNil)
+		run()
+		assertConditions(t, map[string]want{
+			v1beta1.NotebookConditionTemplateResolved: {metav1.ConditionTrue, v1beta1.ReasonTemplateResolved},
+			v1beta1.NotebookConditionRevisionElected:  {metav1.ConditionTrue, v1beta1.ReasonRevisionElected},
+			v1beta1.NotebookConditionPodScheduled:     {metav1.ConditionUnknown, v1beta1.ReasonPodNotReady},
+			v1beta1.NotebookConditionReady:            {metav1.ConditionFalse, v1beta1.ReasonPodNotReady},
+			v1beta1.NotebookConditionDegraded:         {metav1.ConditionFalse, v1beta1.ReasonAsExpected},
+		})
+	})
+	t.Run("PodReady", func(t *testing.T) {
+		updatePod(func(pod *corev1.Pod) {
+			pod.Status.Phase = corev1.PodRunning
+			pod.Status.Conditions = []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			}
+		})
+		run()
+		assertConditions(t, map[string]want{
+			v1beta1.NotebookConditionPodScheduled: {metav1.ConditionTrue, v1beta1.ReasonPodScheduled},
+			v1beta1.NotebookConditionReady:        {metav1.ConditionTrue, v1beta1.ReasonPodReady},
+			v1beta1.NotebookConditionDegraded:     {metav1.ConditionFalse, v1beta1.ReasonAsExpected},
+		})
+		qt.Assert(t, nb.Status.Phase, qt.Equals, corev1.PodRunning)
+	})
+	t.Run("CrashLooping", func(t *testing.T) {
+		updatePod(func(pod *corev1.Pod) {
+			pod.Status.Conditions = []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+				{Type: corev1.PodReady, Status: corev1.ConditionFalse, Message: "containers with unready status: [main]"},
+			}
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  "main",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}}
+		})
+		run()
+		assertConditions(t, map[string]want{
+			v1beta1.NotebookConditionReady:    {metav1.ConditionFalse, v1beta1.ReasonPodNotReady},
+			v1beta1.NotebookConditionDegraded: {metav1.ConditionTrue, v1beta1.ReasonContainerFailing},
+		})
+		qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionDegraded).Message,
+			qt.Contains, "container main is waiting: CrashLoopBackOff")
+	})
+	t.Run("Stopped", func(t *testing.T) {
+		nb.Spec.Stopped = true
+		qt.Assert(t, k8s.Update(ctx, nb), qt.IsNil)
+		run()
+		assertConditions(t, map[string]want{
+			v1beta1.NotebookConditionTemplateResolved: {metav1.ConditionTrue, v1beta1.ReasonTemplateResolved},
+			v1beta1.NotebookConditionPodScheduled:     {metav1.ConditionFalse, v1beta1.ReasonStopped},
+			v1beta1.NotebookConditionReady:            {metav1.ConditionFalse, v1beta1.ReasonStopped},
+			v1beta1.NotebookConditionCulled:           {metav1.ConditionTrue, v1beta1.ReasonStopped},
+			v1beta1.NotebookConditionDegraded:         {metav1.ConditionFalse, v1beta1.ReasonAsExpected},
+		})
+	})
+}
+
+func TestReconciler_Reconcile_PodConditions(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := newNotebook("nb", "jupyter", false)
+	// Older versions copied the Pod's conditions, which don't have a
+	// reason.
+	nb.Status.Conditions = []metav1.Condition{
+		{Type: string(corev1.PodInitialized), Status: metav1.ConditionTrue},
+		{Type: string(corev1.ContainersReady), Status: metav1.ConditionTrue},
+		{Type: string(corev1.PodScheduled), Status: metav1.ConditionTrue},
+		{Type: string(corev1.PodReady), Status: metav1.ConditionTrue},
+	}
+	funcs := applytest.Funcs()
+	// The API server rejects conditions without a reason.
+	funcs.SubResourcePatch = func(ctx context.Context, c client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+		for _, condition := range obj.(*v1beta1.Notebook).Status.Conditions {
+			if condition.Reason == "" {
+				return errors.Errorf("condition %s has no reason", condition.Type)
+			}
+		}
+		return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(nb, newTemplate("jupyter", "jupyter:v1")).
+		WithStatusSubresource(&v1beta1.Notebook{}, &v1beta1.Revision{}).
+		WithInterceptorFuncs(funcs).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(nb)}
+	for i := 0; i < 2; i++ {
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+	}
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, nb), qt.IsNil)
+	qt.Assert(t, findCondition(nb.Status.Conditions, string(corev1.PodInitialized)), qt.IsNil)
+	qt.Assert(t, findCondition(nb.Status.Conditions, string(corev1.ContainersReady)), qt.IsNil)
+	for _, condition := range nb.Status.Conditions {
+		qt.Assert(t, condition.Reason, qt.Not(qt.Equals), "", qt.Commentf("%s", condition.Type))
+	}
+	qt.Assert(t, findCondition(nb.Status.Conditions, v1beta1.NotebookConditionTemplateResolved), qt.IsNotNil)
+}
@@ -0,0 +1,119 @@
+package notebook
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+var (
+	_ admission.CustomValidator = &Validator{}
+)
+
+// SetupWebhook adds the Notebook validating webhook to manager.Manager.
+func SetupWebhook(mgr manager.Manager) error {
+	return builder.WebhookManagedBy(mgr).
+		For(&v1beta1.Notebook{}).
+		WithValidator(NewValidator(mgr.GetClient())).
+		Complete()
+}
+
+// NewValidator returns a Validator that reads templates with
+// the provided client.
+func NewValidator(c client.Reader) *Validator {
+	return &Validator{client: c}
+}
+
+// Validator rejects Notebooks that can't be published from the
+// Template they reference.
+type Validator struct {
+	client client.Reader
+}
+
+func (v *Validator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	nb, ok := obj.(*v1beta1.Notebook)
+	if !ok {
+		return nil, fmt.Errorf("expected a Notebook but got %T", obj)
+	}
+	return v.validate(ctx, nb)
+}
+
+func (v *Validator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	nb, ok := newObj.(*v1beta1.Notebook)
+	if !ok {
+		return nil, fmt.Errorf("expected a Notebook but got %T", newObj)
+	}
+	old, ok := oldObj.(*v1beta1.Notebook)
+	if !ok {
+		return nil, fmt.Errorf("expected a Notebook but got %T", oldObj)
+	}
+	// The template may have been deleted or changed since the Notebook
+	// was created, which mustn't stop users from stopping or starting it.
+	if !templateInputsChanged(old, nb) {
+		return nil, nil
+	}
+	return v.validate(ctx, nb)
+}
+
+func (v *Validator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *Validator) validate(ctx context.Context, nb *v1beta1.Notebook) (admission.Warnings, error) {
+	template, err := revision.ResolveReferrerTemplate(ctx, v.client, nb)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%s %q not found", nb.TemplateKind(), nb.Spec.TemplateRef.Name)
+		}
+		return nil, err
+	}
+	if err := validateTemplate(template, nb); err != nil {
+		return nil, err
+	}
+
+	// A pinned revision may predate the deprecation, so the warning comes
+	// from the template as it is now.
+	current, err := revision.ResolveTemplate(ctx, v.client, nb.TemplateKind(), nb.TemplateRef())
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if current.Deprecated() {
+		return admission.Warnings{current.DeprecationMessage()}, nil
+	}
+	return nil, nil
+}
+
+// templateInputsChanged returns true if any of the fields that are
+// validated against the template changed.
+func templateInputsChanged(old, nb *v1beta1.Notebook) bool {
+	return !equality.Semantic.DeepEqual(old.Spec.TemplateRef, nb.Spec.TemplateRef) ||
+		!equality.Semantic.DeepEqual(old.Spec.Options, nb.Spec.Options) ||
+		!equality.Semantic.DeepEqual(old.Spec.Parameters, nb.Spec.Parameters) ||
+		!equality.Semantic.DeepEqual(old.Spec.ResourceRequests, nb.Spec.ResourceRequests) ||
+		old.Spec.Preset != nb.Spec.Preset
+}
+
+// validateTemplate returns an error if the Notebook's parameters, options
+// or resources aren't valid for the template.
+func validateTemplate(template *v1beta1.Template, nb *v1beta1.Notebook) error {
+	if _, err := template.ResolveParameters(nb.ParameterValues()); err != nil {
+		return err
+	}
+	if err := template.ValidateOptions(nb.Spec.Options); err != nil {
+		return err
+	}
+	if _, err := template.ResolveResources(nb.ResourcePreset(), nb.ResourceRequests()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,427 @@
+package revision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/dependency"
+	revisions "github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+var (
+	_ reconcile.Reconciler = &Reconciler{}
+
+	// imagePullReasons are the reasons a container waits when its
+	// image can't be pulled.
+	imagePullReasons = sets.New[string](
+		"ErrImagePull",
+		"ImagePullBackOff",
+		"InvalidImageName",
+		"ErrImageNeverPull",
+	)
+	// transientImagePullReasons are the image pull failures that may go
+	// away on their own, such as when a registry is briefly unavailable.
+	transientImagePullReasons = sets.New[string](
+		"ErrImagePull",
+		"ImagePullBackOff",
+	)
+)
+
+const (
+	// IndexKeyReferences indexes Revisions by the objects in their
+	// namespace that their readiness depends on, as kind/name.
+	IndexKeyReferences = "spec.references"
+
+	// DefaultImagePullGracePeriod is how long the pods started from a
+	// Revision can fail to pull an image before the Revision isn't ready.
+	DefaultImagePullGracePeriod = 5 * time.Minute
+)
+
+// Setup adds the Revision controller to manager.Manager. Any options
+// provided are applied after the defaults. Only the metadata of the
+// objects Revisions reference is watched, and only the pods started from
+// Revisions are cached.
+func Setup(mgr manager.Manager, opts ...Option) error {
+	pods, err := NewRevisionPodCache(mgr)
+	if err != nil {
+		return err
+	}
+	if err := mgr.Add(pods); err != nil {
+		return err
+	}
+
+	r := NewReconciler(mgr.GetClient(), append([]Option{
+		WithLogger(mgr.GetLogger().WithName("revision-controller")),
+		WithPodReader(pods),
+	}, opts...)...)
+
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &v1beta1.Revision{}, IndexKeyReferences, References)
+	if err != nil {
+		return err
+	}
+	c, logger := mgr.GetClient(), mgr.GetLogger()
+	return builder.ControllerManagedBy(mgr).
+		For(&v1beta1.Revision{}).
+		WatchesRawSource(source.Kind(pods, &corev1.Pod{}), EnqueueRequestForPod()).
+		WatchesMetadata(&corev1.Secret{}, EnqueueRequestsForReference(c, "Secret", logger)).
+		WatchesMetadata(&corev1.ConfigMap{}, EnqueueRequestsForReference(c, "ConfigMap", logger)).
+		WatchesMetadata(&corev1.PersistentVolumeClaim{}, EnqueueRequestsForReference(c, "PersistentVolumeClaim", logger)).
+		WatchesMetadata(&corev1.ServiceAccount{}, EnqueueRequestsForReference(c, "ServiceAccount", logger)).
+		Complete(r)
+}
+
+// NewRevisionPodCache returns a cache that only holds the pods started
+// from Revisions, so checking their images doesn't need an informer for
+// every pod in the cluster.
+func NewRevisionPodCache(mgr manager.Manager) (cache.Cache, error) {
+	selector, err := labels.Parse(revisions.LabelKeyRevision)
+	if err != nil {
+		return nil, err
+	}
+	return cache.New(mgr.GetConfig(), cache.Options{
+		Scheme: mgr.GetScheme(),
+		Mapper: mgr.GetRESTMapper(),
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Pod{}: {Label: selector},
+		},
+	})
+}
+
+type Option func(r *Reconciler)
+
+func WithLogger(logger logr.Logger) Option {
+	return func(r *Reconciler) {
+		r.logger = logger
+	}
+}
+
+// WithImagePullGracePeriod sets how long the pods started from a Revision
+// can fail to pull an image before the Revision isn't ready. Images can
+// fail to pull for a while when a registry is briefly unavailable.
+func WithImagePullGracePeriod(period time.Duration) Option {
+	return func(r *Reconciler) {
+		r.pullGracePeriod = period
+	}
+}
+
+// WithPodReader sets the reader the pods started from a Revision are
+// listed with. If the reader isn't provided, the client is used.
+func WithPodReader(pods client.Reader) Option {
+	return func(r *Reconciler) {
+		r.pods = pods
+	}
+}
+
+// NewReconciler returns a new Reconciler with default options
+// set as well as any options provided.
+func NewReconciler(c client.Client, opts ...Option) *Reconciler {
+	r := &Reconciler{
+		client:          c,
+		logger:          logr.New(nil),
+		propagator:      dependency.NewPropagator(c),
+		pullGracePeriod: DefaultImagePullGracePeriod,
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.pods == nil {
+		r.pods = r.client
+	}
+	return r
+}
+
+// Reconciler sets the readiness conditions of Revisions. A Revision is
+// ready when its dependencies are copied, the objects its pod template
+// references exist, and the pods started from it can pull their images.
+type Reconciler struct {
+	client          client.Client
+	pods            client.Reader
+	logger          logr.Logger
+	propagator      *dependency.Propagator
+	pullGracePeriod time.Duration
+	now             func() time.Time
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger := r.logger.WithValues("name", req.Name, "namespace", req.Namespace)
+
+	rev := &v1beta1.Revision{}
+	if err := r.client.Get(ctx, req.NamespacedName, rev); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	spec := v1beta1.PodTemplateSpec{}
+	if err := json.Unmarshal(rev.GetData(), &spec); err != nil {
+		logger.Info("unable to unmarshal revision", "error", err)
+		return reconcile.Result{}, nil
+	}
+
+	checks := make([]metav1.Condition, 0, 3)
+	for _, check := range []func(context.Context, *v1beta1.Revision, *corev1.PodSpec) (metav1.Condition, error){
+		r.dependenciesCopied,
+		r.referencesResolved,
+		r.imagesPullable,
+	} {
+		condition, err := check(ctx, rev, &spec.Spec)
+		if err != nil {
+			logger.Info("unable to check revision readiness", "error", err)
+			return reconcile.Result{}, err
+		}
+		checks = append(checks, condition)
+	}
+
+	patch := client.MergeFrom(rev.DeepCopy())
+	ready := metav1.Condition{
+		Type:    v1beta1.RevisionConditionReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1beta1.ReasonRevisionReady,
+		Message: "workloads can be started from the revision",
+	}
+	for _, condition := range checks {
+		condition.ObservedGeneration = rev.GetGeneration()
+		meta.SetStatusCondition(&rev.Status.Conditions, condition)
+		if condition.Status == metav1.ConditionFalse && ready.Status == metav1.ConditionTrue {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = v1beta1.ReasonRevisionNotReady
+			ready.Message = condition.Message
+		}
+	}
+	ready.ObservedGeneration = rev.GetGeneration()
+	meta.SetStatusCondition(&rev.Status.Conditions, ready)
+	rev.Status.Ready = ready.Status == metav1.ConditionTrue
+	if err := r.client.Status().Patch(ctx, rev, patch); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Check again when the grace period of failing image pulls ends.
+	result := reconcile.Result{}
+	pullable := meta.FindStatusCondition(rev.Status.Conditions, v1beta1.RevisionConditionImagesPullable)
+	if pullable != nil && pullable.Reason == v1beta1.ReasonImagePullBackOff {
+		result.RequeueAfter = pullable.LastTransitionTime.Add(r.pullGracePeriod).Sub(r.now())
+		if result.RequeueAfter <= 0 {
+			result.RequeueAfter = time.Second
+		}
+	}
+	return result, nil
+}
+
+// dependenciesCopied checks that the copies of the Revision's dependencies
+// exist in its namespace. Copies that were deleted are copied again first.
+func (r *Reconciler) dependenciesCopied(ctx context.Context, rev *v1beta1.Revision, _ *corev1.PodSpec) (metav1.Condition, error) {
+	condition := metav1.Condition{
+		Type:    v1beta1.RevisionConditionDependenciesCopied,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1beta1.RevisionConditionDependenciesCopied,
+		Message: "all dependencies are copied",
+	}
+	if err := r.propagator.Restore(ctx, rev); err != nil {
+		return condition, err
+	}
+	missing, err := r.propagator.Missing(ctx, rev)
+	if err != nil {
+		return condition, err
+	}
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for _, ref := range missing {
+			names = append(names, fmt.Sprintf("%s %s", ref.Kind, ref.Name))
+		}
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = v1beta1.ReasonDependencyMissing
+		condition.Message = "dependencies aren't copied: " + strings.Join(names, ", ")
+	}
+	return condition, nil
+}
+
+// referencesResolved checks that the objects the pod template references
+// exist, unless the pod can run without them.
+func (r *Reconciler) referencesResolved(ctx context.Context, rev *v1beta1.Revision, spec *corev1.PodSpec) (metav1.Condition, error) {
+	condition := metav1.Condition{
+		Type:    v1beta1.RevisionConditionReferencesResolved,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1beta1.RevisionConditionReferencesResolved,
+		Message: "all referenced objects exist",
+	}
+
+	refs := sets.New[string]()
+	dependency.VisitReferences(spec, func(kind string, name *string, optional bool) {
+		if !optional {
+			refs.Insert(kind + " " + *name)
+		}
+	})
+
+	missing := make([]string, 0)
+	for _, ref := range sets.List(refs) {
+		kind, name, _ := strings.Cut(ref, " ")
+		// Only the metadata is read, so the objects, such as Secrets,
+		// aren't cached.
+		obj := &metav1.PartialObjectMetadata{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(kind))
+		if err := r.client.Get(ctx, types.NamespacedName{Namespace: rev.GetNamespace(), Name: name}, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return condition, err
+			}
+			missing = append(missing, ref)
+		}
+	}
+	if len(missing) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = v1beta1.ReasonReferenceMissing
+		condition.Message = "referenced objects don't exist: " + strings.Join(missing, ", ")
+	}
+	return condition, nil
+}
+
+// imagesPullable checks the pods started from the Revision for containers
+// that are waiting on an image that can't be pulled. Pulls that are backing
+// off may succeed once the registry is available again, so the Revision is
+// only not ready once they've been failing for the grace period, and until
+// then the condition is unknown.
+func (r *Reconciler) imagesPullable(ctx context.Context, rev *v1beta1.Revision, _ *corev1.PodSpec) (metav1.Condition, error) {
+	condition := metav1.Condition{
+		Type:    v1beta1.RevisionConditionImagesPullable,
+		Status:  metav1.ConditionTrue,
+		Reason:  v1beta1.RevisionConditionImagesPullable,
+		Message: "images were pulled",
+	}
+
+	podList := &corev1.PodList{}
+	err := r.pods.List(ctx, podList,
+		client.InNamespace(rev.GetNamespace()),
+		client.MatchingLabels{revisions.LabelKeyRevision: rev.GetName()},
+	)
+	if err != nil {
+		return condition, err
+	}
+	if len(podList.Items) == 0 {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = v1beta1.ReasonNoPods
+		condition.Message = "no pods have been started from the revision"
+		return condition, nil
+	}
+
+	failed := make([]string, 0)
+	persistent := false
+	for _, pod := range podList.Items {
+		statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		for _, status := range append(statuses, pod.Status.ContainerStatuses...) {
+			if status.State.Waiting == nil || !imagePullReasons.Has(status.State.Waiting.Reason) {
+				continue
+			}
+			if !transientImagePullReasons.Has(status.State.Waiting.Reason) {
+				persistent = true
+			}
+			msg := fmt.Sprintf("pod %s container %s: %s", pod.Name, status.Name, status.State.Waiting.Reason)
+			if status.State.Waiting.Message != "" {
+				msg += ": " + status.State.Waiting.Message
+			}
+			failed = append(failed, msg)
+		}
+	}
+	if len(failed) == 0 {
+		return condition, nil
+	}
+	sort.Strings(failed)
+	condition.Message = "images can't be pulled: " + strings.Join(failed, "; ")
+
+	// The transition time of the condition is when the pulls started
+	// failing, and it's kept while the pulls keep backing off.
+	since := r.now()
+	prev := meta.FindStatusCondition(rev.Status.Conditions, v1beta1.RevisionConditionImagesPullable)
+	if prev != nil && prev.Reason == v1beta1.ReasonImagePullBackOff {
+		since = prev.LastTransitionTime.Time
+	}
+	if persistent || r.now().Sub(since) >= r.pullGracePeriod {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = v1beta1.ReasonImagePullFailed
+		return condition, nil
+	}
+	if prev != nil && prev.Reason != v1beta1.ReasonImagePullBackOff {
+		// The condition may already be unknown because there weren't any
+		// pods, which wouldn't change its transition time.
+		meta.RemoveStatusCondition(&rev.Status.Conditions, v1beta1.RevisionConditionImagesPullable)
+	}
+	condition.Status = metav1.ConditionUnknown
+	condition.Reason = v1beta1.ReasonImagePullBackOff
+	condition.LastTransitionTime = metav1.NewTime(since)
+	return condition, nil
+}
+
+// EnqueueRequestForPod enqueues the Revision a pod was started from.
+func EnqueueRequestForPod() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		name, ok := obj.GetLabels()[revisions.LabelKeyRevision]
+		if !ok {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+	})
+}
+
+// EnqueueRequestsForReference enqueues the Revisions in the namespace of
+// the object of the kind that reference it, so they're checked again.
+func EnqueueRequestsForReference(c client.Reader, kind string, logger logr.Logger) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		revList := &v1beta1.RevisionList{}
+		err := c.List(ctx, revList,
+			client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{IndexKeyReferences: kind + "/" + obj.GetName()},
+		)
+		if err != nil {
+			logger.Info("unable to list revisions", "error", err)
+			return nil
+		}
+		rv := make([]reconcile.Request, 0, revList.Len())
+		for k := range revList.Items {
+			rv = append(rv, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&revList.Items[k])})
+		}
+		return rv
+	})
+}
+
+// References returns the objects in its namespace that the readiness of
+// the Revision depends on, as kind/name. They're the objects its pod
+// template can't run without, and the copies of its dependencies.
+func References(obj client.Object) []string {
+	rev, ok := obj.(*v1beta1.Revision)
+	if !ok {
+		return nil
+	}
+	refs := sets.New[string]()
+	spec := v1beta1.PodTemplateSpec{}
+	if err := json.Unmarshal(rev.GetData(), &spec); err == nil {
+		dependency.VisitReferences(&spec.Spec, func(kind string, name *string, optional bool) {
+			if !optional {
+				refs.Insert(kind + "/" + *name)
+			}
+		})
+	}
+	if copies, err := dependency.Recorded(rev); err == nil {
+		for _, ref := range copies {
+			refs.Insert(ref.Kind + "/" + ref.Name)
+		}
+	}
+	return sets.List(refs)
+}
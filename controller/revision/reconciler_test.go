@@ -0,0 +1,248 @@
+package revision
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/dependency"
+	revisions "github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func newRevision(t *testing.T, spec corev1.PodSpec, copies ...dependency.Dependency) *v1beta1.Revision {
+	t.Helper()
+	rev := &v1beta1.Revision{ObjectMeta: metav1.ObjectMeta{
+		Name:      "nb-1",
+		Namespace: "test",
+		Labels:    map[string]string{revisions.LabelKeyName: "nb"},
+	}}
+	raw, err := json.Marshal(v1beta1.PodTemplateSpec{Spec: spec})
+	qt.Assert(t, err, qt.IsNil)
+	rev.SetData(raw)
+	qt.Assert(t, dependency.Annotate(rev, copies), qt.IsNil)
+	return rev
+}
+
+func newPod(name, reason string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "test",
+		Labels:    map[string]string{revisions.LabelKeyRevision: "nb-1"},
+	}}
+	status := corev1.ContainerStatus{Name: "main"}
+	if reason != "" {
+		status.State.Waiting = &corev1.ContainerStateWaiting{Reason: reason, Message: "not found"}
+	}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{status}
+	return pod
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	spec := corev1.PodSpec{
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+		Volumes: []corev1.Volume{{Name: "pypi", VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: "pypi"},
+		}}},
+		Containers: []corev1.Container{{
+			Name:  "main",
+			Image: "jupyter:v1",
+			EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "settings"},
+			}}},
+		}},
+	}
+	s3 := dependency.Dependency{
+		LocalObjectReference: v1beta1.LocalObjectReference{Name: "s3", APIVersion: "v1", Kind: "Secret"},
+		Namespace:            "system",
+	}
+	rev := newRevision(t, spec, s3)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(rev).
+		WithStatusSubresource(&v1beta1.Revision{}).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s)
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(rev)}
+	check := func() *v1beta1.Revision {
+		t.Helper()
+		_, err := r.Reconcile(ctx, req)
+		qt.Assert(t, err, qt.IsNil)
+		rev := &v1beta1.Revision{}
+		qt.Assert(t, k8s.Get(ctx, req.NamespacedName, rev), qt.IsNil)
+		return rev
+	}
+	condition := func(rev *v1beta1.Revision, conditionType string) *metav1.Condition {
+		t.Helper()
+		c := meta.FindStatusCondition(rev.Status.Conditions, conditionType)
+		qt.Assert(t, c, qt.IsNotNil)
+		return c
+	}
+	create := func(obj client.Object) {
+		t.Helper()
+		obj.SetNamespace("test")
+		qt.Assert(t, k8s.Create(ctx, obj), qt.IsNil)
+	}
+
+	got := check()
+	qt.Assert(t, got.Ready(), qt.IsFalse)
+	qt.Assert(t, condition(got, v1beta1.RevisionConditionDependenciesCopied).Reason, qt.Equals, v1beta1.ReasonDependencyMissing)
+	qt.Assert(t, condition(got, v1beta1.RevisionConditionDependenciesCopied).Message, qt.Contains, "Secret s3")
+	references := condition(got, v1beta1.RevisionConditionReferencesResolved)
+	qt.Assert(t, references.Status, qt.Equals, metav1.ConditionFalse)
+	qt.Assert(t, references.Message, qt.Equals, "referenced objects don't exist: ConfigMap settings, Secret pypi")
+	qt.Assert(t, condition(got, v1beta1.RevisionConditionImagesPullable).Status, qt.Equals, metav1.ConditionUnknown)
+	ready := condition(got, v1beta1.RevisionConditionReady)
+	qt.Assert(t, ready.Status, qt.Equals, metav1.ConditionFalse)
+	qt.Assert(t, ready.Reason, qt.Equals, v1beta1.ReasonRevisionNotReady)
+	qt.Assert(t, ready.Message, qt.Contains, "Secret s3")
+
+	// the image pull secret is optional, so it isn't needed to be ready
+	create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "s3"}})
+	create(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pypi"}})
+	create(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings"}})
+	got = check()
+	qt.Assert(t, got.Ready(), qt.IsTrue)
+	qt.Assert(t, condition(got, v1beta1.RevisionConditionReady).Status, qt.Equals, metav1.ConditionTrue)
+	qt.Assert(t, condition(got, v1beta1.RevisionConditionReferencesResolved).Status, qt.Equals, metav1.ConditionTrue)
+
+	// pods that pull their images don't change readiness, pods that
+	// can't make the revision not ready
+	create(newPod("nb", ""))
+	got = check()
+	qt.Assert(t, got.Ready(), qt.IsTrue)
+	qt.Assert(t, condition(got, v1beta1.RevisionConditionImagesPullable).Status, qt.Equals, metav1.ConditionTrue)
+
+	// pulls that back off only make the revision not ready once they've
+	// failed for the grace period
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	create(newPod("nb-retry", "ImagePullBackOff"))
+	got = check()
+	qt.Assert(t, got.Ready(), qt.IsTrue)
+	images := condition(got, v1beta1.RevisionConditionImagesPullable)
+	qt.Assert(t, images.Status, qt.Equals, metav1.ConditionUnknown)
+	qt.Assert(t, images.Reason, qt.Equals, v1beta1.ReasonImagePullBackOff)
+	result, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, result.RequeueAfter > 0 && result.RequeueAfter <= DefaultImagePullGracePeriod, qt.IsTrue)
+
+	now = now.Add(DefaultImagePullGracePeriod)
+	got = check()
+	qt.Assert(t, got.Ready(), qt.IsFalse)
+	images = condition(got, v1beta1.RevisionConditionImagesPullable)
+	qt.Assert(t, images.Reason, qt.Equals, v1beta1.ReasonImagePullFailed)
+	qt.Assert(t, images.Message, qt.Equals, "images can't be pulled: pod nb-retry container main: ImagePullBackOff: not found")
+}
+
+func TestReconciler_Reconcile_InvalidImage(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	rev := newRevision(t, corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}})
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(rev).
+		WithStatusSubresource(&v1beta1.Revision{}).
+		Build()
+	// the pods are listed from the cache of the pods started from
+	// revisions
+	pods := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newPod("nb", "InvalidImageName")).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s, WithPodReader(pods))
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(rev)}
+	_, err := r.Reconcile(ctx, req)
+	qt.Assert(t, err, qt.IsNil)
+
+	// an invalid image never pulls, so there's no grace period
+	qt.Assert(t, k8s.Get(ctx, req.NamespacedName, rev), qt.IsNil)
+	qt.Assert(t, rev.Ready(), qt.IsFalse)
+	images := meta.FindStatusCondition(rev.Status.Conditions, v1beta1.RevisionConditionImagesPullable)
+	qt.Assert(t, images, qt.IsNotNil)
+	qt.Assert(t, images.Reason, qt.Equals, v1beta1.ReasonImagePullFailed)
+}
+
+func TestEnqueueRequestsForReference(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	rev := newRevision(t, corev1.PodSpec{
+		Volumes: []corev1.Volume{{Name: "pypi", VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: "pypi"},
+		}}},
+		Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}},
+	}, dependency.Dependency{
+		LocalObjectReference: v1beta1.LocalObjectReference{Name: "s3", APIVersion: "v1", Kind: "Secret", As: "s3-creds"},
+		Namespace:            "system",
+	})
+	other := rev.DeepCopy()
+	other.SetName("other-1")
+	other.SetNamespace("other")
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(rev, other).
+		WithIndex(&v1beta1.Revision{}, IndexKeyReferences, References).
+		Build()
+
+	requests := func(kind string, obj client.Object) []reconcile.Request {
+		t.Helper()
+		queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+		defer queue.ShutDown()
+		EnqueueRequestsForReference(k8s, kind, logr.Discard()).Create(context.Background(), event.CreateEvent{Object: obj}, queue)
+		rv := make([]reconcile.Request, 0, queue.Len())
+		for queue.Len() > 0 {
+			item, _ := queue.Get()
+			rv = append(rv, item.(reconcile.Request))
+			queue.Done(item)
+		}
+		return rv
+	}
+	want := []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(rev)}}
+
+	qt.Assert(t, requests("Secret", &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pypi", Namespace: "test"}}), qt.DeepEquals, want)
+	qt.Assert(t, requests("Secret", &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "s3-creds", Namespace: "test"}}), qt.DeepEquals, want)
+	qt.Assert(t, requests("Secret", &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "test"}}), qt.HasLen, 0)
+	qt.Assert(t, requests("ConfigMap", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "pypi", Namespace: "test"}}), qt.HasLen, 0)
+}
+
+func TestReconciler_Reconcile_RestoreCopies(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	s3 := dependency.Dependency{
+		LocalObjectReference: v1beta1.LocalObjectReference{Name: "s3", APIVersion: "v1", Kind: "Secret"},
+		Namespace:            "system",
+	}
+	rev := newRevision(t, corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}}, s3)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(rev, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "s3", Namespace: "system"}}).
+		WithStatusSubresource(&v1beta1.Revision{}).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	// the copy was deleted by hand, so it's copied again
+	ctx := context.Background()
+	_, err := NewReconciler(k8s).Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(rev)})
+	qt.Assert(t, err, qt.IsNil)
+	secret := &corev1.Secret{}
+	qt.Assert(t, k8s.Get(ctx, client.ObjectKey{Namespace: "test", Name: "s3"}, secret), qt.IsNil)
+	qt.Assert(t, secret.Annotations[dependency.AnnotationKeySource], qt.Equals, "system/s3")
+	qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(rev), rev), qt.IsNil)
+	qt.Assert(t, rev.Ready(), qt.IsTrue)
+}
@@ -0,0 +1,319 @@
+package template
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+const (
+	// DefaultHistoryLimit is the number of TemplateRevisions kept
+	// for each template.
+	DefaultHistoryLimit = 10
+)
+
+var (
+	_ reconcile.Reconciler = &Reconciler{}
+)
+
+// Setup adds the Template and ClusterTemplate controllers to
+// manager.Manager. Any options provided are applied after the defaults.
+func Setup(mgr manager.Manager, opts ...Option) error {
+	for _, kind := range []string{v1beta1.KindTemplate, v1beta1.KindClusterTemplate} {
+		r := NewReconciler(mgr.GetClient(), kind, append([]Option{
+			WithLogger(mgr.GetLogger().WithName(strings.ToLower(kind) + "-controller")),
+		}, opts...)...)
+
+		var obj, rev client.Object = &v1beta1.Template{}, &v1beta1.TemplateRevision{}
+		if kind == v1beta1.KindClusterTemplate {
+			obj, rev = &v1beta1.ClusterTemplate{}, &v1beta1.ClusterTemplateRevision{}
+		}
+		err := builder.ControllerManagedBy(mgr).
+			Named(strings.ToLower(kind)).
+			For(obj).
+			Owns(rev).
+			Watches(obj, EnqueueRequestsForDescendants(mgr.GetClient(), kind)).
+			Complete(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Option func(r *Reconciler)
+
+func WithLogger(logger logr.Logger) Option {
+	return func(r *Reconciler) {
+		r.logger = logger
+	}
+}
+
+// WithHistoryLimit sets the number of TemplateRevisions kept for
+// each template. The oldest revisions are removed first.
+func WithHistoryLimit(limit int) Option {
+	return func(r *Reconciler) {
+		r.historyLimit = limit
+	}
+}
+
+// NewReconciler returns a Reconciler for templates of the kind, either
+// Template or ClusterTemplate.
+func NewReconciler(c client.Client, kind string, opts ...Option) *Reconciler {
+	r := &Reconciler{
+		client:       c,
+		kind:         kind,
+		logger:       logr.New(nil),
+		historyLimit: DefaultHistoryLimit,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Reconciler records a TemplateRevision whenever the spec of a template,
+// or of a template it extends, changes.
+type Reconciler struct {
+	client       client.Client
+	kind         string
+	logger       logr.Logger
+	historyLimit int
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	logger := r.logger.WithValues("name", req.Name, "namespace", req.Namespace)
+
+	template, err := revision.ResolveTemplate(ctx, r.client, r.kind, req.NamespacedName)
+	if err != nil {
+		logger.Info("unable to resolve template", "error", err)
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+
+	spec := v1beta1.TemplateRevisionSpec{ResourceVersion: template.ResourceVersion}
+	if err := spec.SetTemplateSpec(template.Spec); err != nil {
+		return reconcile.Result{}, err
+	}
+	labels := map[string]string{v1beta1.LabelKeyTemplateName: template.Name}
+	for k, v := range template.Labels {
+		labels[k] = v
+	}
+	revs, err := revision.ListTemplateRevisions(ctx, r.client, r.kind, req.NamespacedName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	// The spec may already have a revision, either because it hasn't
+	// changed or because it was changed back, which may have been named
+	// with an older hash.
+	var current *v1beta1.TemplateRevision
+	for _, item := range revs {
+		if item.Spec.Sum() == spec.Sum() {
+			current = item
+			break
+		}
+	}
+	if current == nil {
+		meta := metav1.ObjectMeta{
+			Name:      template.Name + "-" + spec.Hash(),
+			Namespace: template.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: v1beta1.GroupVersion.String(),
+				Kind:       r.kind,
+				Name:       template.Name,
+				UID:        template.UID,
+				Controller: pointer.Bool(true),
+			}},
+		}
+		var rev client.Object = &v1beta1.TemplateRevision{ObjectMeta: meta, Spec: spec}
+		if r.kind == v1beta1.KindClusterTemplate {
+			rev = &v1beta1.ClusterTemplateRevision{ObjectMeta: meta, Spec: spec}
+		}
+		if err := r.client.Create(ctx, rev); client.IgnoreAlreadyExists(err) != nil {
+			logger.Error(err, "failed to create template revision")
+			return reconcile.Result{}, err
+		}
+		revs, err = revision.ListTemplateRevisions(ctx, r.client, r.kind, req.NamespacedName)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	} else if !current.Spec.HasResourceVersion(template.ResourceVersion) {
+		// The template's resourceVersion changes without its spec, for
+		// example when its status is updated, so the revision records each
+		// resourceVersion workloads may be pinned to.
+		if err := r.addResourceVersion(ctx, current, template.ResourceVersion); err != nil {
+			logger.Error(err, "failed to update template revision")
+			return reconcile.Result{}, err
+		}
+	}
+
+	referenced, err := r.referencedRevisions(ctx, req.NamespacedName, revs)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	versions := make([]v1beta1.TemplateVersion, 0, len(revs))
+	for k, item := range revs {
+		if k >= r.historyLimit && item.Spec.Sum() != spec.Sum() && !referenced.Has(item.Name) {
+			if err := r.client.Delete(ctx, r.revisionObject(item)); client.IgnoreNotFound(err) != nil {
+				return reconcile.Result{}, err
+			}
+			continue
+		}
+		versions = append(versions, v1beta1.TemplateVersion{
+			Name:            item.Name,
+			ResourceVersion: item.Spec.ResourceVersion,
+			CreatedAt:       item.CreationTimestamp,
+		})
+	}
+	return reconcile.Result{}, r.updateStatus(ctx, req.NamespacedName, v1beta1.TemplateStatus{Revisions: versions})
+}
+
+// referencedRevisions returns the names of the revisions Notebooks and
+// Dag tasks are pinned to, which are kept past the history limit. Nothing
+// is listed unless there are revisions past the limit.
+func (r *Reconciler) referencedRevisions(ctx context.Context, key types.NamespacedName, revs []*v1beta1.TemplateRevision) (sets.Set[string], error) {
+	referenced := sets.New[string]()
+	if len(revs) <= r.historyLimit {
+		return referenced, nil
+	}
+	pin := func(ref v1beta1.TemplateReference, namespace string) {
+		if ref.TemplateKind() != r.kind || ref.Name != key.Name {
+			return
+		}
+		if ref.Namespace != "" {
+			namespace = ref.Namespace
+		}
+		if r.kind == v1beta1.KindTemplate && namespace != key.Namespace {
+			return
+		}
+		if rev := revision.FindTemplateRevision(revs, ref.Revision, ref.ResourceVersion); rev != nil {
+			referenced.Insert(rev.Name)
+		}
+	}
+
+	nbList := &v1beta1.NotebookList{}
+	if err := r.client.List(ctx, nbList); err != nil {
+		return nil, err
+	}
+	for _, nb := range nbList.Items {
+		pin(nb.Spec.TemplateRef, nb.Namespace)
+	}
+	dagList := &v1beta1.DagList{}
+	if err := r.client.List(ctx, dagList); err != nil {
+		return nil, err
+	}
+	for _, dag := range dagList.Items {
+		for _, task := range dag.Spec.Tasks {
+			if !task.IsDag() {
+				pin(task.Template, dag.Namespace)
+			}
+		}
+	}
+	return referenced, nil
+}
+
+func (r *Reconciler) addResourceVersion(ctx context.Context, rev *v1beta1.TemplateRevision, resourceVersion string) error {
+	updated := rev.DeepCopy()
+	updated.Spec.ResourceVersions = append(updated.Spec.ResourceVersions, resourceVersion)
+	var obj, base client.Object = updated, rev
+	if r.kind == v1beta1.KindClusterTemplate {
+		obj = &v1beta1.ClusterTemplateRevision{ObjectMeta: updated.ObjectMeta, Spec: updated.Spec}
+		base = &v1beta1.ClusterTemplateRevision{ObjectMeta: rev.ObjectMeta, Spec: rev.Spec}
+	}
+	return r.client.Patch(ctx, obj, client.MergeFrom(base))
+}
+
+func (r *Reconciler) revisionObject(rev *v1beta1.TemplateRevision) client.Object {
+	if r.kind == v1beta1.KindClusterTemplate {
+		return &v1beta1.ClusterTemplateRevision{ObjectMeta: metav1.ObjectMeta{Name: rev.Name}}
+	}
+	return rev
+}
+
+func (r *Reconciler) updateStatus(ctx context.Context, key types.NamespacedName, status v1beta1.TemplateStatus) error {
+	if r.kind == v1beta1.KindClusterTemplate {
+		ct := &v1beta1.ClusterTemplate{}
+		if err := r.client.Get(ctx, key, ct); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if equality.Semantic.DeepEqual(ct.Status, status) {
+			return nil
+		}
+		patch := client.MergeFrom(ct.DeepCopy())
+		ct.Status = status
+		return r.client.Status().Patch(ctx, ct, patch)
+	}
+	t := &v1beta1.Template{}
+	if err := r.client.Get(ctx, key, t); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if equality.Semantic.DeepEqual(t.Status, status) {
+		return nil
+	}
+	patch := client.MergeFrom(t.DeepCopy())
+	t.Status = status
+	return r.client.Status().Patch(ctx, t, patch)
+}
+
+// EnqueueRequestsForDescendants enqueues the templates that extend a
+// template, directly or through another template, since their resolved
+// spec changes with it.
+func EnqueueRequestsForDescendants(c client.Reader, kind string) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		children := make(map[string][]string)
+		if kind == v1beta1.KindClusterTemplate {
+			ctList := &v1beta1.ClusterTemplateList{}
+			if err := c.List(ctx, ctList); err != nil {
+				return nil
+			}
+			for _, item := range ctList.Items {
+				if item.Spec.Extends != nil {
+					children[item.Spec.Extends.Name] = append(children[item.Spec.Extends.Name], item.Name)
+				}
+			}
+		} else {
+			tList := &v1beta1.TemplateList{}
+			if err := c.List(ctx, tList, client.InNamespace(obj.GetNamespace())); err != nil {
+				return nil
+			}
+			for _, item := range tList.Items {
+				if item.Spec.Extends != nil {
+					children[item.Spec.Extends.Name] = append(children[item.Spec.Extends.Name], item.Name)
+				}
+			}
+		}
+
+		requests := make([]reconcile.Request, 0)
+		seen := map[string]bool{obj.GetName(): true}
+		queue := []string{obj.GetName()}
+		for len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			for _, child := range children[name] {
+				if seen[child] {
+					continue
+				}
+				seen[child] = true
+				queue = append(queue, child)
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: child, Namespace: obj.GetNamespace()},
+				})
+			}
+		}
+		return requests
+	})
+}
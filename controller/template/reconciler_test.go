@@ -0,0 +1,230 @@
+package template
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func newTemplate(name, image string) *v1beta1.Template {
+	return &v1beta1.Template{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec: v1beta1.TemplateSpec{
+			Template: v1beta1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: image}}},
+			},
+		},
+	}
+}
+
+// created sets increasing creation timestamps, which the fake client
+// doesn't set, so revisions are ordered by when they were created.
+func created() func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+	now := time.Now()
+	return func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+		now = now.Add(time.Second)
+		obj.SetCreationTimestamp(metav1.NewTime(now))
+		return c.Create(ctx, obj, opts...)
+	}
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newTemplate("jupyter", "jupyter:v1")).
+		WithStatusSubresource(&v1beta1.Template{}).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s, v1beta1.KindTemplate)
+	key := types.NamespacedName{Name: "jupyter", Namespace: "test"}
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	qt.Assert(t, err, qt.IsNil)
+
+	// reconciling again without a change doesn't create another revision
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	qt.Assert(t, err, qt.IsNil)
+	revs, err := revision.ListTemplateRevisions(ctx, k8s, v1beta1.KindTemplate, key)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, revs, qt.HasLen, 1)
+	first, firstVersion := revs[0].Name, revs[0].Spec.ResourceVersion
+
+	template := &v1beta1.Template{}
+	qt.Assert(t, k8s.Get(ctx, key, template), qt.IsNil)
+	template.Spec.Template.Spec.Containers[0].Image = "jupyter:v2"
+	qt.Assert(t, k8s.Update(ctx, template), qt.IsNil)
+
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	qt.Assert(t, err, qt.IsNil)
+	revs, err = revision.ListTemplateRevisions(ctx, k8s, v1beta1.KindTemplate, key)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, revs, qt.HasLen, 2)
+
+	qt.Assert(t, k8s.Get(ctx, key, template), qt.IsNil)
+	qt.Assert(t, template.Status.Revisions, qt.HasLen, 2)
+
+	// the first revision still resolves to the first spec
+	pinned, err := revision.ResolveTemplateVersion(ctx, k8s, v1beta1.KindTemplate, key, first, "")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned.Spec.Template.Spec.Containers[0].Image, qt.Equals, "jupyter:v1")
+
+	pinned, err = revision.ResolveTemplateVersion(ctx, k8s, v1beta1.KindTemplate, key, "", firstVersion)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned.Spec.Template.Spec.Containers[0].Image, qt.Equals, "jupyter:v1")
+
+	latest, err := revision.ResolveTemplateVersion(ctx, k8s, v1beta1.KindTemplate, key, "", "")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, latest.Spec.Template.Spec.Containers[0].Image, qt.Equals, "jupyter:v2")
+
+	_, err = revision.ResolveTemplateVersion(ctx, k8s, v1beta1.KindTemplate, key, "jupyter-missing", "")
+	qt.Assert(t, err, qt.ErrorMatches, revision.ErrTemplateRevisionNotFound+": jupyter-missing")
+}
+
+func TestReconciler_Reconcile_Extends(t *testing.T) {
+	base := newTemplate("base", "jupyter:v1")
+	child := newTemplate("child", "")
+	child.Spec.Extends = &corev1.LocalObjectReference{Name: "base"}
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(base, child).
+		WithStatusSubresource(&v1beta1.Template{}).
+		WithInterceptorFuncs(interceptor.Funcs{Create: created()}).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s, v1beta1.KindTemplate)
+	key := types.NamespacedName{Name: "child", Namespace: "test"}
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	qt.Assert(t, err, qt.IsNil)
+
+	revs, err := revision.ListTemplateRevisions(ctx, k8s, v1beta1.KindTemplate, key)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, revs, qt.HasLen, 1)
+	spec, err := revs[0].Spec.TemplateSpec()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, spec.Extends, qt.IsNil)
+	qt.Assert(t, spec.Template.Spec.Containers[0].Image, qt.Equals, "jupyter:v1")
+
+	// the status update changes the child's resourceVersion
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, k8s.Get(ctx, key, child), qt.IsNil)
+	pinnedVersion := child.ResourceVersion
+
+	// a change to the base renders the child differently at the same
+	// resourceVersion, which still resolves to what it rendered to before
+	qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Name: "base", Namespace: "test"}, base), qt.IsNil)
+	base.Spec.Template.Spec.Containers[0].Image = "jupyter:v2"
+	qt.Assert(t, k8s.Update(ctx, base), qt.IsNil)
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+	qt.Assert(t, err, qt.IsNil)
+
+	revs, err = revision.ListTemplateRevisions(ctx, k8s, v1beta1.KindTemplate, key)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, revs, qt.HasLen, 2)
+	pinned, err := revision.ResolveTemplateVersion(ctx, k8s, v1beta1.KindTemplate, key, "", pinnedVersion)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned.Spec.Template.Spec.Containers[0].Image, qt.Equals, "jupyter:v1")
+	latest, err := revision.ResolveTemplateVersion(ctx, k8s, v1beta1.KindTemplate, key, "", "")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, latest.Spec.Template.Spec.Containers[0].Image, qt.Equals, "jupyter:v2")
+}
+
+func TestReconciler_Reconcile_Pinned(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(newTemplate("jupyter", "jupyter:v1")).
+		WithStatusSubresource(&v1beta1.Template{}).
+		WithInterceptorFuncs(interceptor.Funcs{Create: created()}).
+		Build()
+
+	ctx := context.Background()
+	r := NewReconciler(k8s, v1beta1.KindTemplate, WithHistoryLimit(1))
+	key := types.NamespacedName{Name: "jupyter", Namespace: "test"}
+	reconcileImage := func(image string) {
+		t.Helper()
+		template := &v1beta1.Template{}
+		qt.Assert(t, k8s.Get(ctx, key, template), qt.IsNil)
+		if template.Spec.Template.Spec.Containers[0].Image != image {
+			template.Spec.Template.Spec.Containers[0].Image = image
+			qt.Assert(t, k8s.Update(ctx, template), qt.IsNil)
+		}
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		qt.Assert(t, err, qt.IsNil)
+		// the status update changes the resourceVersion, which the
+		// next reconcile records on the revision
+		_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		qt.Assert(t, err, qt.IsNil)
+	}
+
+	reconcileImage("jupyter:v1")
+	// workloads pin to the resourceVersion they read, which is after
+	// the controller updated the status
+	template := &v1beta1.Template{}
+	qt.Assert(t, k8s.Get(ctx, key, template), qt.IsNil)
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "test"},
+		Spec: v1beta1.NotebookSpec{
+			TemplateRef: v1beta1.TemplateReference{Name: "jupyter", ResourceVersion: template.ResourceVersion},
+		},
+	}
+	qt.Assert(t, k8s.Create(ctx, nb), qt.IsNil)
+
+	reconcileImage("jupyter:v2")
+	revs, err := revision.ListTemplateRevisions(ctx, k8s, v1beta1.KindTemplate, key)
+	qt.Assert(t, err, qt.IsNil)
+	var v2 string
+	for _, rev := range revs {
+		spec, err := rev.Spec.TemplateSpec()
+		qt.Assert(t, err, qt.IsNil)
+		if spec.Template.Spec.Containers[0].Image == "jupyter:v2" {
+			v2 = rev.Name
+		}
+	}
+	dag := &v1beta1.Dag{
+		ObjectMeta: metav1.ObjectMeta{Name: "dag", Namespace: "test"},
+		Spec: v1beta1.DagSpec{Tasks: []v1beta1.DagTask{{
+			Name:     "train",
+			Template: v1beta1.TemplateReference{Name: "jupyter", Namespace: "test", Revision: v2},
+		}}},
+	}
+	qt.Assert(t, k8s.Create(ctx, dag), qt.IsNil)
+
+	reconcileImage("jupyter:v3")
+	reconcileImage("jupyter:v4")
+
+	// the revisions the workloads are pinned to are kept past the limit
+	revs, err = revision.ListTemplateRevisions(ctx, k8s, v1beta1.KindTemplate, key)
+	qt.Assert(t, err, qt.IsNil)
+	images := make([]string, 0, len(revs))
+	for _, rev := range revs {
+		spec, err := rev.Spec.TemplateSpec()
+		qt.Assert(t, err, qt.IsNil)
+		images = append(images, spec.Template.Spec.Containers[0].Image)
+	}
+	sort.Strings(images)
+	qt.Assert(t, images, qt.DeepEquals, []string{"jupyter:v1", "jupyter:v2", "jupyter:v4"})
+
+	pinned, err := revision.ResolveReferrerTemplate(ctx, k8s, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned.Spec.Template.Spec.Containers[0].Image, qt.Equals, "jupyter:v1")
+}
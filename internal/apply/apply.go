@@ -0,0 +1,35 @@
+// Package apply writes objects with server-side apply, so the controller
+// only owns the fields it sets. Fields set by mutating webhooks and other
+// controllers are left alone.
+package apply
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// FieldManager is the field manager the controller applies objects as.
+const FieldManager = "notebook-controller"
+
+// Apply applies obj as the FieldManager, taking ownership of any fields
+// that conflict with other managers. obj has to contain every field the
+// manager owns, since fields the manager owned before and that obj doesn't
+// set are removed. Options provided are applied after the defaults, so a
+// client.FieldOwner can be used to apply obj as another manager.
+func Apply(ctx context.Context, c client.Client, obj client.Object, opts ...client.PatchOption) error {
+	if obj.GetObjectKind().GroupVersionKind().Empty() {
+		gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+		if err != nil {
+			return err
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	return c.Patch(ctx, obj, client.Apply, append([]client.PatchOption{
+		client.FieldOwner(FieldManager),
+		client.ForceOwnership,
+	}, opts...)...)
+}
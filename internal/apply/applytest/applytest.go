@@ -0,0 +1,112 @@
+// Package applytest emulates server-side apply for fake clients in tests.
+package applytest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// Funcs returns the interceptor functions that emulate server-side apply
+// for a fake client, which doesn't support it. Applying an object that
+// doesn't exist creates it. Applying one that does merges the applied
+// configuration into it, merging lists such as owner references and
+// containers by their keys, and removes the fields the field manager
+// applied before that it doesn't apply anymore. Fields set by anything
+// else are left alone. Unlike a real server, fields applied by several
+// managers are removed when any of them stops applying them.
+//
+//	fake.NewClientBuilder().WithInterceptorFuncs(applytest.Funcs()).Build()
+func Funcs() interceptor.Funcs {
+	// applied is the last configuration each field manager applied to
+	// each object.
+	applied := make(map[appliedKey]map[string]any)
+	var mu sync.Mutex
+
+	return interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return c.Patch(ctx, obj, patch, opts...)
+			}
+			gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+			if err != nil {
+				return err
+			}
+			data, err := patch.Data(obj)
+			if err != nil {
+				return err
+			}
+			config := make(map[string]any)
+			if err := json.Unmarshal(data, &config); err != nil {
+				return err
+			}
+			options := &client.PatchOptions{}
+			options.ApplyOptions(opts)
+			key := appliedKey{gvk: gvk, key: client.ObjectKeyFromObject(obj), manager: options.FieldManager}
+
+			mu.Lock()
+			defer mu.Unlock()
+			existing := &unstructured.Unstructured{}
+			existing.SetGroupVersionKind(gvk)
+			if err := c.Get(ctx, key.key, existing); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return err
+				}
+				for k := range applied {
+					if k.gvk == gvk && k.key == key.key {
+						delete(applied, k)
+					}
+				}
+				if err := c.Create(ctx, obj); err != nil {
+					return err
+				}
+				applied[key] = config
+				return nil
+			}
+
+			dataStruct, err := c.Scheme().New(gvk)
+			if err != nil {
+				return err
+			}
+			merged, err := strategicpatch.StrategicMergeMapPatch(existing.Object, config, dataStruct)
+			if err != nil {
+				return err
+			}
+			// The two way patch from the previous configuration removes
+			// the fields that aren't applied anymore.
+			previous, ok := applied[key]
+			if !ok {
+				previous = make(map[string]any)
+			}
+			removed, err := strategicpatch.CreateTwoWayMergeMapPatch(previous, config, dataStruct)
+			if err != nil {
+				return err
+			}
+			merged, err = strategicpatch.StrategicMergeMapPatch(merged, removed, dataStruct)
+			if err != nil {
+				return err
+			}
+			existing.Object = merged
+			if err := c.Update(ctx, existing); err != nil {
+				return err
+			}
+			applied[key] = config
+			return c.Get(ctx, key.key, obj)
+		},
+	}
+}
+
+type appliedKey struct {
+	gvk     schema.GroupVersionKind
+	key     types.NamespacedName
+	manager string
+}
@@ -0,0 +1,478 @@
+// Package dependency copies the dependencies of templates, such as
+// ConfigMaps and Secrets, into the namespaces of the workloads that use
+// them, and keeps the copies in sync with their sources.
+package dependency
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply"
+)
+
+const (
+	ErrDependencyConflict = "dependency copy conflict"
+	ErrInvalidCopySource  = "invalid dependency copy source"
+)
+
+var (
+	// LabelKeyManaged marks an object as a copy of a dependency.
+	LabelKeyManaged = fmt.Sprintf("%s/dependency", v1beta1.GroupName)
+	// LabelKeySource is a hash of the namespace and name of the source
+	// of a copy, so copies can be listed by their source.
+	LabelKeySource = fmt.Sprintf("%s/dependency-source", v1beta1.GroupName)
+	// AnnotationKeySource is the namespace and name of the source of a copy.
+	AnnotationKeySource = fmt.Sprintf("%s/dependency-source", v1beta1.GroupName)
+	// AnnotationKeyDependencies lists the copies owned by a Revision.
+	AnnotationKeyDependencies = fmt.Sprintf("%s/dependencies", v1beta1.GroupName)
+)
+
+// A Dependency is a dependency of a template and the namespace
+// it's copied from.
+type Dependency struct {
+	v1beta1.LocalObjectReference
+	Namespace string
+}
+
+// CopyName returns the name of the dependency's copy.
+func (d Dependency) CopyName() string {
+	if d.As != "" {
+		return d.As
+	}
+	return d.Name
+}
+
+// Source returns the key of the object the dependency is copied from.
+func (d Dependency) Source() types.NamespacedName {
+	return types.NamespacedName{Namespace: d.Namespace, Name: d.Name}
+}
+
+// Copies returns the dependencies that need to be copied to namespace, that
+// is, the dependencies that don't already exist there. Each copy is
+// returned once, and an error is returned if two different objects would
+// be copied under the same name.
+func Copies(deps []Dependency, namespace string) ([]Dependency, error) {
+	sources := make(map[string]types.NamespacedName)
+	copies := make([]Dependency, 0, len(deps))
+	for _, dep := range deps {
+		if dep.Namespace == namespace {
+			continue
+		}
+		key := dep.GroupVersionKind().GroupKind().String() + "/" + dep.CopyName()
+		if source, ok := sources[key]; ok {
+			if source != dep.Source() {
+				return nil, errors.Errorf("%s: %s %s is copied from both %s and %s", ErrDependencyConflict, dep.Kind, dep.CopyName(), source, dep.Source())
+			}
+			continue
+		}
+		sources[key] = dep.Source()
+		copies = append(copies, dep)
+	}
+	return copies, nil
+}
+
+// SourceHash returns the value of LabelKeySource for copies of the
+// object.
+func SourceHash(source types.NamespacedName) string {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(source.String()))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// Propagator creates and updates the copies of dependencies.
+type Propagator struct {
+	client client.Client
+}
+
+func NewPropagator(c client.Client) *Propagator {
+	return &Propagator{client: c}
+}
+
+// A copyRef is a copy recorded on a Revision by Annotate.
+type copyRef struct {
+	v1beta1.LocalObjectReference
+	// Source is the namespace and name of the object the copy is made
+	// from.
+	Source string `json:"source"`
+}
+
+// dependency returns the Dependency the copy is made from.
+func (ref copyRef) dependency() (Dependency, error) {
+	namespace, name, ok := strings.Cut(ref.Source, "/")
+	if !ok || namespace == "" || name == "" {
+		return Dependency{}, errors.Errorf("%s: %s %s: %q", ErrInvalidCopySource, ref.Kind, ref.Name, ref.Source)
+	}
+	return Dependency{
+		LocalObjectReference: v1beta1.LocalObjectReference{Name: name, APIVersion: ref.APIVersion, Kind: ref.Kind, As: ref.Name},
+		Namespace:            namespace,
+	}, nil
+}
+
+// Annotate records the copies of the dependencies and their sources on
+// the Revision, so they can be restored if they're deleted, and released
+// when the Revision is deleted.
+func Annotate(rev *v1beta1.Revision, copies []Dependency) error {
+	if len(copies) == 0 {
+		return nil
+	}
+	refs := make([]copyRef, 0, len(copies))
+	for _, dep := range copies {
+		refs = append(refs, copyRef{
+			LocalObjectReference: v1beta1.LocalObjectReference{Name: dep.CopyName(), APIVersion: dep.APIVersion, Kind: dep.Kind},
+			Source:               dep.Source().String(),
+		})
+	}
+	raw, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	annotations := rev.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[AnnotationKeyDependencies] = string(raw)
+	rev.SetAnnotations(annotations)
+	return nil
+}
+
+// Propagate copies the dependencies into the namespace of the Revision.
+// Copies are shared by all the Revisions in the namespace that depend on
+// them, and each Revision is added as an owner of the copy.
+func (p *Propagator) Propagate(ctx context.Context, rev *v1beta1.Revision, deps []Dependency) error {
+	copies, err := Copies(deps, rev.GetNamespace())
+	if err != nil {
+		return err
+	}
+	for _, dep := range copies {
+		if err := p.copy(ctx, rev, dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore recreates the copies recorded on the Revision that don't exist
+// in its namespace, such as copies that were deleted by hand. Copies whose
+// source doesn't exist anymore can't be restored, and are left missing.
+func (p *Propagator) Restore(ctx context.Context, rev *v1beta1.Revision) error {
+	refs, err := dependencies(rev)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		dep, err := ref.dependency()
+		if err != nil {
+			return err
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ref.GroupVersionKind())
+		err = p.client.Get(ctx, types.NamespacedName{Namespace: rev.GetNamespace(), Name: ref.Name}, obj)
+		if err == nil {
+			continue
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if err := p.copy(ctx, rev, dep); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy copies the dependency into the namespace of the Revision, and adds
+// the Revision as an owner of the copy. An object with the name of the
+// copy that isn't a copy of the same source is never overwritten.
+func (p *Propagator) copy(ctx context.Context, rev *v1beta1.Revision, dep Dependency) error {
+	source := &unstructured.Unstructured{}
+	source.SetGroupVersionKind(dep.GroupVersionKind())
+	if err := p.client.Get(ctx, dep.Source(), source); err != nil {
+		return errors.Wrapf(err, "failed to get dependency %s", dep.Source())
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(dep.GroupVersionKind())
+	err := p.client.Get(ctx, types.NamespacedName{Namespace: rev.GetNamespace(), Name: dep.CopyName()}, obj)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	if err == nil && (obj.GetLabels()[LabelKeyManaged] != "true" || obj.GetAnnotations()[AnnotationKeySource] != dep.Source().String()) {
+		return errors.Errorf("%s: %s %s/%s isn't a copy of %s", ErrDependencyConflict, dep.Kind, rev.GetNamespace(), dep.CopyName(), dep.Source())
+	}
+	owners := addOwner(revisionOwners(obj), rev)
+	if err := p.applyCopy(ctx, newCopy(source, rev.GetNamespace(), dep.CopyName()), owners); err != nil {
+		return errors.Wrapf(err, "failed to copy dependency %s", dep.Source())
+	}
+	return nil
+}
+
+// Sync updates the copies of the source object so their content matches
+// it. Copies that aren't owned by any Revision are deleted.
+func (p *Propagator) Sync(ctx context.Context, source *unstructured.Unstructured) error {
+	copies := &unstructured.UnstructuredList{}
+	copies.SetGroupVersionKind(source.GroupVersionKind())
+	hash := SourceHash(client.ObjectKeyFromObject(source))
+	if err := p.client.List(ctx, copies, client.MatchingLabels{LabelKeyManaged: "true", LabelKeySource: hash}); err != nil {
+		return err
+	}
+	for k := range copies.Items {
+		obj := &copies.Items[k]
+		if obj.GetAnnotations()[AnnotationKeySource] != client.ObjectKeyFromObject(source).String() {
+			// hash collision
+			continue
+		}
+		if len(obj.GetOwnerReferences()) == 0 {
+			if err := p.client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.applyCopy(ctx, newCopy(source, obj.GetNamespace(), obj.GetName()), revisionOwners(obj)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release removes the Revision as an owner of its copies, and deletes
+// the copies that no other Revision owns.
+func (p *Propagator) Release(ctx context.Context, rev *v1beta1.Revision) error {
+	refs, err := dependencies(rev)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ref.GroupVersionKind())
+		if err := p.client.Get(ctx, types.NamespacedName{Namespace: rev.GetNamespace(), Name: ref.Name}, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if obj.GetLabels()[LabelKeyManaged] != "true" {
+			continue
+		}
+		remaining := 0
+		for _, owner := range obj.GetOwnerReferences() {
+			if owner.UID != rev.GetUID() {
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			if err := p.client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		owners := make([]metav1.OwnerReference, 0)
+		for _, owner := range revisionOwners(obj) {
+			if owner.UID != rev.GetUID() {
+				owners = append(owners, owner)
+			}
+		}
+		desired, err := p.desired(ctx, obj)
+		if err != nil {
+			return err
+		}
+		if err := p.applyCopy(ctx, desired, owners); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recorded returns the copies recorded on the Revision.
+func Recorded(rev *v1beta1.Revision) ([]v1beta1.LocalObjectReference, error) {
+	refs, err := dependencies(rev)
+	if err != nil {
+		return nil, err
+	}
+	recorded := make([]v1beta1.LocalObjectReference, 0, len(refs))
+	for _, ref := range refs {
+		recorded = append(recorded, ref.LocalObjectReference)
+	}
+	return recorded, nil
+}
+
+// Missing returns the copies recorded on the Revision that don't exist
+// in its namespace.
+func (p *Propagator) Missing(ctx context.Context, rev *v1beta1.Revision) ([]v1beta1.LocalObjectReference, error) {
+	refs, err := dependencies(rev)
+	if err != nil {
+		return nil, err
+	}
+	missing := make([]v1beta1.LocalObjectReference, 0)
+	for _, ref := range refs {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ref.GroupVersionKind())
+		if err := p.client.Get(ctx, types.NamespacedName{Namespace: rev.GetNamespace(), Name: ref.Name}, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			missing = append(missing, ref.LocalObjectReference)
+		}
+	}
+	return missing, nil
+}
+
+// Transfer adds the Revision to as an owner of the copies owned by the
+// Revision from, and then releases them from from. It's used when a
+// Revision is replaced by another with the same content.
+func (p *Propagator) Transfer(ctx context.Context, from, to *v1beta1.Revision) error {
+	refs, err := dependencies(from)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ref.GroupVersionKind())
+		if err := p.client.Get(ctx, types.NamespacedName{Namespace: from.GetNamespace(), Name: ref.Name}, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if obj.GetLabels()[LabelKeyManaged] != "true" {
+			continue
+		}
+		desired, err := p.desired(ctx, obj)
+		if err != nil {
+			return err
+		}
+		if err := p.applyCopy(ctx, desired, addOwner(revisionOwners(obj), to)); err != nil {
+			return err
+		}
+	}
+	return p.Release(ctx, from)
+}
+
+// dependencies returns the copies recorded on the Revision by Annotate.
+func dependencies(rev *v1beta1.Revision) ([]copyRef, error) {
+	refs := make([]copyRef, 0)
+	raw, ok := rev.GetAnnotations()[AnnotationKeyDependencies]
+	if !ok {
+		return refs, nil
+	}
+	return refs, json.Unmarshal([]byte(raw), &refs)
+}
+
+// newCopy returns a copy of the source object in the namespace.
+func newCopy(source *unstructured.Unstructured, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{}}
+	obj.SetGroupVersionKind(source.GroupVersionKind())
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	sync(obj, source)
+	return obj
+}
+
+// sync copies the content, labels and annotations of the source onto obj.
+func sync(obj, source *unstructured.Unstructured) {
+	for k, v := range source.Object {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		obj.Object[k] = v
+	}
+	for k := range obj.Object {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		if _, ok := source.Object[k]; !ok {
+			delete(obj.Object, k)
+		}
+	}
+
+	labels := make(map[string]string)
+	for k, v := range source.GetLabels() {
+		labels[k] = v
+	}
+	labels[LabelKeyManaged] = "true"
+	labels[LabelKeySource] = SourceHash(client.ObjectKeyFromObject(source))
+	obj.SetLabels(labels)
+
+	annotations := make(map[string]string)
+	for k, v := range source.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[AnnotationKeySource] = client.ObjectKeyFromObject(source).String()
+	obj.SetAnnotations(annotations)
+}
+
+func ownerRef(rev *v1beta1.Revision) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: v1beta1.GroupVersion.String(),
+		Kind:       "Revision",
+		Name:       rev.GetName(),
+		UID:        rev.GetUID(),
+	}
+}
+
+// revisionOwners returns the Revisions that own the copy.
+func revisionOwners(obj *unstructured.Unstructured) []metav1.OwnerReference {
+	owners := make([]metav1.OwnerReference, 0)
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.APIVersion == v1beta1.GroupVersion.String() && owner.Kind == "Revision" {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+// addOwner returns the owners with the Revision added, if it isn't
+// already one of them.
+func addOwner(owners []metav1.OwnerReference, rev *v1beta1.Revision) []metav1.OwnerReference {
+	for _, owner := range owners {
+		if owner.UID == rev.GetUID() {
+			return owners
+		}
+	}
+	return append(owners, ownerRef(rev))
+}
+
+// applyCopy applies the copy with the Revisions that own it. The content
+// and the owners are applied together, so the copy is written in one
+// request. Owners added by anything else are left alone.
+func (p *Propagator) applyCopy(ctx context.Context, obj *unstructured.Unstructured, owners []metav1.OwnerReference) error {
+	obj.SetOwnerReferences(owners)
+	return apply.Apply(ctx, p.client, obj)
+}
+
+// desired returns the copy as it's applied, with the content of its
+// source. If the source doesn't exist anymore, the copy keeps the content
+// it has.
+func (p *Propagator) desired(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if namespace, name, ok := strings.Cut(obj.GetAnnotations()[AnnotationKeySource], "/"); ok {
+		source := &unstructured.Unstructured{}
+		source.SetGroupVersionKind(obj.GroupVersionKind())
+		err := p.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, source)
+		if err == nil {
+			return newCopy(source, obj.GetNamespace(), obj.GetName()), nil
+		}
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	}
+	desired := &unstructured.Unstructured{Object: map[string]any{}}
+	desired.SetGroupVersionKind(obj.GroupVersionKind())
+	desired.SetName(obj.GetName())
+	desired.SetNamespace(obj.GetNamespace())
+	sync(desired, obj)
+	desired.SetLabels(obj.GetLabels())
+	desired.SetAnnotations(obj.GetAnnotations())
+	return desired, nil
+}
@@ -0,0 +1,244 @@
+package dependency
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+)
+
+func newSecret(name, namespace, value string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Data:       map[string][]byte{"value": []byte(value)},
+	}
+}
+
+func newSecretDependency(name, as string) Dependency {
+	return Dependency{
+		LocalObjectReference: v1beta1.LocalObjectReference{Name: name, APIVersion: "v1", Kind: "Secret", As: as},
+		Namespace:            "kubeflow",
+	}
+}
+
+func mustCopies(t *testing.T, deps []Dependency, namespace string) []Dependency {
+	t.Helper()
+	copies, err := Copies(deps, namespace)
+	qt.Assert(t, err, qt.IsNil)
+	return copies
+}
+
+func newRevision(name, uid string) *v1beta1.Revision {
+	return &v1beta1.Revision{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-ml", UID: types.UID(uid)}}
+}
+
+func TestPropagator(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	funcs := applytest.Funcs()
+	patches, apply := 0, funcs.Patch
+	funcs.Patch = func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+		patches++
+		return apply(ctx, c, obj, patch, opts...)
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			newSecret("s3", "kubeflow", "v1"),
+			newSecret("pypi", "kubeflow", "v1"),
+			newSecret("unmanaged", "team-ml", "mine"),
+		).
+		WithInterceptorFuncs(funcs).
+		Build()
+
+	ctx := context.Background()
+	p := NewPropagator(k8s)
+	deps := []Dependency{newSecretDependency("s3", ""), newSecretDependency("pypi", "team-pypi")}
+	first := newRevision("nb-1", "1")
+	second := newRevision("nb-2", "2")
+
+	getCopy := func(t *testing.T, name string) *corev1.Secret {
+		t.Helper()
+		secret := &corev1.Secret{}
+		qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Namespace: "team-ml", Name: name}, secret), qt.IsNil)
+		return secret
+	}
+	owners := func(secret *corev1.Secret) []types.UID {
+		uids := make([]types.UID, 0)
+		for _, owner := range secret.GetOwnerReferences() {
+			uids = append(uids, owner.UID)
+		}
+		return uids
+	}
+
+	t.Run("Propagate", func(t *testing.T) {
+		// the content and the owners of a copy are written together
+		qt.Assert(t, p.Propagate(ctx, first, deps), qt.IsNil)
+		qt.Assert(t, patches, qt.Equals, len(deps))
+		qt.Assert(t, p.Propagate(ctx, second, deps), qt.IsNil)
+		qt.Assert(t, patches, qt.Equals, 2*len(deps))
+
+		s3 := getCopy(t, "s3")
+		qt.Assert(t, s3.Data["value"], qt.DeepEquals, []byte("v1"))
+		qt.Assert(t, owners(s3), qt.DeepEquals, []types.UID{"1", "2"})
+		qt.Assert(t, s3.Annotations[AnnotationKeySource], qt.Equals, "kubeflow/s3")
+		qt.Assert(t, owners(getCopy(t, "team-pypi")), qt.DeepEquals, []types.UID{"1", "2"})
+	})
+	t.Run("Sync", func(t *testing.T) {
+		source := newSecret("s3", "kubeflow", "v2")
+		qt.Assert(t, k8s.Update(ctx, source), qt.IsNil)
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(source), obj), qt.IsNil)
+		qt.Assert(t, p.Sync(ctx, obj), qt.IsNil)
+		qt.Assert(t, getCopy(t, "s3").Data["value"], qt.DeepEquals, []byte("v2"))
+	})
+	t.Run("ForeignFields", func(t *testing.T) {
+		// fields set by webhooks and other controllers survive syncing
+		// and changes to the owners
+		s3 := getCopy(t, "s3")
+		s3.Labels["team"] = "ml"
+		s3.Annotations["injected"] = "true"
+		s3.Data["injected"] = []byte("true")
+		s3.OwnerReferences = append(s3.OwnerReferences, metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "audit", UID: "audit"})
+		qt.Assert(t, k8s.Update(ctx, s3), qt.IsNil)
+
+		source := &unstructured.Unstructured{}
+		source.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		qt.Assert(t, k8s.Get(ctx, types.NamespacedName{Namespace: "kubeflow", Name: "s3"}, source), qt.IsNil)
+		qt.Assert(t, p.Sync(ctx, source), qt.IsNil)
+		qt.Assert(t, p.Propagate(ctx, second, deps), qt.IsNil)
+
+		s3 = getCopy(t, "s3")
+		qt.Assert(t, s3.Labels["team"], qt.Equals, "ml")
+		qt.Assert(t, s3.Labels[LabelKeyManaged], qt.Equals, "true")
+		qt.Assert(t, s3.Annotations["injected"], qt.Equals, "true")
+		qt.Assert(t, s3.Data["injected"], qt.DeepEquals, []byte("true"))
+		qt.Assert(t, s3.Data["value"], qt.DeepEquals, []byte("v2"))
+		qt.Assert(t, owners(s3), qt.DeepEquals, []types.UID{"1", "2", "audit"})
+
+		s3.OwnerReferences = s3.OwnerReferences[:2]
+		qt.Assert(t, k8s.Update(ctx, s3), qt.IsNil)
+	})
+	t.Run("Transfer", func(t *testing.T) {
+		third := newRevision("nb-3", "3")
+		qt.Assert(t, Annotate(first, mustCopies(t, deps, "team-ml")), qt.IsNil)
+		qt.Assert(t, Annotate(third, mustCopies(t, deps, "team-ml")), qt.IsNil)
+
+		qt.Assert(t, p.Transfer(ctx, first, third), qt.IsNil)
+		qt.Assert(t, owners(getCopy(t, "s3")), qt.DeepEquals, []types.UID{"2", "3"})
+		qt.Assert(t, owners(getCopy(t, "team-pypi")), qt.DeepEquals, []types.UID{"2", "3"})
+
+		// hand the copies back for the rest of the tests
+		qt.Assert(t, p.Transfer(ctx, third, first), qt.IsNil)
+		qt.Assert(t, owners(getCopy(t, "s3")), qt.DeepEquals, []types.UID{"2", "1"})
+	})
+	t.Run("Release", func(t *testing.T) {
+		qt.Assert(t, Annotate(first, mustCopies(t, deps, "team-ml")), qt.IsNil)
+		qt.Assert(t, Annotate(second, mustCopies(t, deps, "team-ml")), qt.IsNil)
+
+		qt.Assert(t, p.Release(ctx, first), qt.IsNil)
+		qt.Assert(t, owners(getCopy(t, "s3")), qt.DeepEquals, []types.UID{"2"})
+
+		qt.Assert(t, p.Release(ctx, second), qt.IsNil)
+		err := k8s.Get(ctx, types.NamespacedName{Namespace: "team-ml", Name: "s3"}, &corev1.Secret{})
+		qt.Assert(t, apierrors.IsNotFound(err), qt.IsTrue)
+		err = k8s.Get(ctx, types.NamespacedName{Namespace: "team-ml", Name: "team-pypi"}, &corev1.Secret{})
+		qt.Assert(t, apierrors.IsNotFound(err), qt.IsTrue)
+	})
+	t.Run("Conflict", func(t *testing.T) {
+		err := p.Propagate(ctx, first, []Dependency{newSecretDependency("s3", "unmanaged")})
+		qt.Assert(t, err, qt.ErrorMatches, ErrDependencyConflict+": Secret team-ml/unmanaged isn't a copy of kubeflow/s3")
+		qt.Assert(t, getCopy(t, "unmanaged").Data["value"], qt.DeepEquals, []byte("mine"))
+
+		// a copy of another source isn't overwritten either
+		qt.Assert(t, p.Propagate(ctx, first, []Dependency{newSecretDependency("s3", "")}), qt.IsNil)
+		err = p.Propagate(ctx, first, []Dependency{newSecretDependency("pypi", "s3")})
+		qt.Assert(t, err, qt.ErrorMatches, ErrDependencyConflict+": Secret team-ml/s3 isn't a copy of kubeflow/pypi")
+		qt.Assert(t, getCopy(t, "s3").Annotations[AnnotationKeySource], qt.Equals, "kubeflow/s3")
+	})
+	t.Run("Restore", func(t *testing.T) {
+		rev := newRevision("nb-4", "4")
+		qt.Assert(t, Annotate(rev, mustCopies(t, deps, "team-ml")), qt.IsNil)
+		qt.Assert(t, p.Propagate(ctx, rev, deps), qt.IsNil)
+		qt.Assert(t, k8s.Delete(ctx, getCopy(t, "team-pypi")), qt.IsNil)
+
+		missing, err := p.Missing(ctx, rev)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, missing, qt.HasLen, 1)
+
+		qt.Assert(t, p.Restore(ctx, rev), qt.IsNil)
+		pypi := getCopy(t, "team-pypi")
+		qt.Assert(t, pypi.Annotations[AnnotationKeySource], qt.Equals, "kubeflow/pypi")
+		qt.Assert(t, owners(pypi), qt.DeepEquals, []types.UID{"4"})
+		missing, err = p.Missing(ctx, rev)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, missing, qt.HasLen, 0)
+	})
+	t.Run("RestoreWithoutSource", func(t *testing.T) {
+		rev := newRevision("nb-5", "5")
+		rev.SetAnnotations(map[string]string{
+			AnnotationKeyDependencies: `[{"name":"gone","apiVersion":"v1","kind":"Secret"}]`,
+		})
+		qt.Assert(t, p.Restore(ctx, rev), qt.ErrorMatches, ErrInvalidCopySource+`: Secret gone: ""`)
+	})
+}
+
+func TestCopies(t *testing.T) {
+	pypi := newSecretDependency("pypi", "team-pypi")
+
+	// dependencies are copied once, and not into their own namespace
+	copies, err := Copies([]Dependency{pypi, pypi}, "team-ml")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, copies, qt.DeepEquals, []Dependency{pypi})
+	copies, err = Copies([]Dependency{pypi}, "kubeflow")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, copies, qt.HasLen, 0)
+
+	// the same dependency from another namespace is a different object
+	other := pypi
+	other.Namespace = "team-data"
+	_, err = Copies([]Dependency{pypi, other}, "team-ml")
+	qt.Assert(t, err, qt.ErrorMatches, ErrDependencyConflict+": Secret team-pypi is copied from both kubeflow/pypi and team-data/pypi")
+
+	// and so is a different dependency copied under the same name
+	_, err = Copies([]Dependency{pypi, newSecretDependency("s3", "team-pypi")}, "team-ml")
+	qt.Assert(t, err, qt.ErrorMatches, ErrDependencyConflict+": Secret team-pypi is copied from both kubeflow/pypi and kubeflow/s3")
+}
+
+func TestRewrite(t *testing.T) {
+	spec := &v1beta1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+			Volumes: []corev1.Volume{
+				{Name: "pypi", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "pypi"}}},
+				{Name: "s3", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "s3"}}},
+			},
+			Containers: []corev1.Container{{
+				Name:    "main",
+				EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "pypi"}}}},
+				Env: []corev1.EnvVar{{Name: "INDEX", ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "pypi"}, Key: "url"},
+				}}},
+			}},
+		},
+	}
+	Rewrite(spec, []Dependency{newSecretDependency("pypi", "team-pypi"), newSecretDependency("s3", "")})
+
+	qt.Assert(t, spec.Spec.ImagePullSecrets[0].Name, qt.Equals, "registry")
+	qt.Assert(t, spec.Spec.Volumes[0].Secret.SecretName, qt.Equals, "team-pypi")
+	qt.Assert(t, spec.Spec.Volumes[1].Secret.SecretName, qt.Equals, "s3")
+	qt.Assert(t, spec.Spec.Containers[0].EnvFrom[0].SecretRef.Name, qt.Equals, "team-pypi")
+	qt.Assert(t, spec.Spec.Containers[0].Env[0].ValueFrom.SecretKeyRef.Name, qt.Equals, "team-pypi")
+}
@@ -0,0 +1,99 @@
+package dependency
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+// Rewrite renames the references in the pod template to the copies that
+// are made under a different name. The copies are the ones returned by
+// Copies. References to Secrets, ConfigMaps, PersistentVolumeClaims and
+// ServiceAccounts are rewritten.
+func Rewrite(spec *v1beta1.PodTemplateSpec, copies []Dependency) {
+	names := make(map[string]map[string]string)
+	for _, dep := range copies {
+		if dep.CopyName() == dep.Name {
+			continue
+		}
+		if dep.GroupVersionKind().Group != "" {
+			// only core resources are referenced by pods
+			continue
+		}
+		if names[dep.Kind] == nil {
+			names[dep.Kind] = make(map[string]string)
+		}
+		names[dep.Kind][dep.Name] = dep.CopyName()
+	}
+	if len(names) == 0 {
+		return
+	}
+	VisitReferences(&spec.Spec, func(kind string, name *string, _ bool) {
+		if to, ok := names[kind][*name]; ok {
+			*name = to
+		}
+	})
+}
+
+// VisitReferences calls fn with the kind and name of every Secret,
+// ConfigMap, PersistentVolumeClaim and ServiceAccount the pod references.
+// Optional is true when the pod can run without the object. The name can
+// be changed through the pointer.
+func VisitReferences(pod *corev1.PodSpec, fn func(kind string, name *string, optional bool)) {
+	if pod.ServiceAccountName != "" {
+		fn("ServiceAccount", &pod.ServiceAccountName, false)
+	}
+	for k := range pod.ImagePullSecrets {
+		// images are pulled anonymously without the secret
+		fn("Secret", &pod.ImagePullSecrets[k].Name, true)
+	}
+	for k := range pod.Volumes {
+		v := &pod.Volumes[k]
+		switch {
+		case v.Secret != nil:
+			fn("Secret", &v.Secret.SecretName, pointer.BoolDeref(v.Secret.Optional, false))
+		case v.ConfigMap != nil:
+			fn("ConfigMap", &v.ConfigMap.Name, pointer.BoolDeref(v.ConfigMap.Optional, false))
+		case v.PersistentVolumeClaim != nil:
+			fn("PersistentVolumeClaim", &v.PersistentVolumeClaim.ClaimName, false)
+		case v.Projected != nil:
+			for j := range v.Projected.Sources {
+				source := &v.Projected.Sources[j]
+				if source.Secret != nil {
+					fn("Secret", &source.Secret.Name, pointer.BoolDeref(source.Secret.Optional, false))
+				}
+				if source.ConfigMap != nil {
+					fn("ConfigMap", &source.ConfigMap.Name, pointer.BoolDeref(source.ConfigMap.Optional, false))
+				}
+			}
+		}
+	}
+
+	containers := func(items []corev1.Container) {
+		for k := range items {
+			c := &items[k]
+			for j := range c.EnvFrom {
+				if ref := c.EnvFrom[j].SecretRef; ref != nil {
+					fn("Secret", &ref.Name, pointer.BoolDeref(ref.Optional, false))
+				}
+				if ref := c.EnvFrom[j].ConfigMapRef; ref != nil {
+					fn("ConfigMap", &ref.Name, pointer.BoolDeref(ref.Optional, false))
+				}
+			}
+			for j := range c.Env {
+				if c.Env[j].ValueFrom == nil {
+					continue
+				}
+				if ref := c.Env[j].ValueFrom.SecretKeyRef; ref != nil {
+					fn("Secret", &ref.Name, pointer.BoolDeref(ref.Optional, false))
+				}
+				if ref := c.Env[j].ValueFrom.ConfigMapKeyRef; ref != nil {
+					fn("ConfigMap", &ref.Name, pointer.BoolDeref(ref.Optional, false))
+				}
+			}
+		}
+	}
+	containers(pod.InitContainers)
+	containers(pod.Containers)
+}
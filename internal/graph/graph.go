@@ -0,0 +1,132 @@
+// Package graph renders Dags as text graph descriptions, such as
+// Graphviz DOT and Mermaid flowcharts.
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+)
+
+const (
+	StatePending   = "Pending"
+	StateRunning   = "Running"
+	StateSucceeded = "Succeeded"
+	StateFailed    = "Failed"
+)
+
+var colors = map[string]string{
+	StateRunning:   "#fff3b0",
+	StateSucceeded: "#b7e4c7",
+	StateFailed:    "#f4a6a6",
+}
+
+// Render renders the Dag in the given format. If execution is not nil, the
+// tasks are coloured by their status in the Execution.
+func Render(format string, dag *v1beta1.Dag, execution *v1beta1.Execution) (string, error) {
+	switch format {
+	case FormatDOT:
+		return DOT(dag, execution), nil
+	case FormatMermaid:
+		return Mermaid(dag, execution), nil
+	}
+	return "", fmt.Errorf("unsupported graph format %q", format)
+}
+
+// TaskState returns the state of the named task in the Execution. If the
+// Execution is nil or the task hasn't started, StatePending is returned.
+func TaskState(execution *v1beta1.Execution, task string) string {
+	if execution == nil {
+		return StatePending
+	}
+	status, ok := execution.Status.Tasks[task]
+	switch {
+	case !ok:
+		return StatePending
+	case !status.Completed:
+		return StateRunning
+	case status.Succeeded:
+		return StateSucceeded
+	}
+	return StateFailed
+}
+
+// DOT renders the Dag as a Graphviz digraph. Edges point from a
+// dependency to the task that depends on it.
+func DOT(dag *v1beta1.Dag, execution *v1beta1.Execution) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "digraph %s {\n", strconv.Quote(dag.Name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, task := range dag.Spec.Tasks {
+		attrs := make([]string, 0, 3)
+		if task.IsDag() {
+			attrs = append(attrs, "shape=box3d")
+		}
+		if color, ok := colors[TaskState(execution, task.Name)]; ok {
+			attrs = append(attrs, "style=filled", "fillcolor="+strconv.Quote(color))
+		}
+		fmt.Fprintf(b, "  %s", strconv.Quote(task.Name))
+		if len(attrs) > 0 {
+			fmt.Fprintf(b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	for _, task := range dag.Spec.Tasks {
+		for _, dep := range task.Dependencies {
+			fmt.Fprintf(b, "  %s -> %s;\n", strconv.Quote(dep), strconv.Quote(task.Name))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the Dag as a Mermaid flowchart. Nodes are given
+// generated ids, so task names don't need to be valid Mermaid ids.
+func Mermaid(dag *v1beta1.Dag, execution *v1beta1.Execution) string {
+	ids := make(map[string]string, len(dag.Spec.Tasks))
+	for k, task := range dag.Spec.Tasks {
+		ids[task.Name] = fmt.Sprintf("t%d", k)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("flowchart LR\n")
+	classes := make(map[string][]string)
+	for _, task := range dag.Spec.Tasks {
+		label := strings.ReplaceAll(task.Name, `"`, "#quot;")
+		if task.IsDag() {
+			fmt.Fprintf(b, "  %s[[\"%s\"]]\n", ids[task.Name], label)
+		} else {
+			fmt.Fprintf(b, "  %s[\"%s\"]\n", ids[task.Name], label)
+		}
+		state := TaskState(execution, task.Name)
+		if _, ok := colors[state]; ok {
+			classes[state] = append(classes[state], ids[task.Name])
+		}
+	}
+	for _, task := range dag.Spec.Tasks {
+		for _, dep := range task.Dependencies {
+			from, ok := ids[dep]
+			if !ok {
+				// dependencies on unknown tasks have nowhere to point
+				continue
+			}
+			fmt.Fprintf(b, "  %s --> %s\n", from, ids[task.Name])
+		}
+	}
+	for _, state := range []string{StateRunning, StateSucceeded, StateFailed} {
+		if len(classes[state]) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "  classDef %s fill:%s\n", strings.ToLower(state), colors[state])
+		fmt.Fprintf(b, "  class %s %s\n", strings.Join(classes[state], ","), strings.ToLower(state))
+	}
+	return b.String()
+}
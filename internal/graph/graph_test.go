@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func newDag() *v1beta1.Dag {
+	return &v1beta1.Dag{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "test"},
+		Spec: v1beta1.DagSpec{
+			Entrypoint: "train",
+			Tasks: []v1beta1.DagTask{
+				{Name: "extract"},
+				{Name: "preprocess", DagRef: &corev1.LocalObjectReference{Name: "shared"}, Dependencies: []string{"extract"}},
+				{Name: "train", Dependencies: []string{"preprocess", "extract"}},
+			},
+		},
+	}
+}
+
+func newExecution() *v1beta1.Execution {
+	return &v1beta1.Execution{
+		Status: v1beta1.ExecutionStatus{
+			Tasks: map[string]v1beta1.ExecutionTaskStatus{
+				"extract":    {Completed: true, Succeeded: true},
+				"preprocess": {Completed: false},
+			},
+		},
+	}
+}
+
+func TestDOT(t *testing.T) {
+	want := `digraph "nightly" {
+  rankdir=LR;
+  node [shape=box];
+  "extract" [style=filled, fillcolor="#b7e4c7"];
+  "preprocess" [shape=box3d, style=filled, fillcolor="#fff3b0"];
+  "train";
+  "extract" -> "preprocess";
+  "preprocess" -> "train";
+  "extract" -> "train";
+}
+`
+	qt.Assert(t, DOT(newDag(), newExecution()), qt.Equals, want)
+}
+
+func TestMermaid(t *testing.T) {
+	want := `flowchart LR
+  t0["extract"]
+  t1[["preprocess"]]
+  t2["train"]
+  t0 --> t1
+  t1 --> t2
+  t0 --> t2
+  classDef running fill:#fff3b0
+  class t1 running
+  classDef succeeded fill:#b7e4c7
+  class t0 succeeded
+`
+	qt.Assert(t, Mermaid(newDag(), newExecution()), qt.Equals, want)
+}
+
+func TestRender_UnsupportedFormat(t *testing.T) {
+	_, err := Render("svg", newDag(), nil)
+	qt.Assert(t, err, qt.ErrorMatches, `unsupported graph format "svg"`)
+}
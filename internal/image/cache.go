@@ -0,0 +1,59 @@
+package image
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a resolved digest is used before the
+// registry is asked again.
+const DefaultCacheTTL = 5 * time.Minute
+
+// NewCachingResolver returns a Resolver that remembers the digests the
+// resolver returns for ttl. When the registry can't be reached after that,
+// the last digest it returned is used until it can be reached again.
+func NewCachingResolver(resolver Resolver, ttl time.Duration) Resolver {
+	return &cachingResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]cacheEntry),
+		now:      time.Now,
+	}
+}
+
+type cacheEntry struct {
+	digest  string
+	expires time.Time
+}
+
+type cachingResolver struct {
+	resolver Resolver
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func (r *cachingResolver) Resolve(ctx context.Context, ref Reference, auth Auth) (string, error) {
+	key := ref.String()
+	r.mu.Lock()
+	entry, ok := r.entries[key]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expires) {
+		return entry.digest, nil
+	}
+
+	digest, err := r.resolver.Resolve(ctx, ref, auth)
+	if err != nil {
+		if ok {
+			return entry.digest, nil
+		}
+		return "", err
+	}
+	r.mu.Lock()
+	r.entries[key] = cacheEntry{digest: digest, expires: r.now().Add(r.ttl)}
+	r.mu.Unlock()
+	return digest, nil
+}
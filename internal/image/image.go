@@ -0,0 +1,241 @@
+// Package image resolves container image tags to digests, so that
+// revisions keep running the same image when a tag is pushed again.
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultRegistry = "docker.io"
+	DefaultTag      = "latest"
+
+	ErrInvalidReference = "invalid image reference"
+	ErrResolveDigest    = "unable to resolve image digest"
+)
+
+// manifestTypes are the media types accepted when resolving a tag. Image
+// indexes are preferred so the digest is the same for every platform.
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// A Resolver resolves an image reference to the digest of its manifest.
+// The registry is accessed with auth, or anonymously if auth is empty.
+type Resolver interface {
+	Resolve(ctx context.Context, ref Reference, auth Auth) (string, error)
+}
+
+// Reference is a parsed image reference, such as
+// registry.example.com/jupyter/scipy:v1.7.0
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference. Images without a registry are
+// on Docker Hub, and images without a tag or digest are tagged latest.
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.Index(name, "/"); i >= 0 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		ref.Registry = name[:i]
+		name = name[i+1:]
+	}
+	if name == "" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return Reference{}, errors.Errorf("%s: %q", ErrInvalidReference, image)
+	}
+	if ref.Registry == "" {
+		ref.Registry = DefaultRegistry
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultTag
+	}
+	ref.Repository = name
+	return ref, nil
+}
+
+// String returns the reference with the default registry and tag filled
+// in by ParseReference.
+func (ref Reference) String() string {
+	name := ref.Registry + "/" + ref.Repository
+	if ref.Tag != "" {
+		name += ":" + ref.Tag
+	}
+	if ref.Digest != "" {
+		name += "@" + ref.Digest
+	}
+	return name
+}
+
+// Pin returns the image reference with the digest of its manifest. Images
+// that already have a digest are returned as they are. The tag is kept so
+// the pinned reference stays readable. The registry is accessed with the
+// credentials the keychain has for it, if any.
+func Pin(ctx context.Context, resolver Resolver, keychain Keychain, image string) (string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	if ref.Digest != "" {
+		return image, nil
+	}
+	digest, err := resolver.Resolve(ctx, ref, keychain.Auth(ref.Registry))
+	if err != nil {
+		return "", errors.Wrapf(err, "%s: %s", ErrResolveDigest, image)
+	}
+	return image + "@" + digest, nil
+}
+
+// NewRegistryResolver returns a Resolver that reads digests from the
+// registries using the OCI distribution API. Registries that ask for
+// credentials are accessed with basic auth or a bearer token, using the
+// credentials passed to Resolve, or anonymously if there are none.
+func NewRegistryResolver(c *http.Client) Resolver {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return &registryResolver{client: c}
+}
+
+type registryResolver struct {
+	client *http.Client
+}
+
+func (r *registryResolver) Resolve(ctx context.Context, ref Reference, auth Auth) (string, error) {
+	host := ref.Registry
+	if host == DefaultRegistry {
+		host = "registry-1.docker.io"
+	}
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, ref.Repository, ref.Tag)
+
+	resp, err := r.head(ctx, u, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err := r.authorize(ctx, resp.Header.Get("WWW-Authenticate"), auth)
+		if err != nil {
+			return "", err
+		}
+		resp, err = r.head(ctx, u, authorization)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status %s from %s", resp.Status, host)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.Errorf("%s didn't return a digest", host)
+	}
+	return digest, nil
+}
+
+func (r *registryResolver) head(ctx context.Context, u, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, resp.Body.Close()
+}
+
+// authorize returns the Authorization header that answers the challenge.
+func (r *registryResolver) authorize(ctx context.Context, challenge string, auth Auth) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch {
+	case strings.EqualFold(scheme, "Basic"):
+		if auth == (Auth{}) {
+			return "", errors.New("registry requires credentials")
+		}
+		return "Basic " + auth.encode(), nil
+	case strings.EqualFold(scheme, "Bearer"):
+		token, err := r.token(ctx, params, auth)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", errors.Errorf("unsupported authentication scheme %q", scheme)
+}
+
+// token requests a token for the parameters of a bearer challenge. The
+// token is anonymous if there are no credentials.
+func (r *registryResolver) token(ctx context.Context, params string, auth Auth) (string, error) {
+	values := url.Values{}
+	realm := ""
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		if key == "realm" {
+			realm = value
+			continue
+		}
+		values.Set(key, value)
+	}
+	if realm == "" {
+		return "", errors.New("bearer challenge doesn't have a realm")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+values.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth != (Auth{}) {
+		req.Header.Set("Authorization", "Basic "+auth.encode())
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected status %s requesting token", resp.Status)
+	}
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
@@ -0,0 +1,213 @@
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// registry is a minimal in-process OCI registry that serves manifest
+// digests, and requires a bearer token when token is set. When auth is
+// set, the credentials are required for the token, or for every request
+// if there's no token.
+type registry struct {
+	mu        sync.Mutex
+	manifests map[string]string
+	token     string
+	auth      Auth
+}
+
+func (r *registry) push(repo, tag, content string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sum := sha256.Sum256([]byte(content))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	r.manifests[repo+":"+tag] = digest
+	return digest
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	username, password, _ := req.BasicAuth()
+	authorized := r.auth == (Auth{}) || r.auth == Auth{Username: username, Password: password}
+	if req.URL.Path == "/token" {
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": r.token})
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="https://`+req.Host+`/token",service="registry",scope="repository:pull"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.token == "" && !authorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	repo, tag, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/manifests/")
+	if !ok || req.Method != http.MethodHead {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	r.mu.Lock()
+	digest, ok := r.manifests[repo+":"+tag]
+	r.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestParseReference(t *testing.T) {
+	tests := map[string]Reference{
+		"jupyter":                               {Registry: DefaultRegistry, Repository: "library/jupyter", Tag: "latest"},
+		"jupyter/scipy-notebook:v1.7.0":         {Registry: DefaultRegistry, Repository: "jupyter/scipy-notebook", Tag: "v1.7.0"},
+		"localhost:5000/scipy":                  {Registry: "localhost:5000", Repository: "scipy", Tag: "latest"},
+		"quay.io/jupyter/scipy:v1@sha256:abc":   {Registry: "quay.io", Repository: "jupyter/scipy", Tag: "v1", Digest: "sha256:abc"},
+		"registry.example.com/a/b/c@sha256:abc": {Registry: "registry.example.com", Repository: "a/b/c", Digest: "sha256:abc"},
+	}
+	for image, want := range tests {
+		t.Run(image, func(t *testing.T) {
+			got, err := ParseReference(image)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.Equals, want)
+		})
+	}
+	_, err := ParseReference("quay.io/")
+	qt.Assert(t, err, qt.ErrorMatches, ErrInvalidReference+".*")
+}
+
+func TestPin(t *testing.T) {
+	auth := Auth{Username: "jack", Password: "hunter2"}
+	tests := map[string]struct {
+		token string
+		auth  Auth
+	}{
+		"Anonymous":          {},
+		"BearerToken":        {token: "secret"},
+		"PrivateBearerToken": {token: "secret", auth: auth},
+		"BasicAuth":          {auth: auth},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := &registry{manifests: map[string]string{}, token: tt.token, auth: tt.auth}
+			srv := httptest.NewTLSServer(reg)
+			defer srv.Close()
+			host := strings.TrimPrefix(srv.URL, "https://")
+
+			ctx := context.Background()
+			resolver := NewRegistryResolver(srv.Client())
+			keychain := Keychain{host: tt.auth}
+			if tt.auth != (Auth{}) {
+				_, err := Pin(ctx, resolver, nil, host+"/jupyter/scipy:v1.7.0")
+				qt.Assert(t, err, qt.ErrorMatches, ErrResolveDigest+".*")
+			}
+
+			v1 := reg.push("jupyter/scipy", "v1.7.0", "first")
+			pinned, err := Pin(ctx, resolver, keychain, host+"/jupyter/scipy:v1.7.0")
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, pinned, qt.Equals, host+"/jupyter/scipy:v1.7.0@"+v1)
+
+			// pushing the tag again changes the digest it resolves to
+			v2 := reg.push("jupyter/scipy", "v1.7.0", "second")
+			pinned, err = Pin(ctx, resolver, keychain, host+"/jupyter/scipy:v1.7.0")
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, pinned, qt.Equals, host+"/jupyter/scipy:v1.7.0@"+v2)
+
+			// images with a digest aren't resolved
+			pinned, err = Pin(ctx, resolver, keychain, host+"/jupyter/missing@"+v1)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, pinned, qt.Equals, host+"/jupyter/missing@"+v1)
+
+			_, err = Pin(ctx, resolver, keychain, host+"/jupyter/missing:v1")
+			qt.Assert(t, err, qt.ErrorMatches, ErrResolveDigest+".*404 Not Found.*")
+		})
+	}
+}
+
+func TestCachingResolver(t *testing.T) {
+	reg := &registry{manifests: map[string]string{}}
+	srv := httptest.NewTLSServer(reg)
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	ctx := context.Background()
+	now := time.Now()
+	resolver := NewCachingResolver(NewRegistryResolver(srv.Client()), time.Minute).(*cachingResolver)
+	resolver.now = func() time.Time { return now }
+
+	v1 := reg.push("jupyter/scipy", "v1.7.0", "first")
+	pinned, err := Pin(ctx, resolver, nil, host+"/jupyter/scipy:v1.7.0")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned, qt.Equals, host+"/jupyter/scipy:v1.7.0@"+v1)
+
+	// the digest is cached until it expires
+	v2 := reg.push("jupyter/scipy", "v1.7.0", "second")
+	pinned, err = Pin(ctx, resolver, nil, host+"/jupyter/scipy:v1.7.0")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned, qt.Equals, host+"/jupyter/scipy:v1.7.0@"+v1)
+
+	now = now.Add(2 * time.Minute)
+	pinned, err = Pin(ctx, resolver, nil, host+"/jupyter/scipy:v1.7.0")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned, qt.Equals, host+"/jupyter/scipy:v1.7.0@"+v2)
+
+	// the last digest is used while the registry is down
+	srv.Close()
+	now = now.Add(2 * time.Minute)
+	pinned, err = Pin(ctx, resolver, nil, host+"/jupyter/scipy:v1.7.0")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, pinned, qt.Equals, host+"/jupyter/scipy:v1.7.0@"+v2)
+	_, err = Pin(ctx, resolver, nil, host+"/jupyter/minimal:v1.7.0")
+	qt.Assert(t, err, qt.ErrorMatches, ErrResolveDigest+".*")
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	auth := Auth{Username: "jack", Password: "hunter2"}
+	tests := map[string]struct {
+		data string
+		want Keychain
+	}{
+		"DockerConfigJSON": {
+			data: `{"auths": {"registry.example.com": {"auth": "amFjazpodW50ZXIy"}}}`,
+			want: Keychain{"registry.example.com": auth},
+		},
+		"DockerConfigJSONUsername": {
+			data: `{"auths": {"https://index.docker.io/v1/": {"username": "jack", "password": "hunter2"}}}`,
+			want: Keychain{"index.docker.io": auth},
+		},
+		"DockerCfg": {
+			data: `{"quay.io": {"auth": "amFjazpodW50ZXIy"}}`,
+			want: Keychain{"quay.io": auth},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseDockerConfig([]byte(tt.data))
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, got, qt.DeepEquals, tt.want)
+		})
+	}
+
+	// Docker Hub credentials are stored under several names
+	keychain, err := ParseDockerConfig([]byte(tests["DockerConfigJSONUsername"].data))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, keychain.Auth(DefaultRegistry), qt.Equals, auth)
+	qt.Assert(t, keychain.Auth("quay.io"), qt.Equals, Auth{})
+
+	_, err = ParseDockerConfig([]byte(`{"auths": {"quay.io": {"auth": "not base64"}}}`))
+	qt.Assert(t, err, qt.ErrorMatches, ErrInvalidDockerConfig+".*")
+}
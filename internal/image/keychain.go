@@ -0,0 +1,102 @@
+package image
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ErrInvalidDockerConfig = "invalid docker config"
+)
+
+// dockerHubHosts are the names Docker Hub credentials are stored under.
+var dockerHubHosts = []string{DefaultRegistry, "index.docker.io", "registry-1.docker.io"}
+
+// Auth is the username and password used to access a registry.
+type Auth struct {
+	Username string
+	Password string
+}
+
+func (a Auth) encode() string {
+	return base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password))
+}
+
+// A Keychain has the credentials for registries, by registry host.
+type Keychain map[string]Auth
+
+// Auth returns the credentials for the registry, or empty credentials
+// if the keychain doesn't have any.
+func (k Keychain) Auth(registry string) Auth {
+	if auth, ok := k[registry]; ok {
+		return auth
+	}
+	if registry == DefaultRegistry {
+		for _, host := range dockerHubHosts {
+			if auth, ok := k[host]; ok {
+				return auth
+			}
+		}
+	}
+	return Auth{}
+}
+
+// Merge adds the credentials in other for registries the keychain
+// doesn't have credentials for yet.
+func (k Keychain) Merge(other Keychain) {
+	for host, auth := range other {
+		if _, ok := k[host]; !ok {
+			k[host] = auth
+		}
+	}
+}
+
+// ParseDockerConfig returns the credentials in the data of an image pull
+// secret, in either the .dockerconfigjson or the legacy .dockercfg format.
+func ParseDockerConfig(data []byte) (Keychain, error) {
+	type entry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	config := struct {
+		Auths map[string]entry `json:"auths"`
+	}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, ErrInvalidDockerConfig)
+	}
+	if config.Auths == nil {
+		if err := json.Unmarshal(data, &config.Auths); err != nil {
+			return nil, errors.Wrap(err, ErrInvalidDockerConfig)
+		}
+	}
+
+	keychain := make(Keychain, len(config.Auths))
+	for server, e := range config.Auths {
+		auth := Auth{Username: e.Username, Password: e.Password}
+		if e.Auth != "" {
+			raw, err := base64.StdEncoding.DecodeString(e.Auth)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: %s", ErrInvalidDockerConfig, server)
+			}
+			username, password, ok := strings.Cut(string(raw), ":")
+			if !ok {
+				return nil, errors.Errorf("%s: %s: auth isn't a username and password", ErrInvalidDockerConfig, server)
+			}
+			auth = Auth{Username: username, Password: password}
+		}
+		keychain[registryHost(server)] = auth
+	}
+	return keychain, nil
+}
+
+// registryHost returns the host of a server in a docker config, which
+// may be a URL such as https://index.docker.io/v1/.
+func registryHost(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	host, _, _ := strings.Cut(server, "/")
+	return host
+}
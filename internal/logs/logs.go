@@ -0,0 +1,170 @@
+// Package logs collects the logs of finished workload pods and stores
+// them somewhere that outlives the pod.
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+const (
+	// DefaultLimitBytes is the default number of bytes kept from the
+	// end of a container's logs. It's well under the size limit of a
+	// ConfigMap.
+	DefaultLimitBytes = 256 * 1024
+
+	// ConfigMapKey is the key in a ConfigMap the logs are stored under.
+	ConfigMapKey = "logs"
+)
+
+var (
+	LabelKeyExecution = fmt.Sprintf("%s/execution", v1beta1.GroupName)
+)
+
+// A Source streams the logs of a container.
+type Source interface {
+	// Stream returns a reader for the logs of the container in the pod.
+	// The caller is responsible for closing the reader.
+	Stream(ctx context.Context, namespace, pod, container string) (io.ReadCloser, error)
+}
+
+// A Sink stores the logs of an Execution's task.
+type Sink interface {
+	// Store saves the logs for the task and returns a reference to
+	// where they were stored.
+	Store(ctx context.Context, execution *v1beta1.Execution, task string, data []byte) (string, error)
+}
+
+// A Collector copies the logs of a finished task's container from a
+// Source to a Sink.
+type Collector struct {
+	Source Source
+	Sink   Sink
+	// LimitBytes is the number of bytes kept from the end of the logs.
+	// If LimitBytes is zero, DefaultLimitBytes is used.
+	LimitBytes int
+}
+
+// Collect copies the logs of the container in pod and returns the
+// reference to the stored logs.
+func (c *Collector) Collect(ctx context.Context, execution *v1beta1.Execution, task, pod, container string) (string, error) {
+	limit := c.LimitBytes
+	if limit == 0 {
+		limit = DefaultLimitBytes
+	}
+	rc, err := c.Source.Stream(ctx, execution.Namespace, pod, container)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	data, err := Tail(rc, limit)
+	if err != nil {
+		return "", err
+	}
+	return c.Sink.Store(ctx, execution, task, data)
+}
+
+// NewClientsetSource returns a Source that reads logs through the
+// Kubernetes API.
+func NewClientsetSource(cs kubernetes.Interface) Source {
+	return &clientsetSource{cs: cs}
+}
+
+type clientsetSource struct {
+	cs kubernetes.Interface
+}
+
+func (s *clientsetSource) Stream(ctx context.Context, namespace, pod, container string) (io.ReadCloser, error) {
+	return s.cs.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{Container: container}).Stream(ctx)
+}
+
+// NewConfigMapSink returns a Sink that stores logs in a ConfigMap
+// owned by the Execution, so the logs are removed with it.
+func NewConfigMapSink(c client.Client) Sink {
+	return &configMapSink{client: c}
+}
+
+type configMapSink struct {
+	client client.Client
+}
+
+func (s *configMapSink) Store(ctx context.Context, execution *v1beta1.Execution, task string, data []byte) (string, error) {
+	cm := &corev1.ConfigMap{}
+	cm.SetName(execution.Name + "-" + task + "-logs")
+	cm.SetNamespace(execution.Namespace)
+	cm.SetLabels(map[string]string{LabelKeyExecution: execution.Name})
+	cm.SetOwnerReferences([]metav1.OwnerReference{execution.AsOwner()})
+	cm.Data = map[string]string{ConfigMapKey: string(data)}
+	if err := s.client.Create(ctx, cm); client.IgnoreAlreadyExists(err) != nil {
+		return "", err
+	}
+	return "configmap/" + cm.Name, nil
+}
+
+// NewFileSink returns a Sink that stores logs as files under dir, such
+// as a mounted PersistentVolumeClaim. Logs are stored at
+// <dir>/<namespace>/<execution>/<task>.log
+func NewFileSink(dir string) Sink {
+	return &fileSink{dir: dir}
+}
+
+type fileSink struct {
+	dir string
+}
+
+func (s *fileSink) Store(_ context.Context, execution *v1beta1.Execution, task string, data []byte) (string, error) {
+	dir := filepath.Join(s.dir, execution.Namespace, execution.Name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, task+".log")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		return "", err
+	}
+	return "file://" + name, nil
+}
+
+// Tail reads r to the end and returns at most the last limit bytes. If
+// limit is less than or equal to zero, everything is returned. Logs that
+// are cut start at the beginning of a UTF-8 character, so a character
+// split by the limit is dropped rather than stored partly.
+func Tail(r io.Reader, limit int) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	buf := make([]byte, 0, limit)
+	chunk := make([]byte, 32*1024)
+	truncated := false
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if len(buf) > limit {
+			buf = append(buf[:0], buf[len(buf)-limit:]...)
+			truncated = true
+		}
+		if err != nil && err != io.EOF {
+			return buf, err
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if truncated {
+		for k := 0; k < utf8.UTFMax-1 && len(buf) > 0 && !utf8.RuneStart(buf[0]); k++ {
+			buf = buf[1:]
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,51 @@
+package logs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestTail(t *testing.T) {
+	tests := map[string]struct {
+		in    string
+		limit int
+		want  string
+	}{
+		"UnderLimit": {in: "hello", limit: 10, want: "hello"},
+		"OverLimit":  {in: "hello world", limit: 5, want: "world"},
+		"NoLimit":    {in: "hello world", limit: 0, want: "hello world"},
+		"ManyChunks": {in: strings.Repeat("a", 100*1024) + "end", limit: 3, want: "end"},
+		// é is two bytes, so the limit falls in the middle of it
+		"SplitRune": {in: "café au lait", limit: 9, want: " au lait"},
+		"WholeRune": {in: "café au lait", limit: 10, want: "é au lait"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Tail(strings.NewReader(tt.in), tt.limit)
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, string(got), qt.Equals, tt.want)
+		})
+	}
+}
+
+func TestFileSink_Store(t *testing.T) {
+	dir := t.TempDir()
+	execution := &v1beta1.Execution{ObjectMeta: metav1.ObjectMeta{Name: "execution1", Namespace: "test"}}
+
+	ref, err := NewFileSink(dir).Store(context.Background(), execution, "task1", []byte("output"))
+	qt.Assert(t, err, qt.IsNil)
+
+	name := filepath.Join(dir, "test", "execution1", "task1.log")
+	qt.Assert(t, ref, qt.Equals, "file://"+name)
+	data, err := os.ReadFile(name)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, string(data), qt.Equals, "output")
+}
@@ -0,0 +1,262 @@
+package revision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+const (
+	ErrInvalidRevisionData = "unable to read the revision's pod template"
+
+	// maxSummaryChanges is the number of changes described in a summary
+	// before the rest are counted.
+	maxSummaryChanges = 5
+)
+
+var (
+	// AnnotationKeyChangeSummary describes how a Revision differs from the
+	// Revision published before it.
+	AnnotationKeyChangeSummary = fmt.Sprintf("%s/change-summary", v1beta1.GroupName)
+)
+
+// A Change is a field of the pod template that differs between two
+// revisions. From is nil when the field was added, and To is nil when
+// it was removed.
+type Change struct {
+	Path string `json:"path"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+func (c Change) String() string {
+	switch {
+	case c.From == nil:
+		return fmt.Sprintf("%s added", c.Path)
+	case c.To == nil:
+		return fmt.Sprintf("%s removed", c.Path)
+	case isScalar(c.From) && isScalar(c.To):
+		return fmt.Sprintf("%s changed from %v to %v", c.Path, c.From, c.To)
+	}
+	return fmt.Sprintf("%s changed", c.Path)
+}
+
+// A Diff is the difference between the pod templates of two revisions.
+type Diff struct {
+	// Patch is the strategic merge patch from the first pod template
+	// to the second.
+	Patch json.RawMessage `json:"patch"`
+	// Changes are the fields that differ, ordered by path.
+	Changes []Change `json:"changes"`
+}
+
+// Empty returns true if the pod templates are the same.
+func (d *Diff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Summary returns a short description of the changes.
+func (d *Diff) Summary() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	parts := make([]string, 0, maxSummaryChanges+1)
+	for k, change := range d.Changes {
+		if k == maxSummaryChanges {
+			parts = append(parts, fmt.Sprintf("and %d more", len(d.Changes)-k))
+			break
+		}
+		parts = append(parts, change.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// DiffRevisions returns the difference between the pod templates of
+// two revisions.
+func DiffRevisions(from, to *v1beta1.Revision) (*Diff, error) {
+	original, err := podTemplateSpec(from)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := podTemplateSpec(to)
+	if err != nil {
+		return nil, err
+	}
+	return DiffPodTemplateSpecs(original, modified)
+}
+
+// DiffPodTemplateSpecs returns the difference between two pod templates.
+func DiffPodTemplateSpecs(from, to v1beta1.PodTemplateSpec) (*Diff, error) {
+	raw, err := createStrategicMergePatch(from, to)
+	if err != nil {
+		return nil, err
+	}
+	patch := make(map[string]any)
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, err
+	}
+	original := make(map[string]any)
+	if err := remarshal(from, &original); err != nil {
+		return nil, err
+	}
+	schema, err := strategicpatch.NewPatchMetaFromStruct(v1beta1.PodTemplateSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+	walkPatch("", patch, original, schema, &changes)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return &Diff{Patch: raw, Changes: changes}, nil
+}
+
+// Diff returns the difference between a published revision and the
+// revision that would be published for the Referrer now, without
+// creating it.
+func (r *Publisher) Diff(ctx context.Context, impl Referrer, from *v1beta1.Revision) (*Diff, error) {
+	to, _, err := r.Render(ctx, impl)
+	if err != nil {
+		return nil, err
+	}
+	return DiffRevisions(from, to)
+}
+
+func podTemplateSpec(rev *v1beta1.Revision) (v1beta1.PodTemplateSpec, error) {
+	spec := v1beta1.PodTemplateSpec{}
+	if err := json.Unmarshal(rev.GetData(), &spec); err != nil {
+		return spec, errors.Wrapf(err, "%s: %s", ErrInvalidRevisionData, rev.GetName())
+	}
+	return spec, nil
+}
+
+// walkPatch records a Change for each field the patch sets or removes.
+// Lists that are merged by key are matched element by element, so a
+// change to one container isn't reported as a change to all of them.
+// The schema may be nil when the patch doesn't match the pod template's
+// type, in which case lists are compared as a whole.
+func walkPatch(path string, patch, original map[string]any, schema strategicpatch.LookupPatchMeta, changes *[]Change) {
+	for key, value := range patch {
+		switch {
+		case key == "$patch", key == "$retainKeys", strings.HasPrefix(key, "$setElementOrder/"):
+			continue
+		case strings.HasPrefix(key, "$deleteFromPrimitiveList/"):
+			field := strings.TrimPrefix(key, "$deleteFromPrimitiveList/")
+			items, _ := value.([]any)
+			for _, item := range items {
+				*changes = append(*changes, Change{Path: fmt.Sprintf("%s[%v]", join(path, field), item), From: item})
+			}
+			continue
+		}
+
+		current := original[key]
+		switch v := value.(type) {
+		case nil:
+			*changes = append(*changes, Change{Path: join(path, key), From: current})
+		case map[string]any:
+			orig, ok := current.(map[string]any)
+			if !ok {
+				*changes = append(*changes, Change{Path: join(path, key), From: current, To: v})
+				continue
+			}
+			var sub strategicpatch.LookupPatchMeta
+			if schema != nil {
+				sub, _, _ = schema.LookupPatchMetadataForStruct(key)
+			}
+			walkPatch(join(path, key), v, orig, sub, changes)
+		case []any:
+			mergeKey := ""
+			var sub strategicpatch.LookupPatchMeta
+			if schema != nil {
+				var meta strategicpatch.PatchMeta
+				sub, meta, _ = schema.LookupPatchMetadataForSlice(key)
+				for _, strategy := range meta.GetPatchStrategies() {
+					if strategy == "merge" {
+						mergeKey = meta.GetPatchMergeKey()
+					}
+				}
+			}
+			orig, _ := current.([]any)
+			if mergeKey == "" {
+				*changes = append(*changes, Change{Path: join(path, key), From: current, To: v})
+				continue
+			}
+			walkMergeList(join(path, key), mergeKey, v, orig, sub, changes)
+		default:
+			*changes = append(*changes, Change{Path: join(path, key), From: current, To: v})
+		}
+	}
+}
+
+func walkMergeList(path, mergeKey string, patch, original []any, schema strategicpatch.LookupPatchMeta, changes *[]Change) {
+	for _, item := range patch {
+		element, ok := item.(map[string]any)
+		if !ok {
+			// a list of primitives merged as a set
+			if !containsValue(original, item) {
+				*changes = append(*changes, Change{Path: fmt.Sprintf("%s[%v]", path, item), To: item})
+			}
+			continue
+		}
+		elementPath := fmt.Sprintf("%s[%s=%v]", path, mergeKey, element[mergeKey])
+		var orig map[string]any
+		for _, o := range original {
+			if m, ok := o.(map[string]any); ok && m[mergeKey] == element[mergeKey] {
+				orig = m
+			}
+		}
+		switch {
+		case element["$patch"] == "delete":
+			*changes = append(*changes, Change{Path: elementPath, From: orig})
+		case orig == nil:
+			*changes = append(*changes, Change{Path: elementPath, To: element})
+		default:
+			fields := make(map[string]any, len(element))
+			for k, v := range element {
+				if k != mergeKey {
+					fields[k] = v
+				}
+			}
+			walkPatch(elementPath, fields, orig, schema, changes)
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func containsValue(items []any, value any) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isScalar(v any) bool {
+	switch v.(type) {
+	case string, bool, float64, int64:
+		return true
+	}
+	return false
+}
+
+// remarshal converts v to the JSON representation used by patches.
+func remarshal(v any, out any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
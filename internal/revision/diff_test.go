@@ -0,0 +1,87 @@
+package revision
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestDiffPodTemplateSpecs(t *testing.T) {
+	from := v1beta1.PodTemplateSpec{
+		ObjectMeta: v1beta1.ObjectMeta{Labels: map[string]string{"team": "ml", "tier": "gpu"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "main", Image: "jupyter:v1", Env: []corev1.EnvVar{{Name: "A", Value: "1"}}},
+			{Name: "sidecar", Image: "proxy:v1"},
+		}},
+	}
+	to := *from.DeepCopy()
+	to.Labels = map[string]string{"team": "ml"}
+	to.Spec.Containers[0].Image = "jupyter:v2"
+	to.Spec.Containers[0].Env = append(to.Spec.Containers[0].Env, corev1.EnvVar{Name: "B", Value: "2"})
+	to.Spec.Containers = to.Spec.Containers[:1]
+
+	diff, err := DiffPodTemplateSpecs(from, to)
+	qt.Assert(t, err, qt.IsNil)
+
+	paths := make([]string, 0, len(diff.Changes))
+	for _, change := range diff.Changes {
+		paths = append(paths, change.Path)
+	}
+	qt.Assert(t, paths, qt.DeepEquals, []string{
+		"metadata.labels.tier",
+		"spec.containers[name=main].env[name=B]",
+		"spec.containers[name=main].image",
+		"spec.containers[name=sidecar]",
+	})
+	qt.Assert(t, diff.Summary(), qt.Equals,
+		"metadata.labels.tier removed; "+
+			"spec.containers[name=main].env[name=B] added; "+
+			"spec.containers[name=main].image changed from jupyter:v1 to jupyter:v2; "+
+			"spec.containers[name=sidecar] removed")
+
+	qt.Assert(t, string(diff.Patch), qt.Contains, `"image":"jupyter:v2"`)
+
+	diff, err = DiffPodTemplateSpecs(from, from)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, diff.Empty(), qt.IsTrue)
+	qt.Assert(t, diff.Summary(), qt.Equals, "no changes")
+}
+
+func TestPublisher_Create_ChangeSummary(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(template).Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	nb := newNotebook("nb", "test", v1beta1.TemplateReference{Name: "jupyter"})
+
+	first, err := pub.Create(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, first.GetAnnotations(), qt.Not(qt.Contains), AnnotationKeyChangeSummary)
+
+	qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(template), template), qt.IsNil)
+	template.Spec.Template.Spec.Containers[0].Image = "jupyter:v2"
+	qt.Assert(t, k8s.Update(ctx, template), qt.IsNil)
+
+	// the latest rendering differs from the first revision
+	diff, err := pub.Diff(ctx, nb, first)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, diff.Changes, qt.HasLen, 1)
+
+	second, err := pub.Create(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, second.GetAnnotations()[AnnotationKeyChangeSummary], qt.Equals,
+		"spec.containers[name=main].image changed from jupyter:v1 to jupyter:v2")
+}
@@ -0,0 +1,40 @@
+package revision
+
+// An InvalidError is returned when a revision can't be published because
+// the Referrer's values can't be used with its template, such as options
+// the template doesn't have. Publishing fails until the Referrer or the
+// template is changed, so the error shouldn't be retried.
+type InvalidError struct {
+	// Reason is a CamelCase reason for the error, suitable for Events
+	// and conditions.
+	Reason string
+	err    error
+}
+
+func (e *InvalidError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the underlying error.
+func (e *InvalidError) Cause() error {
+	return e.err
+}
+
+func invalid(reason string, err error) error {
+	return &InvalidError{Reason: reason, err: err}
+}
+
+// IsInvalid returns the InvalidError if err is, or wraps, an InvalidError.
+func IsInvalid(err error) (*InvalidError, bool) {
+	for err != nil {
+		if e, ok := err.(*InvalidError); ok {
+			return e, true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil, false
+		}
+		err = cause.Cause()
+	}
+	return nil, false
+}
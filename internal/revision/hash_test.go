@@ -0,0 +1,267 @@
+package revision
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestRevision_Sum(t *testing.T) {
+	rev := func(data string, options ...string) *v1beta1.Revision {
+		rev := &v1beta1.Revision{Spec: v1beta1.RevisionSpec{
+			TemplateRef: &v1beta1.TemplateReference{Name: "jupyter", Namespace: "test"},
+			Options:     options,
+		}}
+		rev.SetData([]byte(data))
+		return rev
+	}
+
+	base := rev(`{"spec": {"containers": [{"name": "main", "image": "jupyter:v1"}]}}`, "spark", "gpu")
+	qt.Assert(t, base.Sum(), qt.HasLen, 64)
+	qt.Assert(t, base.Hash(), qt.HasLen, v1beta1.RevisionHashLength)
+
+	// formatting, key order and option order don't change the sum
+	same := rev("{\n  \"spec\":{\"containers\":[{\"image\":\"jupyter:v1\",\"name\":\"main\"}]}\n}", "gpu", "spark")
+	qt.Assert(t, same.Sum(), qt.Equals, base.Sum())
+
+	// an unset kind is a Template
+	same.Spec.TemplateRef.Kind = v1beta1.KindTemplate
+	qt.Assert(t, same.Sum(), qt.Equals, base.Sum())
+
+	// the template and options are part of the identity
+	other := rev(`{"spec": {"containers": [{"name": "main", "image": "jupyter:v1"}]}}`, "spark")
+	qt.Assert(t, other.Sum(), qt.Not(qt.Equals), base.Sum())
+	other = rev(`{"spec": {"containers": [{"name": "main", "image": "jupyter:v1"}]}}`, "spark", "gpu")
+	other.Spec.TemplateRef.Name = "jupyter-gpu"
+	qt.Assert(t, other.Sum(), qt.Not(qt.Equals), base.Sum())
+
+	// elected and stopped change over the life of a revision
+	other = rev(`{"spec": {"containers": [{"name": "main", "image": "jupyter:v1"}]}}`, "spark", "gpu")
+	other.Elect()
+	other.Stop()
+	qt.Assert(t, other.Sum(), qt.Equals, base.Sum())
+}
+
+func TestPublisher_Create_HashCollision(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	// at most one revision is elected after every write
+	elected := func(ctx context.Context, c client.WithWatch) int {
+		revList := &v1beta1.RevisionList{}
+		qt.Assert(t, c.List(ctx, revList), qt.IsNil)
+		count := 0
+		for k := range revList.Items {
+			if revList.Items[k].Elected() {
+				count++
+			}
+		}
+		return count
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				err := c.Create(ctx, obj, opts...)
+				qt.Check(t, elected(ctx, c) <= 1, qt.IsTrue)
+				return err
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				err := c.Patch(ctx, obj, patch, opts...)
+				qt.Check(t, elected(ctx, c) <= 1, qt.IsTrue)
+				return err
+			},
+		}).
+		Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	nb := newNotebook("nb", "test", v1beta1.TemplateReference{Name: "jupyter"})
+
+	rendered, _, err := pub.Render(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+
+	// a different revision that happens to have the same name
+	collision := &v1beta1.Revision{ObjectMeta: metav1.ObjectMeta{
+		Name:      rendered.GetName(),
+		Namespace: "test",
+		Labels:    map[string]string{LabelKeyName: "nb"},
+	}}
+	collision.SetData([]byte(`{"spec":{"containers":[{"name":"main","image":"other:v1"}]}}`))
+	qt.Assert(t, k8s.Create(ctx, collision), qt.IsNil)
+
+	rev, err := pub.Create(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, rev.GetName(), qt.Equals, rendered.GetName()+"-1")
+	qt.Assert(t, unmarshalRevision(t, rev).Spec.Containers[0].Image, qt.Equals, "jupyter:v1")
+	qt.Assert(t, rev.GetAnnotations()[v1beta1.AnnotationKeyRevisionHash], qt.Equals, rendered.Sum())
+
+	// publishing again finds the revision past the collision
+	again, err := pub.Create(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, again.GetName(), qt.Equals, rev.GetName())
+	revList, err := pub.List(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, revList.Items, qt.HasLen, 2)
+}
+
+func TestPublisher_Migrate(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	// at most one revision is elected after every write
+	elected := func(ctx context.Context, c client.WithWatch) int {
+		revList := &v1beta1.RevisionList{}
+		qt.Assert(t, c.List(ctx, revList), qt.IsNil)
+		count := 0
+		for k := range revList.Items {
+			if revList.Items[k].Elected() {
+				count++
+			}
+		}
+		return count
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				err := c.Create(ctx, obj, opts...)
+				qt.Check(t, elected(ctx, c) <= 1, qt.IsTrue)
+				return err
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				err := c.Patch(ctx, obj, patch, opts...)
+				qt.Check(t, elected(ctx, c) <= 1, qt.IsTrue)
+				return err
+			},
+		}).
+		Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	nb := newNotebook("nb", "test", v1beta1.TemplateReference{Name: "jupyter"})
+
+	rendered, _, err := pub.Render(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+
+	// a revision published with the old hash, before the template and
+	// options were recorded
+	legacy := &v1beta1.Revision{ObjectMeta: metav1.ObjectMeta{
+		Name:        "nb-1a2b3c4d",
+		Namespace:   "test",
+		Labels:      map[string]string{LabelKeyName: "nb"},
+		Annotations: map[string]string{LabelKeyTemplate: "test/jupyter"},
+	}}
+	legacy.SetData(rendered.GetData())
+	legacy.Elect()
+	qt.Assert(t, k8s.Create(ctx, legacy), qt.IsNil)
+
+	renamed, err := pub.Migrate(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, renamed, qt.DeepEquals, map[string]string{"nb-1a2b3c4d": rendered.GetName()})
+
+	err = k8s.Get(ctx, client.ObjectKeyFromObject(legacy), &v1beta1.Revision{})
+	qt.Assert(t, err, qt.ErrorMatches, ".*not found.*")
+	migrated, err := pub.Elected(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, migrated.GetName(), qt.Equals, rendered.GetName())
+	qt.Assert(t, migrated.GetAnnotations()[v1beta1.AnnotationKeyMigratedFrom], qt.Equals, "nb-1a2b3c4d")
+
+	// publishing the same content finds the migrated revision
+	rev, err := pub.Create(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, rev.GetName(), qt.Equals, rendered.GetName())
+	revList, err := pub.List(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, revList.Items, qt.HasLen, 1)
+
+	// migrated revisions aren't migrated again
+	renamed, err = pub.Migrate(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, renamed, qt.HasLen, 0)
+}
+
+func TestPublisher_Migrate_Identity(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(template).Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	// the notebook has since moved to another template and elected an
+	// option, which the legacy revisions weren't published from
+	nb := newNotebook("nb", "test", v1beta1.TemplateReference{Name: "jupyter-gpu"}, "gpu")
+
+	for name, ref := range map[string]string{"nb-1a2b3c4d": "test/jupyter", "nb-5e6f7a8b": "/jupyter"} {
+		legacy := &v1beta1.Revision{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "test",
+			Labels:      map[string]string{LabelKeyName: "nb"},
+			Annotations: map[string]string{LabelKeyTemplate: ref},
+		}}
+		legacy.SetData([]byte(`{"spec":{"containers":[{"name":"main","image":"` + name + `"}]}}`))
+		qt.Assert(t, k8s.Create(ctx, legacy), qt.IsNil)
+	}
+
+	renamed, err := pub.Migrate(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, renamed, qt.HasLen, 2)
+
+	rev, err := pub.Get(ctx, nb, renamed["nb-1a2b3c4d"])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, rev.Spec.TemplateRef, qt.DeepEquals, &v1beta1.TemplateReference{Name: "jupyter", Namespace: "test", Kind: v1beta1.KindTemplate})
+	qt.Assert(t, rev.Spec.Options, qt.HasLen, 0)
+
+	rev, err = pub.Get(ctx, nb, renamed["nb-5e6f7a8b"])
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, rev.Spec.TemplateRef, qt.DeepEquals, &v1beta1.TemplateReference{Name: "jupyter", Kind: v1beta1.KindClusterTemplate})
+}
+
+func TestRevisionName(t *testing.T) {
+	long := strings.Repeat("notebook", 7)
+	name := revisionName(long, strings.Repeat("a", v1beta1.RevisionHashLength))
+	qt.Assert(t, len(name+"-10") <= validation.LabelValueMaxLength, qt.IsTrue)
+	qt.Assert(t, validation.IsValidLabelValue(name+"-10"), qt.HasLen, 0)
+	qt.Assert(t, revisionName("nb", "abc"), qt.Equals, "nb-abc")
+
+	// revisions of Referrers whose names are the same once truncated
+	// aren't shared
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(template).Build()
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	first, err := pub.Create(ctx, newNotebook(long+"-a", "test", v1beta1.TemplateReference{Name: "jupyter"}))
+	qt.Assert(t, err, qt.IsNil)
+	second, err := pub.Create(ctx, newNotebook(long+"-b", "test", v1beta1.TemplateReference{Name: "jupyter"}))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, second.GetName(), qt.Not(qt.Equals), first.GetName())
+	qt.Assert(t, second.GetLabels()[LabelKeyName], qt.Equals, long+"-b")
+}
@@ -0,0 +1,88 @@
+package revision
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/dependency"
+	"github.com/johnhoman/notebook-controller/internal/image"
+)
+
+// PinImages replaces the image of every container in the pod template
+// with a reference to the digest its tag resolves to. Each image is only
+// resolved once. Images whose digest can't be resolved, for example
+// because the registry is down, keep their tag, and are returned with
+// the reason.
+func PinImages(ctx context.Context, resolver image.Resolver, keychain image.Keychain, spec *v1beta1.PodTemplateSpec) (map[string]error, error) {
+	pinned := make(map[string]string)
+	unpinned := make(map[string]error)
+	pin := func(containers []corev1.Container) error {
+		for k := range containers {
+			c := &containers[k]
+			if c.Image == "" {
+				continue
+			}
+			if ref, ok := pinned[c.Image]; ok {
+				c.Image = ref
+				continue
+			}
+			if _, err := image.ParseReference(c.Image); err != nil {
+				return err
+			}
+			ref, err := image.Pin(ctx, resolver, keychain, c.Image)
+			if err != nil {
+				unpinned[c.Image] = err
+				ref = c.Image
+			}
+			pinned[c.Image] = ref
+			c.Image = ref
+		}
+		return nil
+	}
+	if err := pin(spec.Spec.InitContainers); err != nil {
+		return nil, err
+	}
+	return unpinned, pin(spec.Spec.Containers)
+}
+
+// PullKeychain returns the credentials in the image pull secrets of the
+// pod template. Secrets that are dependencies are read from their source,
+// since they may not be copied into the namespace yet, and the other
+// secrets are read from the namespace. Secrets that don't exist are
+// skipped, like the kubelet does.
+func PullKeychain(ctx context.Context, c client.Reader, namespace string, spec *v1beta1.PodTemplateSpec, deps []dependency.Dependency) (image.Keychain, error) {
+	keychain := make(image.Keychain)
+	for _, ref := range spec.Spec.ImagePullSecrets {
+		key := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+		for _, dep := range deps {
+			if dep.Kind == "Secret" && dep.Name == ref.Name {
+				key = dep.Source()
+				break
+			}
+		}
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, key, secret); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, ok := secret.Data[corev1.DockerConfigJsonKey]
+		if !ok {
+			data, ok = secret.Data[corev1.DockerConfigKey]
+		}
+		if !ok {
+			continue
+		}
+		creds, err := image.ParseDockerConfig(data)
+		if err != nil {
+			return nil, err
+		}
+		keychain.Merge(creds)
+	}
+	return keychain, nil
+}
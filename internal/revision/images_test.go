@@ -0,0 +1,105 @@
+package revision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply/applytest"
+	"github.com/johnhoman/notebook-controller/internal/image"
+)
+
+type fakeResolver map[string]string
+
+func (f fakeResolver) Resolve(_ context.Context, ref image.Reference, _ image.Auth) (string, error) {
+	return f[ref.Repository+":"+ref.Tag], nil
+}
+
+// privateResolver resolves images for the credentials, and fails for
+// every other image.
+type privateResolver struct {
+	auth   image.Auth
+	digest string
+}
+
+func (p privateResolver) Resolve(_ context.Context, ref image.Reference, auth image.Auth) (string, error) {
+	if ref.Registry != "registry.example.com" || auth != p.auth {
+		return "", errors.New("unexpected status 401 Unauthorized")
+	}
+	return p.digest, nil
+}
+
+func TestPublisher_Create_ImagePolicy(t *testing.T) {
+	spec := v1beta1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init", Image: "jupyter/scipy:v1.7.0"}},
+			Containers:     []corev1.Container{{Name: "main", Image: "jupyter/scipy:v1.7.0"}},
+		},
+	}
+	digest := newTemplate("digest", "", v1beta1.TemplateSpec{ImagePolicy: v1beta1.ImagePolicyDigest, Template: spec})
+	tag := newTemplate("tag", "", v1beta1.TemplateSpec{Template: spec})
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(digest, tag).Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s, WithImageResolver(fakeResolver{"jupyter/scipy:v1.7.0": "sha256:abc"}))
+
+	rev, err := pub.Create(ctx, newNotebook("nb-digest", "test", v1beta1.TemplateReference{Name: "digest"}))
+	qt.Assert(t, err, qt.IsNil)
+	pod := unmarshalRevision(t, rev).Spec
+	qt.Assert(t, pod.InitContainers[0].Image, qt.Equals, "jupyter/scipy:v1.7.0@sha256:abc")
+	qt.Assert(t, pod.Containers[0].Image, qt.Equals, "jupyter/scipy:v1.7.0@sha256:abc")
+
+	rev, err = pub.Create(ctx, newNotebook("nb-tag", "test", v1beta1.TemplateReference{Name: "tag"}))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, unmarshalRevision(t, rev).Spec.Containers[0].Image, qt.Equals, "jupyter/scipy:v1.7.0")
+}
+
+func TestPublisher_Create_ImagePolicyPullSecrets(t *testing.T) {
+	spec := v1beta1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+			Containers: []corev1.Container{
+				{Name: "main", Image: "registry.example.com/jupyter/scipy:v1.7.0"},
+				{Name: "sidecar", Image: "quay.io/oauth2-proxy/oauth2-proxy:v7"},
+			},
+		},
+	}
+	template := newTemplate("digest", "", v1beta1.TemplateSpec{ImagePolicy: v1beta1.ImagePolicyDigest, Template: spec})
+	template.Spec.Dependencies = []v1beta1.LocalObjectReference{{Name: "registry", APIVersion: "v1", Kind: "Secret"}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: template.Namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(`{"auths": {"registry.example.com": {"username": "jack", "password": "hunter2"}}}`),
+		},
+	}
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template, secret).
+		WithInterceptorFuncs(applytest.Funcs()).
+		Build()
+
+	// the pull secret is read from the template's namespace, since it
+	// isn't copied yet, and images that can't be pinned keep their tag
+	ctx := context.Background()
+	resolver := privateResolver{auth: image.Auth{Username: "jack", Password: "hunter2"}, digest: "sha256:abc"}
+	pub := NewPublisher(k8s, WithImageResolver(resolver))
+	rev, err := pub.Create(ctx, newNotebook("nb", "team-ml", v1beta1.TemplateReference{Name: "digest", Namespace: template.Namespace}))
+	qt.Assert(t, err, qt.IsNil)
+	pod := unmarshalRevision(t, rev).Spec
+	qt.Assert(t, pod.Containers[0].Image, qt.Equals, "registry.example.com/jupyter/scipy:v1.7.0@sha256:abc")
+	qt.Assert(t, pod.Containers[1].Image, qt.Equals, "quay.io/oauth2-proxy/oauth2-proxy:v7")
+	qt.Assert(t, rev.GetAnnotations()[AnnotationKeyUnpinnedImages], qt.Equals, "quay.io/oauth2-proxy/oauth2-proxy:v7")
+}
@@ -0,0 +1,71 @@
+package revision
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestPublisher_Create_OptionConstraints(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		OptionGroups: []v1beta1.OptionGroup{
+			{Name: "index", Policy: v1beta1.OptionGroupPolicyRequiredOneOf},
+			{Name: "accelerator", Policy: v1beta1.OptionGroupPolicyExclusive},
+		},
+		Options: []v1beta1.TemplateOption{
+			{Name: "pypi", Group: "index"},
+			{Name: "pypi-private", Group: "index"},
+			{Name: "gpu", Group: "accelerator"},
+			{Name: "tpu", Group: "accelerator"},
+			{Name: "spark", Requires: []string{"pypi-private"}},
+			{Name: "debug", Conflicts: []string{"gpu"}},
+		},
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	objs := []client.Object{template}
+	for _, name := range []string{"pypi", "pypi-private", "gpu", "tpu", "spark", "debug"} {
+		objs = append(objs, &v1beta1.PodDefault{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"}})
+	}
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	ref := v1beta1.TemplateReference{Name: "jupyter"}
+
+	tests := map[string]struct {
+		options []string
+		err     string
+	}{
+		"Valid":         {options: []string{"pypi-private", "gpu", "spark"}},
+		"Unknown":       {options: []string{"pypi", "conda"}, err: v1beta1.ErrUnknownOption + ": conda"},
+		"RequiredOneOf": {options: []string{"gpu"}, err: v1beta1.ErrOptionGroupRequired + " index"},
+		"Exclusive":     {options: []string{"pypi", "gpu", "tpu"}, err: v1beta1.ErrOptionGroupExcluded + ` accelerator: \["gpu" "tpu"\]`},
+		"Requires":      {options: []string{"pypi", "spark"}, err: v1beta1.ErrOptionRequired + ": spark requires pypi-private"},
+		"Conflicts":     {options: []string{"pypi", "gpu", "debug"}, err: v1beta1.ErrOptionConflict + ": debug conflicts with gpu"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := pub.Create(ctx, newNotebook("nb-"+name, "test", ref, tt.options...))
+			if tt.err == "" {
+				qt.Assert(t, err, qt.IsNil)
+				return
+			}
+			qt.Assert(t, err, qt.ErrorMatches, tt.err)
+			invalid, ok := IsInvalid(err)
+			qt.Assert(t, ok, qt.IsTrue)
+			qt.Assert(t, invalid.Reason, qt.Equals, v1beta1.ReasonInvalidOptions)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package revision
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+// SubstituteParameters replaces $(params.<name>) in every string field
+// of the pod template with the value of the named parameter. References to
+// parameters that aren't in values are left as they are.
+func SubstituteParameters(spec *v1beta1.PodTemplateSpec, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	pairs := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		pairs = append(pairs, "$(params."+name+")", value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(spec)
+	if err != nil {
+		return err
+	}
+	obj = substitute(obj, replacer).(map[string]any)
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj, spec)
+}
+
+func substitute(v any, replacer *strings.Replacer) any {
+	switch value := v.(type) {
+	case string:
+		return replacer.Replace(value)
+	case map[string]any:
+		for k, item := range value {
+			value[k] = substitute(item, replacer)
+		}
+	case []any:
+		for k, item := range value {
+			value[k] = substitute(item, replacer)
+		}
+	}
+	return v
+}
@@ -0,0 +1,68 @@
+package revision
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestPublisher_Create_Parameters(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Parameters: []v1beta1.TemplateParameter{
+			{Name: "python", Enum: []string{"3.10", "3.11"}, Default: pointer.String("3.11")},
+			{Name: "workers", Type: v1beta1.ParameterTypeInteger, Minimum: pointer.Int64(1), Maximum: pointer.Int64(8)},
+		},
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "main",
+				Image: "jupyter:py$(params.python)",
+				Args:  []string{"--workers=$(params.workers)"},
+			}}},
+		},
+	})
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(template).Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	ref := v1beta1.TemplateReference{Name: "jupyter"}
+
+	t.Run("Substituted", func(t *testing.T) {
+		nb := newNotebook("nb", "test", ref)
+		nb.Spec.Parameters = map[string]string{"workers": "4"}
+		rev, err := pub.Create(ctx, nb)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, unmarshalRevision(t, rev).Spec.Containers, qt.DeepEquals, []corev1.Container{{
+			Name:  "main",
+			Image: "jupyter:py3.11",
+			Args:  []string{"--workers=4"},
+		}})
+	})
+
+	tests := map[string]struct {
+		params map[string]string
+		err    string
+	}{
+		"Missing":    {params: map[string]string{}, err: v1beta1.ErrMissingParameter + ": workers"},
+		"Unknown":    {params: map[string]string{"workers": "1", "gpu": "true"}, err: v1beta1.ErrUnknownParameter + ": gpu"},
+		"NotInteger": {params: map[string]string{"workers": "many"}, err: v1beta1.ErrInvalidParameter + ".*not an integer"},
+		"TooLarge":   {params: map[string]string{"workers": "9"}, err: v1beta1.ErrInvalidParameter + ".*maximum 8"},
+		"NotInEnum":  {params: map[string]string{"workers": "1", "python": "2.7"}, err: v1beta1.ErrInvalidParameter + ".*not one of.*"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			nb := newNotebook("nb-"+name, "test", ref)
+			nb.Spec.Parameters = tt.params
+			_, err := pub.Create(ctx, nb)
+			qt.Assert(t, err, qt.ErrorMatches, tt.err)
+		})
+	}
+}
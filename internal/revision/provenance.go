@@ -0,0 +1,79 @@
+package revision
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+// provenance returns the Provenance of a revision rendered from the
+// template, which extends the ancestors, for the Referrer. PodDefaults
+// are added as they're merged.
+func (r *Publisher) provenance(template *v1beta1.Template, ancestors []*v1beta1.Template, impl Referrer) *v1beta1.Provenance {
+	p := &v1beta1.Provenance{
+		Template: v1beta1.TemplateProvenance{
+			Kind:             impl.TemplateKind(),
+			Name:             template.GetName(),
+			Namespace:        template.GetNamespace(),
+			UID:              template.GetUID(),
+			ResourceVersion:  template.GetResourceVersion(),
+			TemplateRevision: impl.TemplateRevision(),
+		},
+		PodDefaults:       make([]v1beta1.PodDefaultProvenance, 0),
+		ControllerVersion: r.version,
+		Referrer: v1beta1.ReferrerProvenance{
+			Name:       impl.GetName(),
+			Namespace:  impl.GetNamespace(),
+			Generation: impl.GetGeneration(),
+		},
+	}
+	if task, ok := impl.(TaskReferrer); ok {
+		p.Referrer.Dag = task.DagName()
+	}
+	for _, ancestor := range ancestors {
+		p.Ancestors = append(p.Ancestors, v1beta1.TemplateProvenance{
+			Kind:            impl.TemplateKind(),
+			Name:            ancestor.GetName(),
+			Namespace:       ancestor.GetNamespace(),
+			UID:             ancestor.GetUID(),
+			ResourceVersion: ancestor.GetResourceVersion(),
+		})
+	}
+	for _, patch := range r.patches {
+		p.PatchHashes = append(p.PatchHashes, patchHash(patch))
+	}
+	if obj, ok := impl.(client.Object); ok && r.scheme != nil {
+		if gvk, err := apiutil.GVKForObject(obj, r.scheme); err == nil {
+			p.Referrer.Kind = gvk.Kind
+		}
+	}
+	return p
+}
+
+// patchHash returns the sha256 hash of the patch recorded in the
+// provenance of revisions it's applied to.
+func patchHash(patch v1beta1.PodTemplateSpec) string {
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// setPodDefaultProvenance records the version of the merged PodDefault.
+func setPodDefaultProvenance(p *v1beta1.PodDefaultProvenance, pd *v1beta1.PodDefault) {
+	p.Kind = v1beta1.KindPodDefault
+	if pd.GetNamespace() == "" {
+		p.Kind = v1beta1.KindClusterPodDefault
+	}
+	p.Name = pd.GetName()
+	p.Namespace = pd.GetNamespace()
+	p.UID = pd.GetUID()
+	p.ResourceVersion = pd.GetResourceVersion()
+}
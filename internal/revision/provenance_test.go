@@ -0,0 +1,155 @@
+package revision
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestPublisher_Create_Provenance(t *testing.T) {
+	base := newTemplate("base", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter-base:v1"}}},
+		},
+	})
+	base.SetUID("base-uid")
+	template := newTemplate("jupyter", "base", v1beta1.TemplateSpec{
+		Required: []v1beta1.PodDefaultReference{{Name: "proxy"}},
+		Options:  []v1beta1.TemplateOption{{Name: "spark"}},
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	template.SetUID("template-uid")
+	proxy := newEnvPodDefault("proxy", "test", 0, nil, "proxy")
+	proxy.SetUID("proxy-uid")
+	spark := newEnvPodDefault("spark", "test", 0, nil, "spark")
+	s3 := newEnvPodDefault("s3", "test", 0, map[string]string{"team": "ml"}, "s3")
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(base, template, proxy, spark, s3).
+		Build()
+
+	ctx := context.Background()
+	patch := v1beta1.PodTemplateSpec{Spec: corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever}}
+	pub := NewPublisher(k8s, WithVersion("v1.2.3"), WithPatches(patch))
+
+	nb := newNotebook("nb", "test", v1beta1.TemplateReference{Name: "jupyter"}, "spark")
+	nb.SetLabels(map[string]string{"team": "ml"})
+	nb.SetGeneration(3)
+	rev, err := pub.Create(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+
+	live := &v1beta1.Template{}
+	qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(template), live), qt.IsNil)
+	version := func(obj client.Object) string {
+		t.Helper()
+		qt.Assert(t, k8s.Get(ctx, client.ObjectKeyFromObject(obj), obj), qt.IsNil)
+		return obj.GetResourceVersion()
+	}
+
+	p, err := rev.Provenance()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, p, qt.DeepEquals, &v1beta1.Provenance{
+		Template: v1beta1.TemplateProvenance{
+			Kind:            v1beta1.KindTemplate,
+			Name:            "jupyter",
+			Namespace:       "test",
+			UID:             "template-uid",
+			ResourceVersion: live.GetResourceVersion(),
+		},
+		Ancestors: []v1beta1.TemplateProvenance{{
+			Kind:            v1beta1.KindTemplate,
+			Name:            "base",
+			Namespace:       "test",
+			UID:             "base-uid",
+			ResourceVersion: version(base),
+		}},
+		PodDefaults: []v1beta1.PodDefaultProvenance{
+			{
+				Kind:            v1beta1.KindPodDefault,
+				Name:            "s3",
+				Namespace:       "test",
+				ResourceVersion: version(s3),
+				Source:          v1beta1.PodDefaultSourceSelected,
+			},
+			{
+				Kind:            v1beta1.KindPodDefault,
+				Name:            "proxy",
+				Namespace:       "test",
+				UID:             "proxy-uid",
+				ResourceVersion: version(proxy),
+				Source:          v1beta1.PodDefaultSourceRequired,
+			},
+			{
+				Kind:            v1beta1.KindPodDefault,
+				Name:            "spark",
+				Namespace:       "test",
+				ResourceVersion: version(spark),
+				Source:          v1beta1.PodDefaultSourceElected,
+				Option:          "spark",
+			},
+		},
+		PatchHashes:       []string{patchHash(patch)},
+		ControllerVersion: "v1.2.3",
+		Referrer: v1beta1.ReferrerProvenance{
+			Kind:       "Notebook",
+			Name:       "nb",
+			Namespace:  "test",
+			Generation: 3,
+		},
+	})
+
+	// the provenance isn't part of the revision's identity, so the
+	// revision isn't published again when only the versions change
+	live.SetLabels(map[string]string{"updated": "true"})
+	qt.Assert(t, k8s.Update(ctx, live), qt.IsNil)
+	again, err := pub.Create(ctx, nb)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, again.GetName(), qt.Equals, rev.GetName())
+}
+
+func TestResolveTemplateVersion_Provenance(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	template.SetUID("template-uid")
+	spec := v1beta1.TemplateRevisionSpec{ResourceVersion: "42"}
+	qt.Assert(t, spec.SetTemplateSpec(template.Spec), qt.IsNil)
+	rev := &v1beta1.TemplateRevision{Spec: spec}
+	rev.SetName("jupyter-1")
+	rev.SetNamespace("test")
+	rev.SetLabels(map[string]string{v1beta1.LabelKeyTemplateName: "jupyter"})
+	rev.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: v1beta1.GroupVersion.String(),
+		Kind:       v1beta1.KindTemplate,
+		Name:       "jupyter",
+		UID:        "template-uid",
+		Controller: pointer.Bool(true),
+	}})
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(template, rev).Build()
+
+	// a template resolved from a TemplateRevision has the version the
+	// revision was taken at
+	key := types.NamespacedName{Name: "jupyter", Namespace: "test"}
+	resolved, err := ResolveTemplateVersion(context.Background(), k8s, v1beta1.KindTemplate, key, "jupyter-1", "")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, resolved.GetUID(), qt.Equals, types.UID("template-uid"))
+	qt.Assert(t, resolved.GetResourceVersion(), qt.Equals, "42")
+}
@@ -0,0 +1,93 @@
+package revision
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestPublisher_Create_Resources(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Resources: &v1beta1.TemplateResources{
+			Min: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			Max: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("16Gi"),
+			},
+			Defaults: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("1Gi"),
+			},
+			Presets: []v1beta1.ResourcePreset{{
+				Name:     v1beta1.PresetLarge,
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2"), corev1.ResourceMemory: resource.MustParse("8Gi")},
+			}},
+		},
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "sidecar", Image: "proxy:v1"},
+				{Name: "main", Image: "jupyter:v1"},
+			}},
+		},
+	})
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(template).Build()
+
+	ctx := context.Background()
+	ref := v1beta1.TemplateReference{Name: "jupyter"}
+
+	t.Run("Defaults", func(t *testing.T) {
+		rev, err := NewPublisher(k8s).Create(ctx, newNotebook("nb-defaults", "test", ref))
+		qt.Assert(t, err, qt.IsNil)
+		containers := unmarshalRevision(t, rev).Spec.Containers
+		qt.Assert(t, containers[0].Resources, qt.DeepEquals, corev1.ResourceRequirements{})
+		qt.Assert(t, containers[1].Resources.Requests.Cpu().String(), qt.Equals, "500m")
+		qt.Assert(t, containers[1].Resources.Limits, qt.IsNil)
+	})
+	t.Run("PresetAndRequests", func(t *testing.T) {
+		nb := newNotebook("nb-preset", "test", ref)
+		nb.Spec.Preset = v1beta1.PresetLarge
+		nb.Spec.ResourceRequests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("3")}
+		rev, err := NewPublisher(k8s, WithLimitRatio(2)).Create(ctx, nb)
+		qt.Assert(t, err, qt.IsNil)
+		res := unmarshalRevision(t, rev).Spec.Containers[1].Resources
+		qt.Assert(t, res.Requests.Cpu().String(), qt.Equals, "3")
+		qt.Assert(t, res.Requests.Memory().String(), qt.Equals, "8Gi")
+		qt.Assert(t, res.Limits.Cpu().String(), qt.Equals, "6")
+		qt.Assert(t, res.Limits.Memory().String(), qt.Equals, "16Gi")
+	})
+	t.Run("Guaranteed", func(t *testing.T) {
+		rev, err := NewPublisher(k8s, WithLimitRatio(1)).Create(ctx, newNotebook("nb-guaranteed", "test", ref))
+		qt.Assert(t, err, qt.IsNil)
+		res := unmarshalRevision(t, rev).Spec.Containers[1].Resources
+		qt.Assert(t, res.Limits.Cpu().String(), qt.Equals, "500m")
+		qt.Assert(t, res.Limits.Memory().String(), qt.Equals, "1Gi")
+	})
+
+	tests := map[string]struct {
+		preset   string
+		requests corev1.ResourceList
+		err      string
+	}{
+		"AboveMaximum":  {requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("32Gi")}, err: v1beta1.ErrResourceAboveMaximum + ": memory: 32Gi is greater than 16Gi"},
+		"BelowMinimum":  {requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")}, err: v1beta1.ErrResourceBelowMinimum + ": cpu: 10m is less than 100m"},
+		"UnknownPreset": {preset: v1beta1.PresetSmall, err: v1beta1.ErrUnknownPreset + ": small"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			nb := newNotebook("nb-"+name, "test", ref)
+			nb.Spec.Preset = tt.preset
+			nb.Spec.ResourceRequests = tt.requests
+			_, err := NewPublisher(k8s).Create(ctx, nb)
+			qt.Assert(t, err, qt.ErrorMatches, tt.err)
+		})
+	}
+}
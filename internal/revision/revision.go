@@ -5,28 +5,67 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/apply"
+	"github.com/johnhoman/notebook-controller/internal/dependency"
+	"github.com/johnhoman/notebook-controller/internal/image"
+	"github.com/johnhoman/notebook-controller/internal/version"
 )
 
 const (
 	ErrReferencedOptionNotFound = "the referenced option was not found in the template spec"
+	ErrRevisionNotFound         = "revision not found"
+	ErrHashCollision            = "too many revisions with colliding hashes"
+	ErrPatchedContainerNotFound = "patched container not found in the template or its pod defaults"
+)
+
+const (
+	// DefaultLimitRatio doesn't set limits. Setting the ratio to 1
+	// sets limits equal to requests, so workloads get the Guaranteed
+	// QoS class.
+	DefaultLimitRatio = 0.0
+
+	// MaxHashCollisions is the number of revisions with colliding
+	// names that are tried before publishing fails.
+	MaxHashCollisions = 10
 )
 
 var (
 	LabelKeyTemplate = fmt.Sprintf("%s/template", v1beta1.GroupName)
 	LabelKeyName     = fmt.Sprintf("%s/name", v1beta1.GroupName)
+	// LabelKeyRevision is set on the pods started from a Revision to the
+	// name of the Revision.
+	LabelKeyRevision = fmt.Sprintf("%s/revision", v1beta1.GroupName)
+	// LabelKeyDag is set on the revisions of Dag tasks to the name of the
+	// Dag, since task names are only unique within a Dag.
+	LabelKeyDag = fmt.Sprintf("%s/dag", v1beta1.GroupName)
+
+	// AnnotationKeyPodDefaults lists the PodDefaults merged into a
+	// Revision, in the order they were merged.
+	AnnotationKeyPodDefaults = fmt.Sprintf("%s/pod-defaults", v1beta1.GroupName)
+
+	// AnnotationKeyUnpinnedImages lists the images of a Revision that
+	// couldn't be pinned to a digest, and were published with their tag.
+	AnnotationKeyUnpinnedImages = fmt.Sprintf("%s/unpinned-images", v1beta1.GroupName)
+
+	// defaultResolver is shared by Publishers without a Resolver, so
+	// digests are cached across reconciles.
+	defaultResolver = image.NewCachingResolver(image.NewRegistryResolver(nil), image.DefaultCacheTTL)
 )
 
 // A Referrer is a resource that references a template
@@ -35,14 +74,32 @@ type Referrer interface {
 	GetName() string
 	// GetNamespace returns the namespace of the resource
 	GetNamespace() string
+	// GetLabels returns the labels of the resource. PodDefaults with a
+	// matching selector are merged into its revisions.
+	GetLabels() map[string]string
 	// TemplateRef returns the name and namespace of the template
 	TemplateRef() types.NamespacedName
+	// TemplateKind returns the kind of the template, either Template
+	// or ClusterTemplate
+	TemplateKind() string
+	// TemplateRevision returns the name of the TemplateRevision the
+	// resource is pinned to, or an empty string to use the latest template.
+	TemplateRevision() string
+	// TemplateResourceVersion returns the resourceVersion of the template
+	// the resource is pinned to, or an empty string.
+	TemplateResourceVersion() string
 	// HistoryLimit returns the number of revisions to keep around
 	// for this resource
 	HistoryLimit() int
+	// ParameterValues returns the values for the template's parameters.
+	// Parameters that are omitted use the template's defaults.
+	ParameterValues() map[string]string
 	// ResourceRequests returns the resource requests for this
 	// resource
 	ResourceRequests() corev1.ResourceList
+	// ResourcePreset returns the name of the template's resource preset
+	// to use, or an empty string to use the template's defaults.
+	ResourcePreset() string
 	// ElectedOptions returns the elected options for this resource
 	// if any. Elected options must exist in the template. If additional
 	// patches are required, they should be applied by webhook.
@@ -50,6 +107,16 @@ type Referrer interface {
 	// UpdatePolicy returns the update policy for this resource. The UpdatePolicy
 	// can either be "Auto", or "Ignore".
 	UpdatePolicy() string
+	// GetGeneration returns the generation of the resource's spec. It's
+	// recorded in the provenance of the resource's revisions.
+	GetGeneration() int64
+}
+
+// A TaskReferrer is a Referrer that's a task of a Dag.
+type TaskReferrer interface {
+	Referrer
+	// DagName returns the name of the Dag the task is in.
+	DagName() string
 }
 
 type Option func(p *Publisher)
@@ -60,6 +127,39 @@ func WithLogger(logger logr.Logger) Option {
 	}
 }
 
+// WithNamespace sets the system namespace. PodDefaults and dependencies
+// of cluster scoped templates are read from the system namespace.
+func WithNamespace(namespace string) Option {
+	return func(p *Publisher) {
+		p.namespace = namespace
+	}
+}
+
+// WithLimitRatio sets the ratio of resource limits to requests for cpu
+// and memory. If the ratio is zero, limits aren't set.
+func WithLimitRatio(ratio float64) Option {
+	return func(p *Publisher) {
+		p.limitRatio = ratio
+	}
+}
+
+// WithImageResolver sets the Resolver used to pin images to digests for
+// templates with the Digest image policy.
+func WithImageResolver(resolver image.Resolver) Option {
+	return func(p *Publisher) {
+		p.images = resolver
+	}
+}
+
+// WithVersion sets the controller version recorded in the provenance of
+// published revisions. It defaults to the version the controller was
+// built with.
+func WithVersion(version string) Option {
+	return func(p *Publisher) {
+		p.version = version
+	}
+}
+
 func WithPatches(patches ...v1beta1.PodTemplateSpec) Option {
 	return func(p *Publisher) {
 		p.patches = append(p.patches, patches...)
@@ -68,9 +168,12 @@ func WithPatches(patches ...v1beta1.PodTemplateSpec) Option {
 
 func NewPublisher(client client.Client, opts ...Option) *Publisher {
 	p := &Publisher{
-		client: client,
-		logger: logr.New(nil),
-		scheme: client.Scheme(),
+		client:     client,
+		logger:     logr.New(nil),
+		scheme:     client.Scheme(),
+		limitRatio: DefaultLimitRatio,
+		images:     defaultResolver,
+		version:    version.Get(),
 	}
 	for _, f := range opts {
 		f(p)
@@ -87,6 +190,18 @@ type Publisher struct {
 	logger logr.Logger
 
 	patches []v1beta1.PodTemplateSpec
+
+	// limitRatio is the ratio of limits to requests
+	limitRatio float64
+
+	// images resolves image tags to digests
+	images image.Resolver
+
+	// namespace is the system namespace
+	namespace string
+
+	// version is the controller version
+	version string
 }
 
 func (r *Publisher) SetScheme(scheme *runtime.Scheme) {
@@ -98,9 +213,13 @@ func (r *Publisher) SetLogger(logger logr.Logger) {
 }
 
 func (r *Publisher) revisionLabelSet(impl Referrer) map[string]string {
-	return map[string]string{
+	set := map[string]string{
 		LabelKeyName: impl.GetName(),
 	}
+	if task, ok := impl.(TaskReferrer); ok {
+		set[LabelKeyDag] = task.DagName()
+	}
+	return set
 }
 
 // TrimRevisions cleans up old revisions for a given Referrer. A Revision is
@@ -119,6 +238,9 @@ func (r *Publisher) TrimRevisions(ctx context.Context, impl Referrer) error {
 		if revList.Revision(k).Elected() {
 			continue
 		}
+		if err := dependency.NewPropagator(r.client).Release(ctx, revList.Revision(k)); err != nil {
+			return err
+		}
 		if err := r.client.Delete(ctx, revList.Revision(k)); err != nil {
 			return err
 		}
@@ -127,12 +249,30 @@ func (r *Publisher) TrimRevisions(ctx context.Context, impl Referrer) error {
 	return nil
 }
 
+// Selector selects the revisions of the named Referrer. If dag is empty,
+// the Referrer isn't a task, and the revisions of tasks with the same name
+// aren't selected.
+func Selector(name, dag string) labels.Selector {
+	if dag != "" {
+		return labels.SelectorFromSet(labels.Set{LabelKeyName: name, LabelKeyDag: dag})
+	}
+	selector := labels.SelectorFromSet(labels.Set{LabelKeyName: name})
+	if req, err := labels.NewRequirement(LabelKeyDag, selection.DoesNotExist, nil); err == nil {
+		selector = selector.Add(*req)
+	}
+	return selector
+}
+
 // List the revisions for a given referrer.
 func (r *Publisher) List(ctx context.Context, impl Referrer) (*v1beta1.RevisionList, error) {
 
+	dag := ""
+	if task, ok := impl.(TaskReferrer); ok {
+		dag = task.DagName()
+	}
 	opts := []client.ListOption{
 		client.InNamespace(impl.GetNamespace()),
-		client.MatchingLabels(r.revisionLabelSet(impl)),
+		client.MatchingLabelsSelector{Selector: Selector(impl.GetName(), dag)},
 	}
 
 	revList := &v1beta1.RevisionList{}
@@ -197,153 +337,481 @@ func (r *Publisher) ElectRevision(ctx context.Context, impl Referrer) (*v1beta1.
 			}
 		}
 
-		if elected != nil {
-			patch := client.MergeFrom(elected.DeepCopyObject().(client.Object))
-			elected.Recall()
-			if err := r.client.Patch(ctx, elected, patch); err != nil {
-				return nil, err
-			}
+		return latest, r.Elect(ctx, impl, latest)
+	}
+	return elected, nil
+}
+
+// Get returns the named revision of the Referrer. An error is returned if
+// the revision doesn't exist, or belongs to another resource.
+func (r *Publisher) Get(ctx context.Context, impl Referrer, name string) (*v1beta1.Revision, error) {
+	rev := &v1beta1.Revision{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: impl.GetNamespace()}, rev); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errors.Errorf("%s: %s", ErrRevisionNotFound, name)
+		}
+		return nil, err
+	}
+	for k, v := range r.revisionLabelSet(impl) {
+		if rev.GetLabels()[k] != v {
+			return nil, errors.Errorf("%s: %s isn't a revision of %s", ErrRevisionNotFound, name, impl.GetName())
+		}
+	}
+	return rev, nil
+}
+
+// Elect elects the revision, and recalls the revision that was elected
+// before it, regardless of the update policy.
+func (r *Publisher) Elect(ctx context.Context, impl Referrer, rev *v1beta1.Revision) error {
+	elected, err := r.Elected(ctx, impl)
+	if err != nil {
+		return err
+	}
+	if elected != nil && elected.GetName() != rev.GetName() {
+		if err := r.setElected(ctx, elected, false); err != nil {
+			return err
 		}
+	}
+	return r.setElected(ctx, rev, true)
+}
 
-		patch := client.MergeFrom(latest.DeepCopyObject().(client.Object))
-		latest.Elect()
-		return latest, r.client.Patch(ctx, latest, patch)
+// setElected applies whether the revision is elected. Only spec.elected is
+// applied, so the rest of the revision is left to whoever owns it.
+func (r *Publisher) setElected(ctx context.Context, rev *v1beta1.Revision, elected bool) error {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{"elected": elected},
+	}}
+	obj.SetGroupVersionKind(v1beta1.GroupVersion.WithKind("Revision"))
+	obj.SetName(rev.GetName())
+	obj.SetNamespace(rev.GetNamespace())
+	if err := apply.Apply(ctx, r.client, obj); err != nil {
+		return err
 	}
-	return elected, nil
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, rev)
 }
 
-// Create a new publisher for the given Referrer. The publisher is
-// only created if the template has changed since the last publisher.
+// Create publishes a revision for the Referrer from its template, and
+// copies the revision's dependencies into the Referrer's namespace. If
+// the revision already exists, the existing revision is returned. A
+// summary of the changes from the latest revision is recorded on new
+// revisions.
 func (r *Publisher) Create(ctx context.Context, impl Referrer) (*v1beta1.Revision, error) {
-
-	template := &v1beta1.Template{}
-	if err := r.client.Get(ctx, impl.TemplateRef(), template); err != nil {
+	rev, deps, err := r.Render(ctx, impl)
+	if err != nil {
 		return nil, err
 	}
 
 	logger := r.logger.WithValues("Namespace", impl.GetNamespace())
 
-	spec := template.PodTemplateSpec()
+	latest, err := r.Latest(ctx, impl)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && latest.GetName() != rev.GetName() {
+		diff, err := DiffRevisions(latest, rev)
+		if err != nil {
+			logger.Info("unable to diff revisions", "error", err)
+		} else {
+			annotations := rev.GetAnnotations()
+			annotations[AnnotationKeyChangeSummary] = diff.Summary()
+			rev.SetAnnotations(annotations)
+		}
+	}
 
-	// opts are local to the template namespace, not the impl namespace.
-	opts := sets.New[corev1.LocalObjectReference]()
-	for _, opt := range template.Options() {
-		opts.Insert(corev1.LocalObjectReference{Name: opt.Name})
+	rev, err = r.publish(ctx, rev)
+	if err != nil {
+		logger.Error(err, "failed to create revision")
+		return nil, err
 	}
-	// deps are local to the template namespace, not the impl namespace.
-	deps := make([]v1beta1.LocalObjectReference, 0)
 
-	for i, opt := range template.Required() {
+	// if the revision is created successfully, copy all the dependencies
+	// and add the revision as an owner of the copies
+	if err := dependency.NewPropagator(r.client).Propagate(ctx, rev, deps); err != nil {
+		logger.Error(err, "failed to copy dependencies")
+		return nil, err
+	}
+	return rev, r.TrimRevisions(ctx, impl)
+}
 
-		pd := &v1beta1.PodDefault{}
-		pd.SetName(opt.Name)
-		pd.SetNamespace(template.GetNamespace())
+// Validate returns an error if the Referrer's options or resource requests
+// can't be used with the template it resolves to. Revisions aren't
+// published for Referrers that aren't valid, so webhooks use it to reject
+// them before they're created.
+func Validate(template *v1beta1.Template, impl Referrer) error {
+	elected := make([]string, 0, len(impl.ElectedOptions()))
+	for _, opt := range impl.ElectedOptions() {
+		elected = append(elected, opt.Name)
+	}
+	if err := template.ValidateOptions(elected); err != nil {
+		return invalid(v1beta1.ReasonInvalidOptions, err)
+	}
+	_, err := template.ResolveResources(impl.ResourcePreset(), impl.ResourceRequests())
+	return err
+}
 
-		if err := r.client.Get(ctx, client.ObjectKeyFromObject(pd), pd); err != nil {
-			logger.Error(err, fmt.Sprintf("failed to get template option %q (pos %d)", opt.Name, i))
-			return nil, err
-		}
+// Render returns the revision that would be published for the Referrer
+// from its template, and the dependencies it needs, without creating it.
+func (r *Publisher) Render(ctx context.Context, impl Referrer) (*v1beta1.Revision, []dependency.Dependency, error) {
+	template, ancestors, err := resolveTemplateVersion(ctx, r.client, impl.TemplateKind(), impl.TemplateRef(), impl.TemplateRevision(), impl.TemplateResourceVersion())
+	if err != nil {
+		return nil, nil, err
+	}
 
-		if err := spec.StrategicMergeFrom(pd.PodTemplateSpec()); err != nil {
-			logger.Error(err, "failed to merge template option", "option", opt.Name, "pos", i)
-			return nil, err
-		}
+	logger := r.logger.WithValues("Namespace", impl.GetNamespace())
 
-		for _, item := range pd.Dependencies() {
-			deps = append(deps, item)
+	params, err := template.ResolveParameters(impl.ParameterValues())
+	if err != nil {
+		logger.Info("invalid template parameters", "error", err)
+		return nil, nil, err
+	}
+
+	if err := Validate(template, impl); err != nil {
+		logger.Info("invalid template options or resource requests", "error", err)
+		return nil, nil, err
+	}
+	requests, err := template.ResolveResources(impl.ResourcePreset(), impl.ResourceRequests())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if impl.TemplateKind() == v1beta1.KindClusterTemplate {
+		if err := CheckAllowedNamespace(ctx, r.client, template.GetName(), impl.GetNamespace()); err != nil {
+			logger.Info("cluster template cannot be referenced", "error", err)
+			return nil, nil, err
 		}
 	}
 
-	for i, opt := range impl.ElectedOptions() {
-		if !opts.Has(opt) {
-			return nil, errors.Errorf("%s: %s", ErrReferencedOptionNotFound, opt.Name)
+	// home is the namespace PodDefaults and dependencies are read from. It's
+	// the namespace of the template, or the system namespace for cluster
+	// scoped templates.
+	home := template.GetNamespace()
+	if home == "" {
+		home = r.namespace
+	}
+
+	spec := template.PodTemplateSpec()
+
+	// opts are local to the template namespace, not the impl namespace.
+	opts := make(map[string]v1beta1.TemplateOption)
+	for _, opt := range template.Options() {
+		opts[opt.Name] = opt
+	}
+	deps := make([]dependency.Dependency, 0)
+
+	refs := append([]v1beta1.PodDefaultReference{}, template.Required()...)
+	sources := make([]v1beta1.PodDefaultProvenance, 0, len(refs)+len(impl.ElectedOptions()))
+	for range refs {
+		sources = append(sources, v1beta1.PodDefaultProvenance{Source: v1beta1.PodDefaultSourceRequired})
+	}
+	for _, opt := range impl.ElectedOptions() {
+		item, ok := opts[opt.Name]
+		if !ok {
+			return nil, nil, errors.Errorf("%s: %s", ErrReferencedOptionNotFound, opt.Name)
 		}
+		refs = append(refs, item.PodDefaultRef())
+		sources = append(sources, v1beta1.PodDefaultProvenance{Source: v1beta1.PodDefaultSourceElected, Option: opt.Name})
+	}
 
-		pd := &v1beta1.PodDefault{}
-		pd.SetName(opt.Name)
-		pd.SetNamespace(template.GetNamespace())
+	pds := make([]*v1beta1.PodDefault, 0, len(refs))
+	for i, ref := range refs {
+		pd, err := GetPodDefault(ctx, r.client, ref, home)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("failed to get template option %q (pos %d)", ref.Name, i))
+			return nil, nil, err
+		}
+		pds = append(pds, pd)
+	}
 
-		if err := r.client.Get(ctx, client.ObjectKeyFromObject(pd), pd); err != nil {
-			logger.Error(err, fmt.Sprintf("failed to get template option %q (pos %d)", opt.Name, i))
-			return nil, err
+	// PodDefaults applied by selector are merged first, so that the
+	// required and elected PodDefaults take precedence over them. A
+	// PodDefault that's also referenced is only merged where it's referenced.
+	selected, err := SelectPodDefaults(ctx, r.client, impl.GetNamespace(), template.GetLabels(), impl.GetLabels())
+	if err != nil {
+		logger.Error(err, "failed to select pod defaults")
+		return nil, nil, err
+	}
+	referenced := make(map[string]bool, len(pds))
+	for _, pd := range pds {
+		referenced[PodDefaultKey(pd)] = true
+	}
+	merge := make([]*v1beta1.PodDefault, 0, len(selected)+len(pds))
+	provenance := r.provenance(template, ancestors, impl)
+	for _, pd := range selected {
+		if !referenced[PodDefaultKey(pd)] {
+			merge = append(merge, pd)
+			provenance.PodDefaults = append(provenance.PodDefaults, v1beta1.PodDefaultProvenance{Source: v1beta1.PodDefaultSourceSelected})
 		}
+	}
+	merge = append(merge, pds...)
+	provenance.PodDefaults = append(provenance.PodDefaults, sources...)
+	for k, pd := range merge {
+		setPodDefaultProvenance(&provenance.PodDefaults[k], pd)
+	}
 
+	applied := make([]string, 0, len(merge))
+	for i, pd := range merge {
 		if err := spec.StrategicMergeFrom(pd.PodTemplateSpec()); err != nil {
-			logger.Error(err, "failed to merge template option", "option", opt.Name, "pos", i)
-			return nil, err
+			logger.Error(err, "failed to merge pod default", "podDefault", pd.GetName(), "pos", i)
+			return nil, nil, err
 		}
+		applied = append(applied, PodDefaultKey(pd))
 
+		// ClusterPodDefault dependencies are read from the system namespace
+		ns := pd.GetNamespace()
+		if ns == "" {
+			ns = r.namespace
+		}
 		for _, item := range pd.Dependencies() {
-			deps = append(deps, item)
+			deps = append(deps, dependency.Dependency{LocalObjectReference: item, Namespace: ns})
 		}
 	}
+	for _, item := range template.Dependencies() {
+		deps = append(deps, dependency.Dependency{LocalObjectReference: item, Namespace: home})
+	}
 
+	// Patches can change the containers of the template and its
+	// PodDefaults, but can't add containers.
 	for _, patch := range r.patches {
+		for _, c := range patch.Spec.Containers {
+			if !hasContainer(spec, c.Name) {
+				return nil, nil, invalid(v1beta1.ReasonContainerNotFound, errors.Errorf("%s: %s", ErrPatchedContainerNotFound, c.Name))
+			}
+		}
 		if err := spec.StrategicMergeFrom(patch); err != nil {
 			logger.Error(err, "failed to merge patch")
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
+	// Requests are applied last so PodDefaults and patches can't
+	// exceed the template's bounds.
+	spec.SetResourceRequests(template.ContainerName(), requests, r.limitRatio)
+
+	if err := SubstituteParameters(spec, params); err != nil {
+		logger.Error(err, "failed to substitute parameters")
+		return nil, nil, err
+	}
+
+	unpinned := make([]string, 0)
+	if template.Spec.ImagePolicy == v1beta1.ImagePolicyDigest {
+		keychain, err := PullKeychain(ctx, r.client, impl.GetNamespace(), spec, deps)
+		if err != nil {
+			logger.Info("unable to read image pull secrets", "error", err)
+			return nil, nil, err
+		}
+		failed, err := PinImages(ctx, r.images, keychain, spec)
+		if err != nil {
+			logger.Info("unable to pin images", "error", err)
+			return nil, nil, err
+		}
+		// The revision is published with the tag rather than failing
+		// while the registry is down.
+		for name, err := range failed {
+			logger.Info("warning: unable to pin image, using its tag", "image", name, "error", err)
+			unpinned = append(unpinned, name)
+		}
+		sort.Strings(unpinned)
+	}
+
+	// Dependencies are copied into the namespace of the Referrer, so
+	// references to copies that are renamed need to be updated.
+	copies, err := dependency.Copies(deps, impl.GetNamespace())
+	if err != nil {
+		logger.Info("unable to copy dependencies", "error", err)
+		return nil, nil, err
+	}
+	dependency.Rewrite(spec, copies)
+
 	data, err := json.MarshalIndent(spec, "", "  ")
 	if err != nil {
 		logger.Error(err, "failed to marshal revision spec")
-		return nil, err
+		return nil, nil, err
 	}
 
 	rev := &v1beta1.Revision{}
 	rev.SetData(data)
+	r.setIdentity(rev, impl)
 	rev.SetLabels(r.revisionLabelSet(impl))
-	rev.SetAnnotations(map[string]string{LabelKeyTemplate: impl.TemplateRef().String()})
-	rev.SetName(impl.GetName() + "-" + rev.Hash())
+	annotations := map[string]string{
+		LabelKeyTemplate:                  impl.TemplateRef().String(),
+		v1beta1.AnnotationKeyRevisionHash: rev.Sum(),
+	}
+	if len(applied) > 0 {
+		annotations[AnnotationKeyPodDefaults] = strings.Join(applied, ",")
+	}
+	if len(unpinned) > 0 {
+		annotations[AnnotationKeyUnpinnedImages] = strings.Join(unpinned, ",")
+	}
+	rev.SetAnnotations(annotations)
+	rev.SetName(revisionName(impl.GetName(), rev.Hash()))
 	rev.SetNamespace(impl.GetNamespace())
-	// if the publisher is created successfully, copy all the dependencies
-	// and set the parent as the publisher
-	if err := r.client.Create(ctx, rev); client.IgnoreAlreadyExists(err) != nil {
-		logger.Error(err, "failed to create revision")
+	if err := rev.SetProvenance(provenance); err != nil {
+		logger.Error(err, "failed to annotate revision provenance")
+		return nil, nil, err
+	}
+	if err := dependency.Annotate(rev, copies); err != nil {
+		logger.Error(err, "failed to annotate revision dependencies")
+		return nil, nil, err
+	}
+	return rev, deps, nil
+}
+
+func hasContainer(spec *v1beta1.PodTemplateSpec, name string) bool {
+	for _, c := range spec.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setIdentity records the template and options the revision is published
+// from, which are part of its Sum.
+func (r *Publisher) setIdentity(rev *v1beta1.Revision, impl Referrer) {
+	ref := impl.TemplateRef()
+	rev.Spec.TemplateRef = &v1beta1.TemplateReference{Name: ref.Name, Namespace: ref.Namespace, Kind: impl.TemplateKind()}
+	rev.Spec.Options = make([]string, 0, len(impl.ElectedOptions()))
+	for _, opt := range impl.ElectedOptions() {
+		rev.Spec.Options = append(rev.Spec.Options, opt.Name)
+	}
+	sort.Strings(rev.Spec.Options)
+}
+
+// revisionName returns the name of a revision of the named Referrer. Pods
+// are labelled with the name of their revision, so the Referrer's name is
+// truncated to leave room in a label value for the hash and a collision
+// count.
+func revisionName(name, hash string) string {
+	max := validation.LabelValueMaxLength - len(hash) - len(fmt.Sprintf("-%d", MaxHashCollisions)) - 1
+	if len(name) > max {
+		name = strings.TrimRight(name[:max], "-.")
+	}
+	return name + "-" + hash
+}
+
+// publish creates the revision. If a revision with the same name already
+// exists for the same Referrer and has the same Sum, it's the same
+// revision, and it's returned instead. Otherwise the names collided, so a
+// collision count is appended to the name until a free or matching name
+// is found.
+func (r *Publisher) publish(ctx context.Context, rev *v1beta1.Revision) (*v1beta1.Revision, error) {
+	name, sum := rev.GetName(), rev.Sum()
+	for k := 0; k <= MaxHashCollisions; k++ {
+		if k > 0 {
+			rev.SetName(fmt.Sprintf("%s-%d", name, k))
+		}
+		err := r.client.Create(ctx, rev, client.FieldOwner(apply.FieldManager))
+		if err == nil {
+			return rev, nil
+		}
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		existing := &v1beta1.Revision{}
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(rev), existing); err != nil {
+			return nil, err
+		}
+		// Truncated names of different Referrers can be the same, so the
+		// existing revision has to be a revision of the same Referrer.
+		if existing.Sum() == sum &&
+			existing.GetLabels()[LabelKeyName] == rev.GetLabels()[LabelKeyName] &&
+			existing.GetLabels()[LabelKeyDag] == rev.GetLabels()[LabelKeyDag] {
+			return existing, nil
+		}
+		r.logger.Info("revision hash collision", "name", rev.GetName(), "namespace", rev.GetNamespace())
+	}
+	return nil, errors.Errorf("%s: %s", ErrHashCollision, name)
+}
+
+// Migrate replaces the Referrer's revisions that were published before
+// revisions were named by their Sum with revisions that are, so that
+// publishing the same content again finds them instead of creating a
+// duplicate. Only the template recorded on a legacy revision is carried
+// over as its identity, since the options it was published with weren't
+// recorded. The replacements are published recalled, and take over the
+// elected and stopped state and the dependency copies before the legacy
+// revisions are deleted, so only one revision is elected at a time. The
+// old name is recorded on each replacement. Migrate returns the new names
+// of the revisions it replaced by their old names.
+func (r *Publisher) Migrate(ctx context.Context, impl Referrer) (map[string]string, error) {
+	revList, err := r.List(ctx, impl)
+	if err != nil {
 		return nil, err
 	}
+	renamed := make(map[string]string)
+	for k := 0; k < revList.Len(); k++ {
+		legacy := revList.Revision(k)
+		if _, ok := legacy.GetAnnotations()[v1beta1.AnnotationKeyRevisionHash]; ok {
+			continue
+		}
 
-	for _, dep := range deps {
-		o, err := r.scheme.New(dep.GroupVersionKind())
+		rev := &v1beta1.Revision{}
+		rev.SetNamespace(legacy.GetNamespace())
+		rev.SetLabels(legacy.GetLabels())
+		rev.SetOwnerReferences(legacy.GetOwnerReferences())
+		rev.Spec = *legacy.Spec.DeepCopy()
+		rev.Spec.TemplateRef = legacyTemplateRef(legacy)
+		rev.Spec.Options = nil
+		rev.Recall()
+		annotations := make(map[string]string)
+		for key, value := range legacy.GetAnnotations() {
+			annotations[key] = value
+		}
+		annotations[v1beta1.AnnotationKeyRevisionHash] = rev.Sum()
+		annotations[v1beta1.AnnotationKeyMigratedFrom] = legacy.GetName()
+		rev.SetAnnotations(annotations)
+		rev.SetName(revisionName(impl.GetName(), rev.Hash()))
+
+		rev, err = r.publish(ctx, rev)
 		if err != nil {
-			obj := &unstructured.Unstructured{}
-			obj.SetGroupVersionKind(dep.GroupVersionKind())
-			o = obj
-		}
-		obj := o.(client.Object)
-		obj.SetNamespace(template.GetNamespace())
-		if err := r.client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
-			logger.Error(err, "cannot create instance of dependency", "dependency", dep.Name)
 			return nil, err
 		}
-		obj.SetOwnerReferences(append(obj.GetOwnerReferences(), rev.AsOwner()))
-		obj.SetName(rev.GetName())
-		obj.SetNamespace(rev.GetNamespace())
-
-		// reset all metadata
-		obj.SetCreationTimestamp(metav1.Time{})
-		obj.SetDeletionTimestamp(nil)
-		obj.SetFinalizers(nil)
-		obj.SetResourceVersion("")
-		obj.SetSelfLink("")
-		obj.SetGenerateName("")
-		obj.SetDeletionGracePeriodSeconds(nil)
-		obj.SetManagedFields(nil)
-		if err := r.client.Create(ctx, obj); client.IgnoreAlreadyExists(err) != nil {
-			logger.Error(err, "failed to create dependency", "dependency", dep.Name)
+		if err := dependency.NewPropagator(r.client).Transfer(ctx, legacy, rev); err != nil {
+			return nil, err
+		}
+		if legacy.Elected() && !rev.Elected() {
+			if err := r.setElected(ctx, legacy, false); err != nil {
+				return nil, err
+			}
+			if err := r.setElected(ctx, rev, true); err != nil {
+				return nil, err
+			}
+		}
+		if err := r.client.Delete(ctx, legacy); client.IgnoreNotFound(err) != nil {
 			return nil, err
 		}
+		r.logger.Info("migrated revision", "from", legacy.GetName(), "to", rev.GetName(), "namespace", rev.GetNamespace())
+		renamed[legacy.GetName()] = rev.GetName()
 	}
-	return rev, r.TrimRevisions(ctx, impl)
+	return renamed, nil
 }
 
+// legacyTemplateRef returns the template a legacy revision was published
+// from, which was recorded as namespace/name, with an empty namespace for
+// ClusterTemplates. It returns nil if it wasn't recorded.
+func legacyTemplateRef(legacy *v1beta1.Revision) *v1beta1.TemplateReference {
+	value, ok := legacy.GetAnnotations()[LabelKeyTemplate]
+	if !ok {
+		return nil
+	}
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || name == "" {
+		return nil
+	}
+	if namespace == "" {
+		return &v1beta1.TemplateReference{Name: name, Kind: v1beta1.KindClusterTemplate}
+	}
+	return &v1beta1.TemplateReference{Name: name, Namespace: namespace, Kind: v1beta1.KindTemplate}
+}
+
+// createStrategicMergePatch returns the strategic merge patch that
+// changes the from pod template into the to pod template.
 func createStrategicMergePatch(from, to v1beta1.PodTemplateSpec) ([]byte, error) {
-	original, err := runtime.DefaultUnstructuredConverter.ToUnstructured(from)
+	original, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&from)
 	if err != nil {
 		return nil, err
 	}
-	modified, err := runtime.DefaultUnstructuredConverter.ToUnstructured(to)
+	modified, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&to)
 	if err != nil {
 		return nil, err
 	}
@@ -352,5 +820,4 @@ func createStrategicMergePatch(from, to v1beta1.PodTemplateSpec) ([]byte, error)
 		return nil, err
 	}
 	return json.Marshal(patch)
-
 }
@@ -0,0 +1,139 @@
+package revision
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func newNotebook(name, namespace string, ref v1beta1.TemplateReference, options ...string) *v1beta1.Notebook {
+	return &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: v1beta1.NotebookSpec{
+			RevisionHistoryLimit: 3,
+			TemplateRef:          ref,
+			Options:              options,
+		},
+	}
+}
+
+func unmarshalRevision(t *testing.T, rev *v1beta1.Revision) v1beta1.PodTemplateSpec {
+	t.Helper()
+	spec := v1beta1.PodTemplateSpec{}
+	qt.Assert(t, json.Unmarshal(rev.GetData(), &spec), qt.IsNil)
+	return spec
+}
+
+func TestPublisher_Create_ClusterTemplate(t *testing.T) {
+	ct := &v1beta1.ClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "jupyter-scipy"},
+		Spec: v1beta1.ClusterTemplateSpec{
+			TemplateSpec: v1beta1.TemplateSpec{
+				Required: []v1beta1.PodDefaultReference{{Name: "pypi", Kind: v1beta1.KindClusterPodDefault}},
+				Options:  []v1beta1.TemplateOption{{Name: "spark"}},
+				Template: v1beta1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter-scipy:v1"}}},
+				},
+			},
+			AllowedNamespaces: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "ml"}},
+		},
+	}
+	pypi := &v1beta1.ClusterPodDefault{
+		ObjectMeta: metav1.ObjectMeta{Name: "pypi"},
+		Spec: v1beta1.PodDefaultSpec{Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "main",
+				Env:  []corev1.EnvVar{{Name: "PIP_INDEX_URL", Value: "https://pypi.private.com"}},
+			}}},
+		}},
+	}
+	// options of a cluster template are read from the system namespace
+	spark := &v1beta1.PodDefault{
+		ObjectMeta: metav1.ObjectMeta{Name: "spark", Namespace: "kubeflow"},
+		Spec: v1beta1.PodDefaultSpec{Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "main",
+				Ports: []corev1.ContainerPort{{Name: "http-spark", ContainerPort: 4040}},
+			}}},
+		}},
+	}
+	ml := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-ml", Labels: map[string]string{"team": "ml"}}}
+	web := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-web", Labels: map[string]string{"team": "web"}}}
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ct, pypi, spark, ml, web).Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s, WithNamespace("kubeflow"))
+	ref := v1beta1.TemplateReference{Name: "jupyter-scipy", Kind: v1beta1.KindClusterTemplate}
+
+	t.Run("AllowedNamespace", func(t *testing.T) {
+		rev, err := pub.Create(ctx, newNotebook("nb", "team-ml", ref, "spark"))
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, unmarshalRevision(t, rev).Spec.Containers, qt.DeepEquals, []corev1.Container{{
+			Name:  "main",
+			Image: "jupyter-scipy:v1",
+			Env:   []corev1.EnvVar{{Name: "PIP_INDEX_URL", Value: "https://pypi.private.com"}},
+			Ports: []corev1.ContainerPort{{Name: "http-spark", ContainerPort: 4040}},
+		}})
+	})
+	t.Run("DisallowedNamespace", func(t *testing.T) {
+		_, err := pub.Create(ctx, newNotebook("nb", "team-web", ref))
+		qt.Assert(t, err, qt.ErrorMatches, ErrNamespaceNotAllowed+".*")
+	})
+}
+
+// dagTask is a Referrer that's a task of a Dag.
+type dagTask struct {
+	*v1beta1.Notebook
+	dag string
+}
+
+func (task dagTask) DagName() string { return task.dag }
+
+func TestPublisher_List_Task(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(template).Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	ref := v1beta1.TemplateReference{Name: "jupyter"}
+	nb := newNotebook("train", "test", ref)
+	first := dagTask{Notebook: newNotebook("train", "test", ref), dag: "first"}
+	second := dagTask{Notebook: newNotebook("train", "test", ref), dag: "second"}
+
+	// a Notebook and the tasks of different Dags with the same name have
+	// their own revisions, even if they're the same
+	names := make(map[string]bool)
+	for _, impl := range []Referrer{nb, first, second} {
+		rev, err := pub.Create(ctx, impl)
+		qt.Assert(t, err, qt.IsNil)
+		names[rev.GetName()] = true
+	}
+	qt.Assert(t, names, qt.HasLen, 3)
+
+	for _, impl := range []Referrer{nb, first, second} {
+		revList, err := pub.List(ctx, impl)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, revList.Items, qt.HasLen, 1)
+		if task, ok := impl.(TaskReferrer); ok {
+			qt.Assert(t, revList.Items[0].Labels[LabelKeyDag], qt.Equals, task.DagName())
+		} else {
+			_, ok := revList.Items[0].Labels[LabelKeyDag]
+			qt.Assert(t, ok, qt.IsFalse)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package revision
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func newEnvPodDefault(name, namespace string, priority int32, selector map[string]string, value string) *v1beta1.PodDefault {
+	pd := &v1beta1.PodDefault{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: v1beta1.PodDefaultSpec{
+			Priority: priority,
+			Template: v1beta1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name: "main",
+					Env:  []corev1.EnvVar{{Name: "SOURCE", Value: value}},
+				}}},
+			},
+		},
+	}
+	if selector != nil {
+		pd.Spec.Selector = &metav1.LabelSelector{MatchLabels: selector}
+	}
+	return pd
+}
+
+func TestPublisher_Create_SelectedPodDefaults(t *testing.T) {
+	template := newTemplate("jupyter", "", v1beta1.TemplateSpec{
+		Options: []v1beta1.TemplateOption{{Name: "pinned"}},
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v1"}}},
+		},
+	})
+	team := map[string]string{"team": "ml"}
+	s3 := newEnvPodDefault("s3", "test", 0, team, "s3")
+	// higher priority is merged later, regardless of name
+	override := newEnvPodDefault("a-override", "test", 10, team, "override")
+	// a referenced PodDefault is merged where it's referenced
+	pinned := newEnvPodDefault("pinned", "test", -1, team, "pinned")
+	other := newEnvPodDefault("other", "test", 0, map[string]string{"team": "web"}, "other")
+	unselected := newEnvPodDefault("unselected", "test", 0, nil, "unselected")
+	cluster := &v1beta1.ClusterPodDefault{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+		Spec:       newEnvPodDefault("cluster", "", 5, team, "cluster").Spec,
+	}
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template, s3, override, pinned, other, unselected, cluster).
+		Build()
+
+	ctx := context.Background()
+	pub := NewPublisher(k8s)
+	ref := v1beta1.TemplateReference{Name: "jupyter"}
+
+	t.Run("Selected", func(t *testing.T) {
+		nb := newNotebook("nb", "test", ref)
+		nb.SetLabels(team)
+		rev, err := pub.Create(ctx, nb)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, rev.GetAnnotations()[AnnotationKeyPodDefaults], qt.Equals,
+			"PodDefault/test/pinned,PodDefault/test/s3,ClusterPodDefault/cluster,PodDefault/test/a-override")
+		qt.Assert(t, unmarshalRevision(t, rev).Spec.Containers[0].Env, qt.DeepEquals, []corev1.EnvVar{{Name: "SOURCE", Value: "override"}})
+	})
+	t.Run("Referenced", func(t *testing.T) {
+		nb := newNotebook("nb-pinned", "test", ref, "pinned")
+		nb.SetLabels(team)
+		rev, err := pub.Create(ctx, nb)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, rev.GetAnnotations()[AnnotationKeyPodDefaults], qt.Equals,
+			"PodDefault/test/s3,ClusterPodDefault/cluster,PodDefault/test/a-override,PodDefault/test/pinned")
+		qt.Assert(t, unmarshalRevision(t, rev).Spec.Containers[0].Env, qt.DeepEquals, []corev1.EnvVar{{Name: "SOURCE", Value: "pinned"}})
+	})
+	t.Run("NotSelected", func(t *testing.T) {
+		rev, err := pub.Create(ctx, newNotebook("nb-other", "test", ref))
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, rev.GetAnnotations()[AnnotationKeyPodDefaults], qt.Equals, "")
+		qt.Assert(t, unmarshalRevision(t, rev).Spec.Containers[0].Env, qt.HasLen, 0)
+	})
+}
@@ -0,0 +1,173 @@
+package revision
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+const (
+	// MaxTemplateDepth is the maximum number of Templates in an
+	// extends chain, including the Template itself.
+	MaxTemplateDepth = 10
+
+	ErrTemplateCycle         = "template extends cycle"
+	ErrTemplateDepthExceeded = "template extends depth exceeded"
+	ErrNamespaceNotAllowed   = "namespace not allowed"
+)
+
+// ResolveTemplate gets the Template, or ClusterTemplate if kind is
+// ClusterTemplate, and flattens its extends chain, so the returned
+// Template contains everything inherited from its ancestors. The returned
+// Template doesn't extend anything. ClusterTemplates are returned as a
+// Template without a namespace.
+func ResolveTemplate(ctx context.Context, c client.Reader, kind string, key types.NamespacedName) (*v1beta1.Template, error) {
+	template, _, err := resolveTemplate(ctx, c, kind, key)
+	return template, err
+}
+
+// resolveTemplate is ResolveTemplate, and also returns the templates the
+// Template extends, nearest first.
+func resolveTemplate(ctx context.Context, c client.Reader, kind string, key types.NamespacedName) (*v1beta1.Template, []*v1beta1.Template, error) {
+	chain := make([]*v1beta1.Template, 0)
+	names := make([]string, 0)
+	for {
+		for _, name := range names {
+			if name == key.Name {
+				return nil, nil, errors.Errorf("%s: %s -> %s", ErrTemplateCycle, strings.Join(names, " -> "), key.Name)
+			}
+		}
+		if len(chain) == MaxTemplateDepth {
+			return nil, nil, errors.Errorf("%s: %s has more than %d ancestors", ErrTemplateDepthExceeded, names[0], MaxTemplateDepth-1)
+		}
+
+		template, err := getTemplate(ctx, c, kind, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, template)
+		names = append(names, template.Name)
+		if template.Spec.Extends == nil {
+			break
+		}
+		key = types.NamespacedName{Name: template.Spec.Extends.Name, Namespace: template.Namespace}
+	}
+
+	// merge from the root down, so each child is applied on top
+	// of everything it inherits
+	resolved := chain[len(chain)-1]
+	for k := len(chain) - 2; k >= 0; k-- {
+		if err := chain[k].Inherit(resolved); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to merge template %q into %q", chain[k].Name, resolved.Name)
+		}
+		resolved = chain[k]
+	}
+	resolved.Spec.Extends = nil
+	return resolved, chain[1:], nil
+}
+
+func getTemplate(ctx context.Context, c client.Reader, kind string, key types.NamespacedName) (*v1beta1.Template, error) {
+	if kind == v1beta1.KindClusterTemplate {
+		ct := &v1beta1.ClusterTemplate{}
+		if err := c.Get(ctx, types.NamespacedName{Name: key.Name}, ct); err != nil {
+			return nil, err
+		}
+		return ct.Template(), nil
+	}
+	template := &v1beta1.Template{}
+	return template, c.Get(ctx, key, template)
+}
+
+// CheckAllowedNamespace returns an error if workloads in the namespace
+// aren't allowed to reference the named ClusterTemplate.
+func CheckAllowedNamespace(ctx context.Context, c client.Reader, name, namespace string) error {
+	ct := &v1beta1.ClusterTemplate{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, ct); err != nil {
+		return err
+	}
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return err
+	}
+	ok, err := ct.AllowsNamespace(ns)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf("%s: cluster template %q cannot be used in namespace %q", ErrNamespaceNotAllowed, name, namespace)
+	}
+	return nil
+}
+
+// GetPodDefault gets the referenced PodDefault from the namespace, or
+// the ClusterPodDefault if the reference is to one. ClusterPodDefaults are
+// returned as a PodDefault without a namespace.
+func GetPodDefault(ctx context.Context, c client.Reader, ref v1beta1.PodDefaultReference, namespace string) (*v1beta1.PodDefault, error) {
+	if ref.PodDefaultKind() == v1beta1.KindClusterPodDefault {
+		cpd := &v1beta1.ClusterPodDefault{}
+		if err := c.Get(ctx, types.NamespacedName{Name: ref.Name}, cpd); err != nil {
+			return nil, err
+		}
+		return cpd.PodDefault(), nil
+	}
+	pd := &v1beta1.PodDefault{}
+	return pd, c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, pd)
+}
+
+// SelectPodDefaults returns the PodDefaults in the namespace, and the
+// ClusterPodDefaults, with a selector that matches any of the label sets.
+// The PodDefaults are returned in the order they're merged, by priority
+// and then by name. ClusterPodDefaults are returned as PodDefaults without
+// a namespace.
+func SelectPodDefaults(ctx context.Context, c client.Reader, namespace string, labels ...map[string]string) ([]*v1beta1.PodDefault, error) {
+	candidates := make([]*v1beta1.PodDefault, 0)
+
+	pdList := &v1beta1.PodDefaultList{}
+	if err := c.List(ctx, pdList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for k := range pdList.Items {
+		candidates = append(candidates, &pdList.Items[k])
+	}
+	cpdList := &v1beta1.ClusterPodDefaultList{}
+	if err := c.List(ctx, cpdList); err != nil {
+		return nil, err
+	}
+	for k := range cpdList.Items {
+		candidates = append(candidates, cpdList.Items[k].PodDefault())
+	}
+
+	selected := make([]*v1beta1.PodDefault, 0)
+	for _, pd := range candidates {
+		ok, err := pd.Matches(labels...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid selector on %s", PodDefaultKey(pd))
+		}
+		if ok {
+			selected = append(selected, pd)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		if selected[i].Spec.Priority != selected[j].Spec.Priority {
+			return selected[i].Spec.Priority < selected[j].Spec.Priority
+		}
+		return PodDefaultKey(selected[i]) < PodDefaultKey(selected[j])
+	})
+	return selected, nil
+}
+
+// PodDefaultKey identifies a PodDefault as Kind/namespace/name, or
+// Kind/name for ClusterPodDefaults.
+func PodDefaultKey(pd *v1beta1.PodDefault) string {
+	if pd.GetNamespace() == "" {
+		return v1beta1.KindClusterPodDefault + "/" + pd.GetName()
+	}
+	return v1beta1.KindPodDefault + "/" + pd.GetNamespace() + "/" + pd.GetName()
+}
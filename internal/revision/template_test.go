@@ -0,0 +1,133 @@
+package revision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func newTemplate(name, extends string, spec v1beta1.TemplateSpec) *v1beta1.Template {
+	if extends != "" {
+		spec.Extends = &corev1.LocalObjectReference{Name: extends}
+	}
+	return &v1beta1.Template{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec:       spec,
+	}
+}
+
+func TestResolveTemplate(t *testing.T) {
+	base := newTemplate("base", "", v1beta1.TemplateSpec{
+		Options:  []v1beta1.TemplateOption{{Name: "spark", Description: "spark"}},
+		Required: []v1beta1.PodDefaultReference{{Name: "pypi"}},
+		Template: v1beta1.PodTemplateSpec{
+			ObjectMeta: v1beta1.ObjectMeta{Labels: map[string]string{"team": "ml"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "main",
+					Image: "jupyter-base:v1",
+					Ports: []corev1.ContainerPort{{ContainerPort: 8888}},
+				}},
+			},
+		},
+	})
+	scipy := newTemplate("scipy", "base", v1beta1.TemplateSpec{
+		Options:  []v1beta1.TemplateOption{{Name: "spark", Description: "spark 3"}, {Name: "gpu"}},
+		Required: []v1beta1.PodDefaultReference{{Name: "pypi"}, {Name: "s3"}},
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "main", Image: "jupyter-scipy:v1"}},
+			},
+		},
+	})
+	pinned := newTemplate("pinned", "scipy", v1beta1.TemplateSpec{
+		Template: v1beta1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "main", Image: "jupyter-scipy:v1.7.0"}},
+			},
+		},
+	})
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(base, scipy, pinned).Build()
+
+	got, err := ResolveTemplate(context.Background(), k8s, v1beta1.KindTemplate, types.NamespacedName{Name: "pinned", Namespace: "test"})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got.Name, qt.Equals, "pinned")
+	qt.Assert(t, got.Spec.Extends, qt.IsNil)
+	qt.Assert(t, got.Spec.Template.Labels, qt.DeepEquals, map[string]string{"team": "ml"})
+	qt.Assert(t, got.Spec.Template.Spec.Containers, qt.DeepEquals, []corev1.Container{{
+		Name:  "main",
+		Image: "jupyter-scipy:v1.7.0",
+		Ports: []corev1.ContainerPort{{ContainerPort: 8888}},
+	}})
+	qt.Assert(t, got.Spec.Options, qt.DeepEquals, []v1beta1.TemplateOption{
+		{Name: "spark", Description: "spark 3"},
+		{Name: "gpu"},
+	})
+	qt.Assert(t, got.Spec.Required, qt.DeepEquals, []v1beta1.PodDefaultReference{{Name: "pypi"}, {Name: "s3"}})
+}
+
+func TestResolveTemplate_Cycle(t *testing.T) {
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		newTemplate("a", "b", v1beta1.TemplateSpec{}),
+		newTemplate("b", "c", v1beta1.TemplateSpec{}),
+		newTemplate("c", "a", v1beta1.TemplateSpec{}),
+	).Build()
+
+	_, err := ResolveTemplate(context.Background(), k8s, v1beta1.KindTemplate, types.NamespacedName{Name: "a", Namespace: "test"})
+	qt.Assert(t, err, qt.ErrorMatches, ErrTemplateCycle+": a -> b -> c -> a")
+}
+
+func TestResolveTemplate_DepthExceeded(t *testing.T) {
+	objs := make([]client.Object, 0, MaxTemplateDepth+1)
+	for k := 0; k <= MaxTemplateDepth; k++ {
+		objs = append(objs, newTemplate(fmt.Sprintf("t%d", k), fmt.Sprintf("t%d", k+1), v1beta1.TemplateSpec{}))
+	}
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build()
+
+	_, err := ResolveTemplate(context.Background(), k8s, v1beta1.KindTemplate, types.NamespacedName{Name: "t0", Namespace: "test"})
+	qt.Assert(t, err, qt.ErrorMatches, ErrTemplateDepthExceeded+".*")
+}
+
+func TestResolveTemplate_ContainerName(t *testing.T) {
+	// The CRD doesn't default the container name, so a child stored
+	// without one inherits its parent's.
+	data, err := os.ReadFile(filepath.Join("..", "..", "config", "crd", "bases", "jackhoman.dev_templates.yaml"))
+	qt.Assert(t, err, qt.IsNil)
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	qt.Assert(t, yaml.Unmarshal(data, crd), qt.IsNil)
+	spec := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+	qt.Assert(t, spec.Properties["containerName"].Default, qt.IsNil)
+
+	base := newTemplate("base", "", v1beta1.TemplateSpec{ContainerName: "notebook"})
+	child := newTemplate("child", "base", v1beta1.TemplateSpec{})
+	data, err = json.Marshal(child)
+	qt.Assert(t, err, qt.IsNil)
+	stored := &v1beta1.Template{}
+	qt.Assert(t, json.Unmarshal(data, stored), qt.IsNil)
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	k8s := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(base, stored).Build()
+
+	got, err := ResolveTemplate(context.Background(), k8s, v1beta1.KindTemplate, types.NamespacedName{Name: "child", Namespace: "test"})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, got.ContainerName(), qt.Equals, "notebook")
+}
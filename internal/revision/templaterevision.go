@@ -0,0 +1,146 @@
+package revision
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+const (
+	ErrTemplateRevisionNotFound = "template revision not found"
+)
+
+// ResolveReferrerTemplate resolves the template the Referrer references,
+// at the version it's pinned to.
+func ResolveReferrerTemplate(ctx context.Context, c client.Reader, impl Referrer) (*v1beta1.Template, error) {
+	return ResolveTemplateVersion(ctx, c, impl.TemplateKind(), impl.TemplateRef(), impl.TemplateRevision(), impl.TemplateResourceVersion())
+}
+
+// ResolveTemplateVersion returns the template from the named TemplateRevision,
+// or from the TemplateRevision taken at the resourceVersion. Revision takes
+// precedence over resourceVersion. If both are empty, the latest template is
+// resolved with ResolveTemplate.
+func ResolveTemplateVersion(ctx context.Context, c client.Reader, kind string, key types.NamespacedName, revision, resourceVersion string) (*v1beta1.Template, error) {
+	template, _, err := resolveTemplateVersion(ctx, c, kind, key, revision, resourceVersion)
+	return template, err
+}
+
+// resolveTemplateVersion is ResolveTemplateVersion, and also returns the
+// templates the template extends, nearest first, when it's resolved from
+// the latest templates.
+func resolveTemplateVersion(ctx context.Context, c client.Reader, kind string, key types.NamespacedName, revision, resourceVersion string) (*v1beta1.Template, []*v1beta1.Template, error) {
+	if revision == "" && resourceVersion == "" {
+		return resolveTemplate(ctx, c, kind, key)
+	}
+
+	revs, err := ListTemplateRevisions(ctx, c, kind, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rev := FindTemplateRevision(revs, revision, resourceVersion); rev != nil {
+		spec, err := rev.Spec.TemplateSpec()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to read template revision %q", rev.Name)
+		}
+		template := &v1beta1.Template{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            key.Name,
+				Namespace:       rev.Namespace,
+				Labels:          make(map[string]string),
+				ResourceVersion: rev.Spec.ResourceVersion,
+			},
+			Spec: spec,
+		}
+		if owner := metav1.GetControllerOf(rev); owner != nil {
+			template.UID = owner.UID
+		}
+		if kind == v1beta1.KindClusterTemplate {
+			template.TypeMeta = metav1.TypeMeta{APIVersion: v1beta1.GroupVersion.String(), Kind: v1beta1.KindClusterTemplate}
+		}
+		for k, v := range rev.Labels {
+			if k != v1beta1.LabelKeyTemplateName {
+				template.Labels[k] = v
+			}
+		}
+		return template, nil, nil
+	}
+
+	if revision == "" {
+		// A change that doesn't change the spec, such as to the template's
+		// labels, doesn't create a revision, and the resourceVersion may
+		// not be recorded on the current revision yet, so the template may
+		// still be at the resourceVersion.
+		live, err := getTemplate(ctx, c, kind, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if live.ResourceVersion == resourceVersion {
+			return resolveTemplate(ctx, c, kind, key)
+		}
+		return nil, nil, errors.Errorf("%s: %s %s at resourceVersion %s", ErrTemplateRevisionNotFound, kind, key.Name, resourceVersion)
+	}
+	return nil, nil, errors.Errorf("%s: %s", ErrTemplateRevisionNotFound, revision)
+}
+
+// FindTemplateRevision returns the revision a workload pinned to the named
+// revision, or to the template's resourceVersion, resolves to, or nil if
+// there isn't one. A template's resourceVersion doesn't change when a
+// template it extends does, so several revisions can be taken at the same
+// resourceVersion. The oldest of them is returned, since it's the one the
+// template rendered to when it had that resourceVersion. revs must be
+// newest first, as returned by ListTemplateRevisions.
+func FindTemplateRevision(revs []*v1beta1.TemplateRevision, revision, resourceVersion string) *v1beta1.TemplateRevision {
+	var found *v1beta1.TemplateRevision
+	for _, rev := range revs {
+		switch {
+		case revision != "":
+			if rev.Name == revision {
+				return rev
+			}
+		case resourceVersion != "":
+			if rev.Spec.HasResourceVersion(resourceVersion) {
+				found = rev
+			}
+		}
+	}
+	return found
+}
+
+// ListTemplateRevisions returns the revisions of the Template, or the
+// ClusterTemplate if kind is ClusterTemplate, newest first.
+// ClusterTemplateRevisions are returned as TemplateRevisions without a
+// namespace.
+func ListTemplateRevisions(ctx context.Context, c client.Reader, kind string, key types.NamespacedName) ([]*v1beta1.TemplateRevision, error) {
+	labels := client.MatchingLabels{v1beta1.LabelKeyTemplateName: key.Name}
+	revs := make([]*v1beta1.TemplateRevision, 0)
+	if kind == v1beta1.KindClusterTemplate {
+		revList := &v1beta1.ClusterTemplateRevisionList{}
+		if err := c.List(ctx, revList, labels); err != nil {
+			return nil, err
+		}
+		for k := range revList.Items {
+			revs = append(revs, revList.Items[k].TemplateRevision())
+		}
+	} else {
+		revList := &v1beta1.TemplateRevisionList{}
+		if err := c.List(ctx, revList, client.InNamespace(key.Namespace), labels); err != nil {
+			return nil, err
+		}
+		for k := range revList.Items {
+			revs = append(revs, &revList.Items[k])
+		}
+	}
+	sort.SliceStable(revs, func(i, j int) bool {
+		if !revs[i].CreationTimestamp.Equal(&revs[j].CreationTimestamp) {
+			return revs[j].Less(revs[i])
+		}
+		return revs[i].Name < revs[j].Name
+	})
+	return revs, nil
+}
@@ -0,0 +1,34 @@
+// Package version reports the version of the controller.
+package version
+
+import (
+	"runtime/debug"
+)
+
+// Version is the version of the controller. It's set when the controller
+// is built with
+//
+//	-ldflags "-X github.com/johnhoman/notebook-controller/internal/version.Version=v1.2.3"
+var Version = ""
+
+// Get returns the version of the controller. If the version isn't set when
+// it's built, the version of the main module is used, or the revision of
+// the commit it was built from.
+func Get() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return "unknown"
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"net/http"
+
+	"github.com/johnhoman/notebook-controller/internal/revision"
 )
 
 type App struct {
@@ -11,6 +13,10 @@ type App struct {
 
 	logger *zap.Logger
 
+	// publisherOptions configure the Publisher that renders a Notebook's
+	// template for diffs, and should match the controller's.
+	publisherOptions []revision.Option
+
 	userIDHeaderKey    string
 	userIDHeaderPrefix string
 	groupHeaderKey     string
@@ -22,5 +28,9 @@ func (app *App) Router(r *gin.Engine) http.Handler {
 		r = gin.Default()
 	}
 	r.GET("/api/namespaces/:namespace/templates", app.ListTemplates)
+	r.GET("/api/namespaces/:namespace/templates/:name/revisions", app.ListTemplateRevisions)
+	r.GET("/api/namespaces/:namespace/notebooks/:name/revisions/diff", app.GetNotebookRevisionDiff)
+	r.POST("/api/namespaces/:namespace/notebooks/:name/rollback", app.RollbackNotebook)
+	r.GET("/api/namespaces/:namespace/dags/:name/graph", app.GetDagGraph)
 	return r
 }
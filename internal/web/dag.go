@@ -0,0 +1,64 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/graph"
+)
+
+// GetDagGraph responds with the Dag rendered as a graph. The format
+// query parameter selects between dot and mermaid, and the optional
+// execution query parameter colours the tasks by their status in that
+// Execution.
+func (app *App) GetDagGraph(c *gin.Context) {
+	ns, name := c.Param("namespace"), c.Param("name")
+	format := c.DefaultQuery("format", graph.FormatDOT)
+
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	dag := &v1beta1.Dag{}
+	if err := app.client.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, dag); err != nil {
+		app.abortWithError(c, err, "failed to get dag", zap.String("namespace", ns), zap.String("name", name))
+		return
+	}
+
+	var execution *v1beta1.Execution
+	if key := c.Query("execution"); key != "" {
+		execution = &v1beta1.Execution{}
+		if err := app.client.Get(ctx, types.NamespacedName{Name: key, Namespace: ns}, execution); err != nil {
+			app.abortWithError(c, err, "failed to get execution", zap.String("namespace", ns), zap.String("name", key))
+			return
+		}
+	}
+
+	out, err := graph.Render(format, dag, execution)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.String(http.StatusOK, out)
+}
+
+// abortWithError aborts the request with a status code that matches
+// the Kubernetes API error.
+func (app *App) abortWithError(c *gin.Context, err error, msg string, fields ...zap.Field) {
+	switch {
+	case errors.IsNotFound(err):
+		c.AbortWithStatus(http.StatusNotFound)
+	case errors.IsForbidden(err):
+		c.AbortWithStatus(http.StatusForbidden)
+	default:
+		if app.logger != nil {
+			app.logger.Error(msg, append(fields, zap.Error(err))...)
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+)
+
+func TestApp_GetDagGraph(t *testing.T) {
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	dag := &v1beta1.Dag{
+		ObjectMeta: metav1.ObjectMeta{Name: "dag1", Namespace: "test"},
+		Spec: v1beta1.DagSpec{
+			Entrypoint: "task1",
+			Tasks:      []v1beta1.DagTask{{Name: "task1"}},
+		},
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(dag).
+		Build()
+
+	app := &App{client: k8s}
+	mux := app.Router(nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/namespaces/test/dags/dag1/graph?format=mermaid", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK)
+	qt.Assert(t, w.Body.String(), qt.Equals, "flowchart LR\n  t0[\"task1\"]\n")
+
+	r = httptest.NewRequest(http.MethodGet, "/api/namespaces/test/dags/missing/graph", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	qt.Assert(t, w.Code, qt.Equals, http.StatusNotFound)
+}
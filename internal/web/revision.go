@@ -0,0 +1,180 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+// GetNotebookRevisionDiff responds with the difference between two
+// revisions of a Notebook. The to query parameter defaults to the elected
+// revision, and the from query parameter defaults to the revision
+// published before it. With the template query parameter, the from
+// revision, which defaults to the elected revision, is compared against
+// the revision the Notebook's template would publish now.
+func (app *App) GetNotebookRevisionDiff(c *gin.Context) {
+	ns, name := c.Param("namespace"), c.Param("name")
+	fields := []zap.Field{zap.String("namespace", ns), zap.String("name", name)}
+
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	revList := &v1beta1.RevisionList{}
+	err := app.client.List(ctx, revList, client.InNamespace(ns), client.MatchingLabelsSelector{Selector: revision.Selector(name, "")})
+	if err != nil {
+		app.abortWithError(c, err, "failed to list revisions", fields...)
+		return
+	}
+	revList.Sort()
+
+	if _, ok := c.GetQuery("template"); ok {
+		app.diffTemplate(c, revList, fields...)
+		return
+	}
+
+	to, from := -1, -1
+	for k := 0; k < revList.Len(); k++ {
+		rev := revList.Revision(k)
+		if key := c.Query("to"); rev.Name == key || key == "" && rev.Elected() {
+			to = k
+		}
+	}
+	for k := 0; k < revList.Len(); k++ {
+		if key := c.Query("from"); revList.Revision(k).Name == key || key == "" && k == to-1 {
+			from = k
+		}
+	}
+	if to < 0 || from < 0 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	diff, err := revision.DiffRevisions(revList.Revision(from), revList.Revision(to))
+	if err != nil {
+		app.abortWithError(c, err, "failed to diff revisions", fields...)
+		return
+	}
+	c.JSON(http.StatusOK, RevisionDiffResponse{
+		From:    revList.Revision(from).Name,
+		To:      revList.Revision(to).Name,
+		Summary: diff.Summary(),
+		Patch:   diff.Patch,
+		Changes: diff.Changes,
+	})
+}
+
+// diffTemplate responds with the difference between a revision of the
+// Notebook and the revision its template would publish now, without
+// publishing it.
+func (app *App) diffTemplate(c *gin.Context, revList *v1beta1.RevisionList, fields ...zap.Field) {
+	ns, name := c.Param("namespace"), c.Param("name")
+
+	from := -1
+	for k := 0; k < revList.Len(); k++ {
+		rev := revList.Revision(k)
+		if key := c.Query("from"); rev.Name == key || key == "" && rev.Elected() {
+			from = k
+		}
+	}
+	if from < 0 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	nb := &v1beta1.Notebook{}
+	if err := app.client.Get(c, types.NamespacedName{Name: name, Namespace: ns}, nb); err != nil {
+		app.abortWithError(c, err, "failed to get notebook", fields...)
+		return
+	}
+	// The Publisher only reads, but it takes a full client.
+	k8s, ok := app.client.(client.Client)
+	if !ok {
+		c.String(http.StatusNotImplemented, "diffing against the template isn't supported")
+		return
+	}
+	pub := revision.NewPublisher(k8s, app.publisherOptions...)
+	diff, err := pub.Diff(c, nb, revList.Revision(from))
+	if err != nil {
+		app.abortWithError(c, err, "failed to diff revision against template", fields...)
+		return
+	}
+	c.JSON(http.StatusOK, RevisionDiffResponse{
+		From:    revList.Revision(from).Name,
+		To:      DiffToTemplate,
+		Summary: diff.Summary(),
+		Patch:   diff.Patch,
+		Changes: diff.Changes,
+	})
+}
+
+// DiffToTemplate is the To of a RevisionDiffResponse that compares a
+// revision against the current rendering of the Notebook's template.
+const DiffToTemplate = "template"
+
+// RevisionDiffResponse is the difference between the pod templates
+// of two revisions.
+type RevisionDiffResponse struct {
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Summary string            `json:"summary"`
+	Patch   json.RawMessage   `json:"patch"`
+	Changes []revision.Change `json:"changes"`
+}
+
+// RollbackNotebook pins the Notebook to one of its revisions by setting
+// spec.revisionRef. The Notebook's Pod isn't restarted, so a running
+// Notebook uses the revision once it's stopped and started again.
+func (app *App) RollbackNotebook(c *gin.Context) {
+	ns, name := c.Param("namespace"), c.Param("name")
+	fields := []zap.Field{zap.String("namespace", ns), zap.String("name", name)}
+
+	req := RollbackRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Revision == "" {
+		c.String(http.StatusBadRequest, "a revision is required")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	nb := &v1beta1.Notebook{}
+	if err := app.client.Get(ctx, types.NamespacedName{Name: name, Namespace: ns}, nb); err != nil {
+		app.abortWithError(c, err, "failed to get notebook", fields...)
+		return
+	}
+	rev := &v1beta1.Revision{}
+	if err := app.client.Get(ctx, types.NamespacedName{Name: req.Revision, Namespace: ns}, rev); err != nil {
+		app.abortWithError(c, err, "failed to get revision", append(fields, zap.String("revision", req.Revision))...)
+		return
+	}
+	if !revision.Selector(name, "").Matches(labels.Set(rev.GetLabels())) {
+		c.String(http.StatusBadRequest, "revision %s isn't a revision of notebook %s", req.Revision, name)
+		return
+	}
+
+	patch := client.MergeFrom(nb.DeepCopy())
+	nb.Spec.RevisionRef = req.Revision
+	if err := app.client.Patch(ctx, nb, patch); err != nil {
+		app.abortWithError(c, err, "failed to patch notebook", fields...)
+		return
+	}
+	c.JSON(http.StatusAccepted, RollbackResponse{Notebook: name, Revision: req.Revision})
+}
+
+type RollbackRequest struct {
+	Revision string `json:"revision"`
+}
+
+type RollbackResponse struct {
+	Notebook string `json:"notebook"`
+	Revision string `json:"revision"`
+}
@@ -0,0 +1,161 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
+)
+
+func newRevision(name, image string, elected bool, created time.Time) *v1beta1.Revision {
+	rev := &v1beta1.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "test",
+			Labels:            map[string]string{revision.LabelKeyName: "nb"},
+			CreationTimestamp: metav1.Time{Time: created},
+		},
+		Spec: v1beta1.RevisionSpec{Elected: elected},
+	}
+	rev.SetData([]byte(`{"spec":{"containers":[{"name":"main","image":"` + image + `"}]}}`))
+	return rev
+}
+
+func TestApp_GetNotebookRevisionDiff(t *testing.T) {
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	now := time.Now().Truncate(time.Second)
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			newRevision("nb-1", "jupyter:v1", false, now.Add(-2*time.Hour)),
+			newRevision("nb-2", "jupyter:v2", true, now.Add(-time.Hour)),
+			newRevision("nb-3", "jupyter:v3", false, now),
+		).
+		Build()
+
+	app := &App{client: k8s}
+	mux := app.Router(nil)
+
+	// defaults to the elected revision and the one before it
+	r := httptest.NewRequest(http.MethodGet, "/api/namespaces/test/notebooks/nb/revisions/diff", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK)
+
+	res := RevisionDiffResponse{}
+	qt.Assert(t, json.Unmarshal(w.Body.Bytes(), &res), qt.IsNil)
+	qt.Assert(t, res.From, qt.Equals, "nb-1")
+	qt.Assert(t, res.To, qt.Equals, "nb-2")
+	qt.Assert(t, res.Summary, qt.Equals, "spec.containers[name=main].image changed from jupyter:v1 to jupyter:v2")
+
+	r = httptest.NewRequest(http.MethodGet, "/api/namespaces/test/notebooks/nb/revisions/diff?from=nb-1&to=nb-3", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK)
+	qt.Assert(t, json.Unmarshal(w.Body.Bytes(), &res), qt.IsNil)
+	qt.Assert(t, res.Changes, qt.HasLen, 1)
+	qt.Assert(t, res.Changes[0].To, qt.Equals, "jupyter:v3")
+
+	r = httptest.NewRequest(http.MethodGet, "/api/namespaces/test/notebooks/nb/revisions/diff?from=nb-missing", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	qt.Assert(t, w.Code, qt.Equals, http.StatusNotFound)
+}
+
+func TestApp_GetNotebookRevisionDiff_Template(t *testing.T) {
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	now := time.Now().Truncate(time.Second)
+	template := &v1beta1.Template{
+		ObjectMeta: metav1.ObjectMeta{Name: "jupyter", Namespace: "test"},
+		Spec: v1beta1.TemplateSpec{
+			Template: v1beta1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "jupyter:v3"}}},
+			},
+		},
+	}
+	nb := &v1beta1.Notebook{
+		ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "test"},
+		Spec:       v1beta1.NotebookSpec{TemplateRef: v1beta1.TemplateReference{Name: "jupyter"}},
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			template,
+			nb,
+			newRevision("nb-1", "jupyter:v1", false, now.Add(-time.Hour)),
+			newRevision("nb-2", "jupyter:v2", true, now),
+		).
+		Build()
+
+	app := &App{client: k8s}
+	mux := app.Router(nil)
+
+	// defaults to the elected revision
+	r := httptest.NewRequest(http.MethodGet, "/api/namespaces/test/notebooks/nb/revisions/diff?template", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK, qt.Commentf(w.Body.String()))
+
+	res := RevisionDiffResponse{}
+	qt.Assert(t, json.Unmarshal(w.Body.Bytes(), &res), qt.IsNil)
+	qt.Assert(t, res.From, qt.Equals, "nb-2")
+	qt.Assert(t, res.To, qt.Equals, DiffToTemplate)
+	qt.Assert(t, res.Changes, qt.Contains, revision.Change{
+		Path: "spec.containers[name=main].image",
+		From: "jupyter:v2",
+		To:   "jupyter:v3",
+	})
+
+	r = httptest.NewRequest(http.MethodGet, "/api/namespaces/test/notebooks/nb/revisions/diff?template&from=nb-1", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK)
+	qt.Assert(t, json.Unmarshal(w.Body.Bytes(), &res), qt.IsNil)
+	qt.Assert(t, res.From, qt.Equals, "nb-1")
+}
+
+func TestApp_RollbackNotebook(t *testing.T) {
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	nb := &v1beta1.Notebook{ObjectMeta: metav1.ObjectMeta{Name: "nb", Namespace: "test"}}
+	other := newRevision("other-1", "jupyter:v1", true, time.Now())
+	other.Labels[revision.LabelKeyName] = "other"
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(nb, newRevision("nb-1", "jupyter:v1", false, time.Now()), other).
+		Build()
+
+	app := &App{client: k8s}
+	mux := app.Router(nil)
+
+	rollback := func(body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/namespaces/test/notebooks/nb/rollback", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	qt.Assert(t, rollback(`{"revision": "nb-1"}`), qt.Equals, http.StatusAccepted)
+	qt.Assert(t, k8s.Get(context.Background(), client.ObjectKeyFromObject(nb), nb), qt.IsNil)
+	qt.Assert(t, nb.Spec.RevisionRef, qt.Equals, "nb-1")
+
+	qt.Assert(t, rollback(`{}`), qt.Equals, http.StatusBadRequest)
+	qt.Assert(t, rollback(`{"revision": "other-1"}`), qt.Equals, http.StatusBadRequest)
+	qt.Assert(t, rollback(`{"revision": "nb-missing"}`), qt.Equals, http.StatusNotFound)
+}
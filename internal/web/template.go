@@ -3,13 +3,17 @@ package web
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/johnhoman/notebook-controller/apis/v1beta1"
+	"github.com/johnhoman/notebook-controller/internal/revision"
 )
 
 const (
@@ -17,7 +21,8 @@ const (
 )
 
 // ListTemplates responds will all the template resources
-// that exist in a namespace.
+// that exist in a namespace, and the cluster templates the
+// namespace is allowed to use.
 func (app *App) ListTemplates(c *gin.Context) {
 	ns := c.Param("namespace")
 	if ns == "" {
@@ -45,35 +50,208 @@ func (app *App) ListTemplates(c *gin.Context) {
 		return
 	}
 
-	templates := make([]Template, 0)
-	for _, item := range templateList.Items {
+	templates := make([]Template, 0, len(templateList.Items))
+	for k := range templateList.Items {
+		item := &templateList.Items[k]
+		if resolved, ok := app.resolveTemplate(ctx, v1beta1.KindTemplate, client.ObjectKeyFromObject(item)); ok {
+			templates = append(templates, newTemplate(resolved, v1beta1.KindTemplate))
+		}
+	}
 
-		opts := make([]TemplateOption, 0, len(item.Spec.Options))
-		for _, opt := range item.Spec.Options {
-			opts = append(opts, TemplateOption{
-				Name:        opt.Name,
-				Description: opt.Description,
-			})
+	// ClusterTemplates are listed along with the namespace's templates if
+	// workloads in the namespace are allowed to reference them.
+	clusterTemplateList := &v1beta1.ClusterTemplateList{}
+	if err := app.client.List(ctx, clusterTemplateList); err != nil {
+		app.abortWithError(c, err, "failed to list cluster templates")
+		return
+	}
+	if len(clusterTemplateList.Items) > 0 {
+		namespace := &corev1.Namespace{}
+		if err := app.client.Get(ctx, types.NamespacedName{Name: ns}, namespace); err != nil {
+			app.abortWithError(c, err, "failed to get namespace", zap.String("namespace", ns))
+			return
+		}
+		for k := range clusterTemplateList.Items {
+			item := &clusterTemplateList.Items[k]
+			ok, err := item.AllowsNamespace(namespace)
+			if err != nil {
+				if app.logger != nil {
+					app.logger.Error("invalid allowed namespaces", zap.Error(err), zap.String("clusterTemplate", item.Name))
+				}
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if resolved, ok := app.resolveTemplate(ctx, v1beta1.KindClusterTemplate, client.ObjectKeyFromObject(item)); ok {
+				templates = append(templates, newTemplate(resolved, v1beta1.KindClusterTemplate))
+			}
 		}
-		templates = append(templates, Template{
-			Name:        item.Name,
-			Description: item.Annotations[AnnotationKeyDescription],
-		})
 	}
 	c.JSON(http.StatusOK, ListTemplateResponse{Templates: templates})
 }
 
+// resolveTemplate returns the template with the templates it extends
+// merged in, so it lists the options and parameters it inherits. It
+// returns false if the template can't be resolved, such as when a
+// template it extends doesn't exist, since workloads can't use it.
+func (app *App) resolveTemplate(ctx context.Context, kind string, key types.NamespacedName) (*v1beta1.Template, bool) {
+	template, err := revision.ResolveTemplate(ctx, app.client, kind, key)
+	if err != nil {
+		if app.logger != nil {
+			app.logger.Error("failed to resolve template", zap.Error(err), zap.String("kind", kind), zap.String("name", key.String()))
+		}
+		return nil, false
+	}
+	return template, true
+}
+
+// newTemplate returns the API representation of a Template or
+// ClusterTemplate.
+func newTemplate(item *v1beta1.Template, kind string) Template {
+	opts := make([]TemplateOption, 0, len(item.Spec.Options))
+	for _, opt := range item.Spec.Options {
+		opts = append(opts, TemplateOption{
+			Name:        opt.Name,
+			Description: opt.Description,
+			Group:       opt.Group,
+			Requires:    opt.Requires,
+			Conflicts:   opt.Conflicts,
+		})
+	}
+	groups := make([]TemplateOptionGroup, 0, len(item.Spec.OptionGroups))
+	for _, group := range item.Spec.OptionGroups {
+		groups = append(groups, TemplateOptionGroup{
+			Name:        group.Name,
+			Description: group.Description,
+			Policy:      group.Policy,
+		})
+	}
+	params := make([]TemplateParameter, 0, len(item.Spec.Parameters))
+	for _, param := range item.Spec.Parameters {
+		params = append(params, TemplateParameter{
+			Name:        param.Name,
+			Description: param.Description,
+			Type:        param.Type,
+			Default:     param.Default,
+			Enum:        param.Enum,
+			Minimum:     param.Minimum,
+			Maximum:     param.Maximum,
+		})
+	}
+	template := Template{
+		Name:         item.Name,
+		Kind:         kind,
+		Description:  item.Annotations[AnnotationKeyDescription],
+		Options:      opts,
+		OptionGroups: groups,
+		Parameters:   params,
+	}
+	if item.Deprecated() {
+		template.Deprecated = &TemplateDeprecation{Message: item.DeprecationMessage()}
+		if ref := item.Replacement(); ref != nil {
+			template.Deprecated.Replacement = ref.Name
+		}
+		if item.Spec.SunsetDate != nil {
+			template.Deprecated.SunsetDate = &item.Spec.SunsetDate.Time
+		}
+	}
+	return template
+}
+
+// ListTemplateRevisions responds with the revisions of a template
+// that workloads can pin to, newest first.
+func (app *App) ListTemplateRevisions(c *gin.Context) {
+	ns, name := c.Param("namespace"), c.Param("name")
+
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	key := types.NamespacedName{Name: name, Namespace: ns}
+	if err := app.client.Get(ctx, key, &v1beta1.Template{}); err != nil {
+		app.abortWithError(c, err, "failed to get template", zap.String("namespace", ns), zap.String("name", name))
+		return
+	}
+	revs, err := revision.ListTemplateRevisions(ctx, app.client, v1beta1.KindTemplate, key)
+	if err != nil {
+		app.abortWithError(c, err, "failed to list template revisions", zap.String("namespace", ns), zap.String("name", name))
+		return
+	}
+	versions := make([]TemplateVersion, 0, len(revs))
+	for _, rev := range revs {
+		versions = append(versions, TemplateVersion{
+			Name:            rev.Name,
+			ResourceVersion: rev.Spec.ResourceVersion,
+			CreatedAt:       rev.CreationTimestamp.Time,
+		})
+	}
+	c.JSON(http.StatusOK, ListTemplateRevisionsResponse{Revisions: versions})
+}
+
+// TemplateVersion is a revision of a template that workloads
+// can pin to with templateRef.revision.
+type TemplateVersion struct {
+	Name            string    `json:"name"`
+	ResourceVersion string    `json:"resourceVersion"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+type ListTemplateRevisionsResponse struct {
+	Revisions []TemplateVersion `json:"revisions"`
+}
+
 type TemplateOption struct {
 	// Unique Name of the template option
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Group is the name of the option group the option belongs to
+	Group string `json:"group,omitempty"`
+	// Requires are options that must be chosen with this option
+	Requires []string `json:"requires,omitempty"`
+	// Conflicts are options that can't be chosen with this option
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// TemplateOptionGroup constrains which options can be chosen
+// together. The Policy is either Exclusive, so at most one option
+// in the group can be chosen, or RequiredOneOf.
+type TemplateOptionGroup struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Policy      string `json:"policy"`
+}
+
+// TemplateParameter describes an input users provide when
+// creating a workload from the template.
+type TemplateParameter struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Default     *string  `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Minimum     *int64   `json:"minimum,omitempty"`
+	Maximum     *int64   `json:"maximum,omitempty"`
 }
 
 type Template struct {
-	Name        string           `json:"name"`
-	Description string           `json:"description"`
-	Options     []TemplateOption `json:"options"`
-	Image       string           `json:"image"`
+	Name string `json:"name"`
+	// Kind is either Template or ClusterTemplate, and is the kind
+	// workloads reference the template by.
+	Kind         string                `json:"kind"`
+	Description  string                `json:"description"`
+	Options      []TemplateOption      `json:"options"`
+	OptionGroups []TemplateOptionGroup `json:"optionGroups"`
+	Parameters   []TemplateParameter   `json:"parameters"`
+	Image        string                `json:"image"`
+	Deprecated   *TemplateDeprecation  `json:"deprecated,omitempty"`
+}
+
+// TemplateDeprecation tells users that a template is deprecated
+// and which template to use instead.
+type TemplateDeprecation struct {
+	Message     string     `json:"message"`
+	Replacement string     `json:"replacement,omitempty"`
+	SunsetDate  *time.Time `json:"sunsetDate,omitempty"`
 }
 
 type ListTemplateResponse struct {
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	qt "github.com/frankban/quicktest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
@@ -34,3 +36,141 @@ func TestApp_ListTemplates(t *testing.T) {
 		"templates": make([]any, 0),
 	})
 }
+
+func TestApp_ListTemplateRevisions(t *testing.T) {
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	template := &v1beta1.Template{ObjectMeta: metav1.ObjectMeta{Name: "jupyter", Namespace: "test"}}
+	rev := &v1beta1.TemplateRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "jupyter-1234abcd",
+			Namespace: "test",
+			Labels:    map[string]string{v1beta1.LabelKeyTemplateName: "jupyter"},
+		},
+		Spec: v1beta1.TemplateRevisionSpec{ResourceVersion: "42"},
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(template, rev).
+		Build()
+
+	app := &App{client: k8s}
+	mux := app.Router(nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/namespaces/test/templates/jupyter/revisions", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK)
+	qt.Assert(t, w.Body.String(), qt.JSONEquals, map[string]any{
+		"revisions": []any{map[string]any{
+			"name":            "jupyter-1234abcd",
+			"resourceVersion": "42",
+			"createdAt":       "0001-01-01T00:00:00Z",
+		}},
+	})
+
+	r = httptest.NewRequest(http.MethodGet, "/api/namespaces/test/templates/missing/revisions", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	qt.Assert(t, w.Code, qt.Equals, http.StatusNotFound)
+}
+
+func TestApp_ListTemplates_ClusterTemplates(t *testing.T) {
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "data"}}}
+	allowed := &v1beta1.ClusterTemplate{ObjectMeta: metav1.ObjectMeta{Name: "spark"}}
+	allowed.Spec.AllowedNamespaces = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "data"}}
+	denied := &v1beta1.ClusterTemplate{ObjectMeta: metav1.ObjectMeta{Name: "gpu"}}
+	denied.Spec.AllowedNamespaces = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "ml"}}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(
+			namespace,
+			&v1beta1.Template{ObjectMeta: metav1.ObjectMeta{Name: "jupyter", Namespace: "test"}},
+			allowed,
+			denied,
+		).
+		Build()
+
+	app := &App{client: k8s}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/namespaces/test/templates", nil)
+	w := httptest.NewRecorder()
+	app.Router(nil).ServeHTTP(w, r)
+
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK)
+	template := func(name, kind string) map[string]any {
+		return map[string]any{
+			"name":         name,
+			"kind":         kind,
+			"description":  "",
+			"options":      []any{},
+			"optionGroups": []any{},
+			"parameters":   []any{},
+			"image":        "",
+		}
+	}
+	qt.Assert(t, w.Body.String(), qt.JSONEquals, map[string]any{
+		"templates": []any{
+			template("jupyter", v1beta1.KindTemplate),
+			template("spark", v1beta1.KindClusterTemplate),
+		},
+	})
+}
+
+func TestApp_ListTemplates_Extends(t *testing.T) {
+
+	qt.Assert(t, v1beta1.AddToScheme(scheme.Scheme), qt.IsNil)
+	base := &v1beta1.Template{
+		ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "test"},
+		Spec: v1beta1.TemplateSpec{
+			Options:      []v1beta1.TemplateOption{{Name: "gpu", Description: "a gpu", Group: "accelerator"}},
+			OptionGroups: []v1beta1.OptionGroup{{Name: "accelerator", Description: "accelerators", Policy: v1beta1.OptionGroupPolicyExclusive}},
+			Parameters:   []v1beta1.TemplateParameter{{Name: "python", Description: "python version", Type: "string"}},
+		},
+	}
+	child := &v1beta1.Template{
+		ObjectMeta: metav1.ObjectMeta{Name: "scipy", Namespace: "test"},
+		Spec: v1beta1.TemplateSpec{
+			Extends: &corev1.LocalObjectReference{Name: "base"},
+			Options: []v1beta1.TemplateOption{{Name: "spark", Description: "spark"}},
+		},
+	}
+	k8s := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}}, base, child).
+		Build()
+
+	app := &App{client: k8s}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/namespaces/test/templates", nil)
+	w := httptest.NewRecorder()
+	app.Router(nil).ServeHTTP(w, r)
+
+	qt.Assert(t, w.Code, qt.Equals, http.StatusOK)
+	template := func(name string, options ...any) map[string]any {
+		return map[string]any{
+			"name":        name,
+			"kind":        v1beta1.KindTemplate,
+			"description": "",
+			"options":     options,
+			"optionGroups": []any{map[string]any{
+				"name": "accelerator", "description": "accelerators", "policy": "Exclusive",
+			}},
+			"parameters": []any{map[string]any{
+				"name": "python", "description": "python version", "type": "string",
+			}},
+			"image": "",
+		}
+	}
+	gpu := map[string]any{"name": "gpu", "description": "a gpu", "group": "accelerator"}
+	spark := map[string]any{"name": "spark", "description": "spark"}
+	qt.Assert(t, w.Body.String(), qt.JSONEquals, map[string]any{
+		"templates": []any{
+			template("base", gpu),
+			template("scipy", gpu, spark),
+		},
+	})
+}